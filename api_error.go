@@ -0,0 +1,175 @@
+package zulip
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Machine-readable error codes returned by Zulip in the code field.
+// See https://zulip.com/api/rest-error-handling
+const (
+	CodeBadRequest             = "BAD_REQUEST"
+	CodeRequestVariableMissing = "REQUEST_VARIABLE_MISSING"
+	CodeRequestVariableInvalid = "REQUEST_VARIABLE_INVALID"
+	CodeBadNarrow              = "BAD_NARROW"
+	CodeBadEventQueueID        = "BAD_EVENT_QUEUE_ID"
+	CodeRateLimitHit           = "RATE_LIMIT_HIT"
+	CodeUnauthorized           = "UNAUTHORIZED"
+	CodeInvalidAPIKey          = "INVALID_API_KEY"
+	CodeUserDeactivated        = "USER_DEACTIVATED"
+	CodeRealmDeactivated       = "REALM_DEACTIVATED"
+	CodeStreamDoesNotExist     = "STREAM_DOES_NOT_EXIST"
+	CodeReactionAlreadyExists  = "REACTION_ALREADY_EXISTS"
+	CodeReactionDoesNotExist   = "REACTION_DOES_NOT_EXIST"
+)
+
+// Sentinel errors to be used with errors.Is on an *APIError.
+var (
+	ErrBadRequest             = errors.New("bad request")
+	ErrRequestVariableMissing = errors.New("request variable missing")
+	ErrRequestVariableInvalid = errors.New("request variable invalid")
+	ErrBadNarrow              = errors.New("bad narrow")
+	ErrBadEventQueueID        = errors.New("bad event queue id")
+	// ErrRateLimited matches RATE_LIMIT_HIT errors and any 429 response.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnauthorized matches UNAUTHORIZED and INVALID_API_KEY errors and any
+	// 401 response.
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrUserDeactivated       = errors.New("user deactivated")
+	ErrRealmDeactivated      = errors.New("realm deactivated")
+	ErrStreamDoesNotExist    = errors.New("stream does not exist")
+	ErrReactionAlreadyExists = errors.New("reaction already exists")
+	ErrReactionDoesNotExist  = errors.New("reaction does not exist")
+)
+
+var apiErrorSentinels = map[string]error{
+	CodeBadRequest:             ErrBadRequest,
+	CodeRequestVariableMissing: ErrRequestVariableMissing,
+	CodeRequestVariableInvalid: ErrRequestVariableInvalid,
+	CodeBadNarrow:              ErrBadNarrow,
+	CodeBadEventQueueID:        ErrBadEventQueueID,
+	CodeRateLimitHit:           ErrRateLimited,
+	CodeUnauthorized:           ErrUnauthorized,
+	CodeInvalidAPIKey:          ErrUnauthorized,
+	CodeUserDeactivated:        ErrUserDeactivated,
+	CodeRealmDeactivated:       ErrRealmDeactivated,
+	CodeStreamDoesNotExist:     ErrStreamDoesNotExist,
+	CodeReactionAlreadyExists:  ErrReactionAlreadyExists,
+	CodeReactionDoesNotExist:   ErrReactionDoesNotExist,
+}
+
+// APIError is returned by DoRequest and DoFileRequest for non-success Zulip
+// responses when the client is created with WithAPIErrors.
+type APIError struct {
+	// HTTPCode is the HTTP status code of the response.
+	HTTPCode int
+	// Code is the machine-readable error string.
+	Code string
+	// Msg is the human-readable error message.
+	Msg string
+	// Fields holds every field of the response, including the extra ones
+	// such as queue_id, param_name or var_name.
+	Fields map[string]any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("zulip api error (http %d): %s: %s", e.HTTPCode, e.Code, e.Msg)
+}
+
+// Is makes the error match the sentinel error of its code.
+func (e *APIError) Is(target error) bool {
+	switch {
+	case target == ErrRateLimited && e.HTTPCode == http.StatusTooManyRequests:
+		return true
+	case target == ErrUnauthorized && e.HTTPCode == http.StatusUnauthorized:
+		return true
+	}
+
+	sentinel, ok := apiErrorSentinels[e.Code]
+
+	return ok && sentinel == target
+}
+
+// FieldValue returns the value of a field in the error response.
+func (e *APIError) FieldValue(field string) (any, error) {
+	if v, found := e.Fields[field]; found {
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("field '%s' not found in error response fields", field)
+}
+
+// QueueID returns the queue_id field sent along BAD_EVENT_QUEUE_ID errors.
+func (e *APIError) QueueID() string {
+	return e.stringField("queue_id")
+}
+
+// ParamName returns the param_name field sent along invalid parameter errors.
+func (e *APIError) ParamName() string {
+	return e.stringField("param_name")
+}
+
+// VarName returns the var_name field sent along missing parameter errors.
+func (e *APIError) VarName() string {
+	return e.stringField("var_name")
+}
+
+func (e *APIError) stringField(field string) string {
+	v, _ := e.Fields[field].(string)
+	return v
+}
+
+// WithAPIErrors makes DoRequest and DoFileRequest return an *APIError when
+// the server answers with a non-success response, so it can be handled with
+// errors.Is and errors.As instead of checking IsError on every response.
+func WithAPIErrors() ClientOption {
+	return func(o *clientOptions) error {
+		o.apiErrors = true
+		return nil
+	}
+}
+
+// ResponseError returns the *APIError of an error response, nil otherwise:
+// the error DoRequest returns for it when the client is created with
+// WithAPIErrors.
+func ResponseError(response APIResponse) error {
+	httpCode := 0
+	if r, ok := response.(interface{ HTTPCode() int }); ok {
+		httpCode = r.HTTPCode()
+	}
+
+	if apiErr := newAPIError(httpCode, response); apiErr != nil {
+		return apiErr
+	}
+
+	return nil
+}
+
+// apiErrorResponse is implemented by every response embedding APIResponseBase.
+type apiErrorResponse interface {
+	IsError() bool
+	Code() string
+	Msg() string
+	AllFields() map[string]any
+}
+
+// newAPIError returns an *APIError if the response is an error, nil
+// otherwise.
+func newAPIError(httpCode int, response APIResponse) *APIError {
+	r, ok := response.(apiErrorResponse)
+	if !ok {
+		return nil
+	}
+
+	if !r.IsError() && httpCode < http.StatusBadRequest {
+		return nil
+	}
+
+	return &APIError{
+		HTTPCode: httpCode,
+		Code:     r.Code(),
+		Msg:      r.Msg(),
+		Fields:   r.AllFields(),
+	}
+}
@@ -0,0 +1,174 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestAPIErrors(t *testing.T) {
+	cases := []struct {
+		name           string
+		statusCode     int
+		body           string
+		expectedErr    error
+		expectedCode   string
+		expectedFields func(t *testing.T, e *zulip.APIError)
+	}{
+		{
+			name:       "bad event queue id",
+			statusCode: http.StatusBadRequest,
+			body: `{
+    "code": "BAD_EVENT_QUEUE_ID",
+    "msg": "Bad event queue ID: fb67bf8a-c031-47cc-84cf-ed80accacda8",
+    "queue_id": "fb67bf8a-c031-47cc-84cf-ed80accacda8",
+    "result": "error"
+}`,
+			expectedErr:  zulip.ErrBadEventQueueID,
+			expectedCode: zulip.CodeBadEventQueueID,
+			expectedFields: func(t *testing.T, e *zulip.APIError) {
+				assert.Equal(t, "fb67bf8a-c031-47cc-84cf-ed80accacda8", e.QueueID())
+			},
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			body: `{
+    "code": "RATE_LIMIT_HIT",
+    "msg": "API usage exceeded rate limit",
+    "result": "error",
+    "retry-after": 28.706807374954224
+}`,
+			expectedErr:  zulip.ErrRateLimited,
+			expectedCode: zulip.CodeRateLimitHit,
+			expectedFields: func(t *testing.T, e *zulip.APIError) {
+				v, err := e.FieldValue("retry-after")
+				require.NoError(t, err)
+				assert.InDelta(t, 28.706807374954224, v, 0.0001)
+			},
+		},
+		{
+			name:       "invalid api key",
+			statusCode: http.StatusUnauthorized,
+			body: `{
+    "code": "INVALID_API_KEY",
+    "msg": "Invalid API key",
+    "result": "error"
+}`,
+			expectedErr:  zulip.ErrUnauthorized,
+			expectedCode: zulip.CodeInvalidAPIKey,
+		},
+		{
+			name:       "missing argument",
+			statusCode: http.StatusBadRequest,
+			body: `{
+    "code": "REQUEST_VARIABLE_MISSING",
+    "msg": "Missing 'content' argument",
+    "result": "error",
+    "var_name": "content"
+}`,
+			expectedErr:  zulip.ErrRequestVariableMissing,
+			expectedCode: zulip.CodeRequestVariableMissing,
+			expectedFields: func(t *testing.T, e *zulip.APIError) {
+				assert.Equal(t, "content", e.VarName())
+			},
+		},
+		{
+			name:       "stream does not exist",
+			statusCode: http.StatusBadRequest,
+			body: `{
+    "code": "STREAM_DOES_NOT_EXIST",
+    "msg": "Channel 'nonexistent' does not exist",
+    "result": "error",
+    "stream": "nonexistent"
+}`,
+			expectedErr:  zulip.ErrStreamDoesNotExist,
+			expectedCode: zulip.CodeStreamDoesNotExist,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.statusCode)
+				_, _ = w.Write([]byte(c.body))
+			}))
+			defer mockServer.Close()
+
+			client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+				zulip.WithAPIErrors(),
+			)
+			require.NoError(t, err)
+
+			var resp zulip.APIResponseBase
+
+			err = client.DoRequest(context.TODO(), http.MethodPost, "/endpoint", nil, &resp)
+			require.ErrorIs(t, err, c.expectedErr)
+			assert.NotErrorIs(t, err, zulip.ErrBadRequest)
+
+			var apiErr *zulip.APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, c.statusCode, apiErr.HTTPCode)
+			assert.Equal(t, c.expectedCode, apiErr.Code)
+			assert.NotEmpty(t, apiErr.Msg)
+
+			if c.expectedFields != nil {
+				c.expectedFields(t, apiErr)
+			}
+
+			// the response is still filled in
+			assert.True(t, resp.IsError())
+			assert.Equal(t, c.statusCode, resp.HTTPCode())
+
+			// the file request path behaves the same
+			err = client.DoFileRequest(context.TODO(), http.MethodPost, "/endpoint", "file.txt", strings.NewReader("content"), &resp)
+			require.ErrorIs(t, err, c.expectedErr)
+		})
+	}
+}
+
+func TestAPIErrorsDisabledByDefault(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code": "BAD_REQUEST", "msg": "Bad request", "result": "error"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodPost, "/endpoint", nil, &resp))
+	assert.True(t, resp.IsError())
+}
+
+func TestAPIErrorsSuccess(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"msg": "", "result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithAPIErrors(),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp))
+	assert.True(t, resp.IsSuccess())
+}
+
+func TestAPIErrorUnknownCode(t *testing.T) {
+	err := error(&zulip.APIError{HTTPCode: http.StatusBadRequest, Code: "SOMETHING_NEW", Msg: "new error"})
+
+	assert.NotErrorIs(t, err, zulip.ErrBadRequest)
+	assert.Equal(t, "zulip api error (http 400): SOMETHING_NEW: new error", err.Error())
+}
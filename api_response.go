@@ -1,9 +1,14 @@
 package zulip
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"slices"
+	"sync"
 )
 
 const (
@@ -51,8 +56,43 @@ type APIResponseBase struct {
 	// "BAD_REQUEST" for general errors.
 	code string
 
-	// allFields: a map of all the fields returned in the response.
-	allFields map[string]any
+	// allFields: all the fields returned in the response, decoded on first
+	// use.
+	allFields *lazyFields
+}
+
+// lazyFields decodes the fields of a response when first needed, most
+// responses are only read through their typed fields.
+type lazyFields struct {
+	once   sync.Once
+	raw    []byte
+	fields map[string]any
+}
+
+func newLazyFields(raw []byte) *lazyFields {
+	return &lazyFields{raw: bytes.Clone(raw)}
+}
+
+// newDecodedFields returns already decoded fields.
+func newDecodedFields(fields map[string]any) *lazyFields {
+	l := &lazyFields{fields: fields}
+	l.once.Do(func() {})
+
+	return l
+}
+
+func (l *lazyFields) get() map[string]any {
+	if l == nil {
+		return nil
+	}
+
+	l.once.Do(func() {
+		// the response was validated when decoded
+		_ = json.Unmarshal(l.raw, &l.fields)
+		l.raw = nil
+	})
+
+	return l.fields
 }
 
 // HTTPCode returns the HTTP status code of the response.
@@ -75,6 +115,12 @@ func (a *APIResponseBase) SetHTTPHeaders(headers http.Header) {
 	a.httpHeaders = headers.Clone()
 }
 
+// SetResult sets the result of the responses of the endpoints not sending
+// one, like the tus uploads.
+func (a *APIResponseBase) SetResult(result string) {
+	a.result = result
+}
+
 func (a APIResponseBase) XRateLimitRemaining() string {
 	return a.httpHeaders.Get(XRateLimitRemaining)
 }
@@ -114,7 +160,7 @@ func (a APIResponseBase) IsSuccess() bool {
 
 // FieldValue returns the value of a field in the response.
 func (a APIResponseBase) FieldValue(field string) (any, error) {
-	if v, found := a.allFields[field]; found {
+	if v, found := a.allFields.get()[field]; found {
 		return v, nil
 	}
 
@@ -123,53 +169,143 @@ func (a APIResponseBase) FieldValue(field string) (any, error) {
 
 // AllFields returns all the fields in the response.
 func (a APIResponseBase) AllFields() map[string]any {
-	return a.allFields
+	return a.allFields.get()
 }
 
+// UnmarshalJSON decodes the result, msg and code fields. The other fields
+// are only decoded when FieldValue or AllFields need them.
 func (a *APIResponseBase) UnmarshalJSON(b []byte) error {
 	if string(b) == "null" || string(b) == `""` {
 		return nil
 	}
 
-	var (
-		code      string
-		result    string
-		msg       string
-		allFields map[string]any
-	)
+	var header struct {
+		Code   string `json:"code"`
+		Msg    string `json:"msg"`
+		Result string `json:"result"`
+	}
+
+	if err := json.Unmarshal(b, &header); err != nil {
+		// fields of unexpected types are ignored
+		return a.unmarshalFields(b)
+	}
+
+	*a = APIResponseBase{
+		code:      header.Code,
+		msg:       header.Msg,
+		result:    header.Result,
+		allFields: newLazyFields(b),
+	}
+
+	return nil
+}
 
+// unmarshalFields decodes every field of the response and takes result, msg
+// and code from them when they are strings.
+func (a *APIResponseBase) unmarshalFields(b []byte) error {
+	var allFields map[string]any
 	if err := json.Unmarshal(b, &allFields); err != nil {
 		return err
 	}
 
-	if v, found := allFields["code"]; found {
-		if val, ok := v.(string); ok {
-			code = val
-		}
+	str := func(field string) string {
+		v, _ := allFields[field].(string)
+		return v
 	}
 
-	if v, found := allFields["msg"]; found {
-		if val, ok := v.(string); ok {
-			msg = val
+	*a = APIResponseBase{
+		code:      str("code"),
+		msg:       str("msg"),
+		result:    str("result"),
+		allFields: newDecodedFields(allFields),
+	}
+
+	return nil
+}
+
+// UnmarshalResponse decodes a response in a single pass: the result, msg and
+// code fields into base, and the other fields into data, a pointer to a struct
+// decoded with its json tags. It is meant for the UnmarshalJSON method of the
+// responses embedding APIResponseBase:
+//
+//	func (r *MyResponse) UnmarshalJSON(b []byte) error {
+//		return zulip.UnmarshalResponse(b, &r.APIResponseBase, &r.myResponseData)
+//	}
+//
+// The result, msg and code fields are not decoded into data. The structs with
+// methods, and other types, are decoded in a second pass.
+func UnmarshalResponse(b []byte, base *APIResponseBase, data any) error {
+	if string(b) == "null" || string(b) == `""` {
+		return nil
+	}
+
+	envelope, ok := newResponseEnvelope(data)
+	if !ok {
+		if err := json.Unmarshal(b, base); err != nil {
+			return err
 		}
+
+		return json.Unmarshal(b, data)
 	}
 
-	if v, found := allFields["result"]; found {
-		if val, ok := v.(string); ok {
-			result = val
+	if err := json.Unmarshal(b, envelope.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) || !slices.Contains([]string{"code", "msg", "result"}, typeErr.Field) {
+			return err
+		}
+
+		// fields of unexpected types are ignored
+		if err := base.unmarshalFields(b); err != nil {
+			return err
 		}
+
+		return json.Unmarshal(b, data)
 	}
 
-	*a = APIResponseBase{
-		code:      code,
-		msg:       msg,
-		result:    result,
-		allFields: allFields,
+	header := envelope.Elem()
+
+	*base = APIResponseBase{
+		code:      header.Field(0).String(),
+		msg:       header.Field(1).String(),
+		result:    header.Field(2).String(),
+		allFields: newLazyFields(b),
 	}
 
 	return nil
 }
 
+// responseEnvelopes caches the envelope types of newResponseEnvelope by the
+// type of their data.
+var responseEnvelopes sync.Map
+
+// newResponseEnvelope returns a pointer to a struct holding the result, msg
+// and code fields and embedding data, so encoding/json decodes them together.
+// It returns false when data can not be embedded: it is not a pointer to a
+// struct, or the struct has methods, which reflect.StructOf does not support.
+func newResponseEnvelope(data any) (reflect.Value, bool) {
+	ptr := reflect.ValueOf(data)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct || ptr.Type().NumMethod() > 0 {
+		return reflect.Value{}, false
+	}
+
+	envelopeType, found := responseEnvelopes.Load(ptr.Type())
+	if !found {
+		str := reflect.TypeFor[string]()
+
+		envelopeType, _ = responseEnvelopes.LoadOrStore(ptr.Type(), reflect.StructOf([]reflect.StructField{
+			{Name: "Code", Type: str, Tag: `json:"code"`},
+			{Name: "Msg", Type: str, Tag: `json:"msg"`},
+			{Name: "Result", Type: str, Tag: `json:"result"`},
+			{Name: "Data", Type: ptr.Type(), Anonymous: true},
+		}))
+	}
+
+	envelope := reflect.New(envelopeType.(reflect.Type))
+	envelope.Elem().Field(3).Set(ptr)
+
+	return envelope, true
+}
+
 func (a APIResponseBase) MarshalJSON() ([]byte, error) {
-	return json.Marshal(a.allFields)
+	return json.Marshal(a.allFields.get())
 }
@@ -1,7 +1,13 @@
 package zulip
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,3 +58,197 @@ func TestAPIResponseMarshalling(t *testing.T) {
 		assert.JSONEq(t, c.input, string(erJSON))
 	}
 }
+
+func TestAPIResponseLazyFields(t *testing.T) {
+	input := []byte(`{"result":"error","msg":"Missing 'content' argument","code":"REQUEST_VARIABLE_MISSING","var_name":"content"}`)
+
+	er := APIResponseBase{}
+	require.NoError(t, json.Unmarshal(input, &er))
+
+	// the input buffer may be reused by the caller
+	copy(input, bytes.Repeat([]byte(" "), len(input)))
+
+	assert.Equal(t, "REQUEST_VARIABLE_MISSING", er.Code())
+
+	// copies share the decoded fields
+	copied := er
+
+	varName, err := copied.FieldValue("var_name")
+	require.NoError(t, err)
+	assert.Equal(t, "content", varName)
+	assert.Len(t, er.AllFields(), 4)
+
+	// fields of unexpected types
+	require.NoError(t, json.Unmarshal([]byte(`{"result":"error","msg":"failed","code":500}`), &er))
+	assert.Equal(t, "failed", er.Msg())
+	assert.Empty(t, er.Code())
+	assert.InDelta(t, 500, er.AllFields()["code"], 0)
+
+	require.Error(t, json.Unmarshal([]byte(`["not","an","object"]`), &er))
+	assert.Nil(t, APIResponseBase{}.AllFields())
+}
+
+type testMessagesData struct {
+	Messages []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	FoundNewest bool `json:"found_newest"`
+}
+
+// testMessagesResponse is a response decoded like the ones of the services.
+type testMessagesResponse struct {
+	APIResponseBase
+	testMessagesData
+}
+
+func (r *testMessagesResponse) UnmarshalJSON(b []byte) error {
+	return UnmarshalResponse(b, &r.APIResponseBase, &r.testMessagesData)
+}
+
+// testMessagesResponseTwoPasses is a response decoded in two passes, as the
+// services did before UnmarshalResponse.
+type testMessagesResponseTwoPasses struct {
+	APIResponseBase
+	testMessagesData
+}
+
+func (r *testMessagesResponseTwoPasses) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &r.APIResponseBase); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &r.testMessagesData)
+}
+
+// withMethods is decoded in a second pass, reflect.StructOf can not embed it.
+type withMethods struct {
+	Count int `json:"count"`
+}
+
+func (withMethods) String() string { return "with methods" }
+
+func TestUnmarshalResponse(t *testing.T) {
+	input := []byte(`{"result":"success","msg":"","code":"OK","messages":[{"id":1,"content":"hi"}],"found_newest":true}`)
+
+	var r testMessagesResponse
+	require.NoError(t, json.Unmarshal(input, &r))
+	assert.True(t, r.IsSuccess())
+	assert.Equal(t, "OK", r.Code())
+	assert.True(t, r.FoundNewest)
+	require.Len(t, r.Messages, 1)
+	assert.Equal(t, "hi", r.Messages[0].Content)
+	assert.Len(t, r.AllFields(), 5)
+
+	// fields of unexpected types are ignored
+	r = testMessagesResponse{}
+	require.NoError(t, json.Unmarshal([]byte(`{"result":"error","msg":"failed","code":500,"found_newest":true}`), &r))
+	assert.Equal(t, "failed", r.Msg())
+	assert.Empty(t, r.Code())
+	assert.True(t, r.FoundNewest)
+
+	// but not the ones of the data
+	require.Error(t, json.Unmarshal([]byte(`{"result":"success","found_newest":"yes"}`), &r))
+
+	// the types that can not be embedded
+	var base APIResponseBase
+
+	var data withMethods
+	require.NoError(t, UnmarshalResponse([]byte(`{"result":"success","count":3}`), &base, &data))
+	assert.True(t, base.IsSuccess())
+	assert.Equal(t, 3, data.Count)
+
+	var fields map[string]any
+	require.NoError(t, UnmarshalResponse([]byte(`{"result":"success","count":3}`), &base, &fields))
+	assert.True(t, base.IsSuccess())
+	assert.Len(t, fields, 2)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// BenchmarkDoRequest measures the whole path of a request, from the encoding
+// of its parameters to the decoding of its response, with the response
+// decoded in a single pass or in two, e.g.
+//
+//	go test . -run '^$' -bench DoRequest -benchmem
+func BenchmarkDoRequest(b *testing.B) {
+	var messages []string
+	for i := range 100 {
+		messages = append(messages, fmt.Sprintf(`{"id":%d,"content":"<p>message %d</p>","flags":["read"],"reactions":[]}`, i, i))
+	}
+
+	body := []byte(`{"result":"success","msg":"","found_newest":true,"messages":[` + strings.Join(messages, ",") + `]}`)
+
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	client, err := NewClient(Credentials("https://chat.example.com", "email@test", "apikey"),
+		WithHTTPClient(&http.Client{Transport: transport}),
+	)
+	require.NoError(b, err)
+
+	params := map[string]any{"anchor": "newest", "num_before": 100, "num_after": 0}
+
+	b.Run("single-pass", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+
+		for b.Loop() {
+			var resp testMessagesResponse
+			if err := client.DoRequest(context.Background(), http.MethodGet, "/api/v1/messages", params, &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("two-passes", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+
+		for b.Loop() {
+			var resp testMessagesResponseTwoPasses
+			if err := client.DoRequest(context.Background(), http.MethodGet, "/api/v1/messages", params, &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkAPIResponseBaseUnmarshal compares the decoding of a response
+// with the former decoding of all its fields.
+func BenchmarkAPIResponseBaseUnmarshal(b *testing.B) {
+	input := []byte(`{"result":"success","msg":"","id":42,"automatic_new_visibility_policy":2,` +
+		`"ignored_parameters_unsupported":["invalid_param_1"],"flags":["read","starred","mentioned"]}`)
+
+	b.Run("lazy", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			var r APIResponseBase
+			if err := json.Unmarshal(input, &r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("all-fields", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			var r APIResponseBase
+			if err := r.unmarshalFields(input); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// Package cassette provides an http.RoundTripper recording the exchanges of
+// the zulip client with a real server into cassette files, and replaying
+// them offline for deterministic tests.
+//
+// Implemented features:
+//   - Record, replay, and replay or record when the cassette is missing
+//   - API keys, passwords and authorization headers redacted before saving
+//   - Requests matched by method, path and decoded parameters, including the
+//     parts of multipart uploads
+//   - Responses replayed in the recorded order, so repeated requests like
+//     event queue long polls get their successive responses
+//
+// Usage:
+//
+//	rec, err := cassette.New("testdata/send_message.json")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Save()
+//
+//	client, err := zulip.NewClient(credentials, zulip.WithHTTPClient(rec.HTTPClient()))
+//
+// Cassettes are JSON files meant to be committed along with the tests.
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Version is the version of the cassette file format.
+const Version = 1
+
+// Cassette holds the recorded exchanges.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. Only the path of the URL is kept, so a
+// cassette can be replayed against any site.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Form holds the parameters of the query string and of form-urlencoded
+	// bodies.
+	Form   url.Values  `json:"form,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	// Parts holds the parts of multipart bodies.
+	Parts []Part `json:"parts,omitempty"`
+	// Body holds the other bodies.
+	Body Body `json:"body,omitzero"`
+}
+
+// Part is a part of a multipart request body.
+type Part struct {
+	Name     string `json:"name"`
+	FileName string `json:"filename,omitempty"`
+	Body     Body   `json:"body"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body"`
+}
+
+// Body is a request or response body, saved as text when it is valid UTF-8
+// and base64 encoded otherwise.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	if err != nil {
+		return fmt.Errorf("invalid base64 body: %w", err)
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+
+	if c.Version != Version {
+		return nil, fmt.Errorf("reading cassette %s: unsupported version %d", path, c.Version)
+	}
+
+	return &c, nil
+}
+
+// Save writes the cassette to a file, creating its directory if needed. The
+// file is replaced atomically.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		return errors.Join(err, tmp.Close(), os.Remove(tmp.Name()))
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,343 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wakumaku/go-zulip/internal/redact"
+)
+
+// Mode selects whether a Recorder records or replays.
+type Mode int
+
+const (
+	// ModeReplayOrRecord replays the cassette when its file exists and
+	// records it otherwise.
+	ModeReplayOrRecord Mode = iota
+	// ModeRecord sends the requests to the server and records them,
+	// replacing the cassette.
+	ModeRecord
+	// ModeReplay replays the cassette, failing when its file does not exist.
+	ModeReplay
+)
+
+// Redacted replaces the redacted values.
+const Redacted = redact.Redacted
+
+// ErrInteractionNotFound is returned when replaying a request that does not
+// match any remaining recorded interaction.
+var ErrInteractionNotFound = errors.New("cassette: no recorded interaction matches the request")
+
+// DefaultRedactedHeaders are the headers redacted from the cassettes.
+var DefaultRedactedHeaders = slices.Clone(redact.Headers)
+
+// DefaultRedactedFields are the request parameters and the response fields
+// redacted from the cassettes, matched case insensitively.
+var DefaultRedactedFields = slices.Clone(redact.Params)
+
+// Matcher reports whether a recorded request matches an actual request, both
+// redacted.
+type Matcher func(recorded, actual *Request) bool
+
+// DefaultMatcher matches the requests with the same method, path,
+// parameters and body. Headers are ignored.
+func DefaultMatcher(recorded, actual *Request) bool {
+	return recorded.Method == actual.Method &&
+		recorded.Path == actual.Path &&
+		formEqual(recorded.Form, actual.Form) &&
+		slices.EqualFunc(recorded.Parts, actual.Parts, func(a, b Part) bool {
+			return a.Name == b.Name && a.FileName == b.FileName && bytes.Equal(a.Body, b.Body)
+		}) &&
+		bytes.Equal(recorded.Body, actual.Body)
+}
+
+func formEqual(a, b url.Values) bool {
+	return maps.EqualFunc(a, b, slices.Equal)
+}
+
+// Recorder is an http.RoundTripper recording or replaying a cassette. It is
+// safe for concurrent use.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	redact    *redact.Policy
+	matcher   Matcher
+
+	mu        sync.Mutex
+	cassette  *Cassette
+	used      []bool
+	recording bool
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithMode sets the mode of the recorder, ModeReplayOrRecord by default.
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// WithTransport sets the transport used to send the requests when
+// recording, http.DefaultTransport by default.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithRedactedHeaders adds headers to DefaultRedactedHeaders.
+func WithRedactedHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		r.redact.AddHeaders(names...)
+	}
+}
+
+// WithRedactedFields adds request parameters and response fields to
+// DefaultRedactedFields.
+func WithRedactedFields(names ...string) Option {
+	return func(r *Recorder) {
+		r.redact.AddParams(names...)
+	}
+}
+
+// WithMatcher replaces DefaultMatcher.
+func WithMatcher(matcher Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = matcher
+	}
+}
+
+// New creates a recorder of the cassette file at path. In replay mode, the
+// cassette is loaded immediately.
+func New(path string, options ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		transport: http.DefaultTransport,
+		redact:    redact.NewPolicy(DefaultRedactedFields, DefaultRedactedHeaders),
+		matcher:   DefaultMatcher,
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	switch r.mode {
+	case ModeRecord:
+		r.recording = true
+	case ModeReplay, ModeReplayOrRecord:
+		c, err := Load(path)
+		if errors.Is(err, fs.ErrNotExist) && r.mode == ModeReplayOrRecord {
+			r.recording = true
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.cassette = c
+		r.used = make([]bool, len(c.Interactions))
+	default:
+		return nil, fmt.Errorf("cassette: invalid mode %d", r.mode)
+	}
+
+	if r.recording {
+		r.cassette = &Cassette{Version: Version}
+	}
+
+	return r, nil
+}
+
+// IsRecording reports whether the recorder sends the requests to the server.
+func (r *Recorder) IsRecording() bool {
+	return r.recording
+}
+
+// HTTPClient returns an HTTP client using the recorder, to be given to
+// zulip.WithHTTPClient.
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes the recorded cassette. It does nothing when replaying.
+func (r *Recorder) Save() error {
+	if !r.recording {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cassette.Save(r.path)
+}
+
+// RoundTrip records or replays a request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := r.request(req, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.recording {
+		return r.replay(req, recorded)
+	}
+
+	// the transport must not modify the original request
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: *recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.redact.Header(resp.Header),
+			Body:       r.redact.JSON(respBody),
+		},
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the response of the first unused interaction matching the
+// request.
+func (r *Recorder) replay(req *http.Request, actual *Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matcher(&interaction.Request, actual) {
+			continue
+		}
+
+		r.used[i] = true
+
+		recorded := interaction.Response
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			StatusCode:    recorded.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recorded.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, actual.Method, actual.Path)
+}
+
+// readBody reads and closes the body of a request.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	defer req.Body.Close()
+
+	return io.ReadAll(req.Body)
+}
+
+// request returns the redacted recorded form of a request.
+func (r *Recorder) request(req *http.Request, body []byte) (*Request, error) {
+	recorded := &Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Header: r.redact.Header(req.Header),
+	}
+
+	form := req.URL.Query()
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("cassette: parsing form body: %w", err)
+		}
+
+		for k, v := range values {
+			form[k] = append(form[k], v...)
+		}
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		parts, err := readParts(body, params["boundary"])
+		if err != nil {
+			return nil, err
+		}
+
+		recorded.Parts = parts
+		// the random boundary would prevent matching
+		recorded.Header.Set("Content-Type", mediaType)
+	default:
+		recorded.Body = r.redact.JSON(body)
+	}
+
+	if len(form) > 0 {
+		recorded.Form = r.redact.Form(form)
+	}
+
+	return recorded, nil
+}
+
+func readParts(body []byte, boundary string) ([]Part, error) {
+	var parts []Part
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	for {
+		p, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("cassette: parsing multipart body: %w", err)
+		}
+
+		content, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: parsing multipart body: %w", err)
+		}
+
+		parts = append(parts, Part{Name: p.FormName(), FileName: p.FileName(), Body: content})
+	}
+}
@@ -0,0 +1,129 @@
+package cassette_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/cassette"
+	"github.com/wakumaku/go-zulip/messages"
+	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/realtime"
+	"github.com/wakumaku/go-zulip/realtime/events"
+	"github.com/wakumaku/go-zulip/zuliptest"
+)
+
+// session runs a few API calls and returns what was received.
+func session(t *testing.T, creds zulip.CredentialsProvider, rec *cassette.Recorder) []any {
+	t.Helper()
+
+	ctx := context.Background()
+
+	client, err := zulip.NewClient(creds, zulip.WithHTTPClient(rec.HTTPClient()))
+	require.NoError(t, err)
+
+	rtSvc := realtime.NewService(client)
+	msgSvc := messages.NewService(client)
+
+	queue, err := rtSvc.RegisterEvetQueue(ctx, realtime.EventTypes(events.MessageType))
+	require.NoError(t, err)
+
+	sent, err := msgSvc.SendMessageToUsers(ctx, recipient.ToUser(zuliptest.DefaultUserEmail), "note to self")
+	require.NoError(t, err)
+
+	upload, err := msgSvc.UploadFileFromBytes(ctx, "data.bin", []byte{0xff, 0x00, 0xfe})
+	require.NoError(t, err)
+
+	polled, err := rtSvc.GetEventsEventQueue(ctx, queue.QueueID, realtime.LastEventID(queue.LastEventID))
+	require.NoError(t, err)
+	require.Len(t, polled.Events, 1)
+
+	return []any{queue.QueueID, sent.ID, upload.URL, polled.Events[0].EventID()}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "session.json")
+
+	srv := zuliptest.NewServer()
+
+	rec, err := cassette.New(path)
+	require.NoError(t, err)
+	assert.True(t, rec.IsRecording())
+
+	recorded := session(t, srv.Credentials(), rec)
+	require.NoError(t, rec.Save())
+	srv.Close()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), zuliptest.DefaultUserAPIKey)
+	assert.Contains(t, string(data), cassette.Redacted)
+
+	// replayed without any server, against another site
+	rec, err = cassette.New(path)
+	require.NoError(t, err)
+	assert.False(t, rec.IsRecording())
+
+	replayed := session(t, zulip.Credentials("https://zulip.invalid", zuliptest.DefaultUserEmail, "another-key"), rec)
+	assert.Equal(t, recorded, replayed)
+}
+
+func TestReplayUnknownRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.json")
+	require.NoError(t, (&cassette.Cassette{Version: cassette.Version}).Save(path))
+
+	rec, err := cassette.New(path, cassette.WithMode(cassette.ModeReplay))
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(zulip.Credentials("https://zulip.invalid", "bot@zulip.invalid", "key"),
+		zulip.WithHTTPClient(rec.HTTPClient()),
+	)
+	require.NoError(t, err)
+
+	_, err = messages.NewService(client).SendMessageToChannelTopic(context.Background(),
+		recipient.ToChannel("general"), "topic", "Hello")
+	require.ErrorIs(t, err, cassette.ErrInteractionNotFound)
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := cassette.New(filepath.Join(t.TempDir(), "missing.json"), cassette.WithMode(cassette.ModeReplay))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestRedactedResponseFields(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "redacted.json")
+
+	rec, err := cassette.New(path, cassette.WithMode(cassette.ModeRecord), cassette.WithRedactedFields("email"))
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(srv.Credentials(), zulip.WithHTTPClient(rec.HTTPClient()))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+	require.NoError(t, client.DoRequest(context.Background(), http.MethodGet, "/api/v1/users/me", nil, &resp))
+	require.NoError(t, rec.Save())
+
+	// the client received the real response
+	email, err := resp.FieldValue("email")
+	require.NoError(t, err)
+	assert.Equal(t, zuliptest.DefaultUserEmail, email)
+
+	c, err := cassette.Load(path)
+	require.NoError(t, err)
+	require.Len(t, c.Interactions, 1)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(c.Interactions[0].Response.Body, &body))
+	assert.Equal(t, cassette.Redacted, body["email"])
+	assert.Equal(t, []string{cassette.Redacted}, c.Interactions[0].Request.Header.Values("Authorization"))
+}
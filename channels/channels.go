@@ -25,23 +25,23 @@ func NewService(c zulip.RESTClient) *Service {
 
 // ChannelInfo are the fields usually returned when querying channel information
 type ChannelInfo struct {
-	CanAddSubscribersGroup     int    `json:"can_add_subscribers_group"`     // 10,
-	CanRemoveSubscribersGroup  int    `json:"can_remove_subscribers_group"`  // 10,
-	CreatorID                  int    `json:"creator_id"`                    // null,
-	DateCreated                int    `json:"date_created"`                  // 1691057093,
-	Description                string `json:"description"`                   // "A private channel",
-	FirstMessageID             int    `json:"first_message_id"`              // 18,
-	HistoryPublicToSubscribers bool   `json:"history_public_to_subscribers"` // false,
-	InviteOnly                 bool   `json:"invite_only"`                   // true,
-	IsAnnouncementOnly         bool   `json:"is_announcement_only"`          // false,
-	IsArchived                 bool   `json:"is_archived"`                   // false,
-	IsDefault                  bool   `json:"is_default"`                    // false,
-	IsRecentlyActive           bool   `json:"is_recently_active"`            // true,
-	IsWebPublic                bool   `json:"is_web_public"`                 // false,
-	MessageRetentionDays       int    `json:"message_retention_days"`        // null,
-	Name                       string `json:"name"`                          // "management",
-	RenderedDescription        string `json:"rendered_description"`          // "<p>A private channel</p>",
-	StreamID                   int    `json:"stream_id"`                     // 2,
-	StreamPostPolicy           int    `json:"stream_post_policy"`            // 1,
-	StreamWeeklyTraffic        int    `json:"stream_weekly_traffic"`         // null
+	CanAddSubscribersGroup     GroupSetting `json:"can_add_subscribers_group"`     // 10,
+	CanRemoveSubscribersGroup  GroupSetting `json:"can_remove_subscribers_group"`  // 10,
+	CreatorID                  int          `json:"creator_id"`                    // null,
+	DateCreated                int          `json:"date_created"`                  // 1691057093,
+	Description                string       `json:"description"`                   // "A private channel",
+	FirstMessageID             int          `json:"first_message_id"`              // 18,
+	HistoryPublicToSubscribers bool         `json:"history_public_to_subscribers"` // false,
+	InviteOnly                 bool         `json:"invite_only"`                   // true,
+	IsAnnouncementOnly         bool         `json:"is_announcement_only"`          // false,
+	IsArchived                 bool         `json:"is_archived"`                   // false,
+	IsDefault                  bool         `json:"is_default"`                    // false,
+	IsRecentlyActive           bool         `json:"is_recently_active"`            // true,
+	IsWebPublic                bool         `json:"is_web_public"`                 // false,
+	MessageRetentionDays       int          `json:"message_retention_days"`        // null,
+	Name                       string       `json:"name"`                          // "management",
+	RenderedDescription        string       `json:"rendered_description"`          // "<p>A private channel</p>",
+	StreamID                   int          `json:"stream_id"`                     // 2,
+	StreamPostPolicy           int          `json:"stream_post_policy"`            // 1,
+	StreamWeeklyTraffic        int          `json:"stream_weekly_traffic"`         // null
 }
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -19,15 +18,7 @@ type getAllChannelsResponseData struct {
 }
 
 func (g *GetAllChannelsResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getAllChannelsResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getAllChannelsResponseData)
 }
 
 // GetAllChannels Get all channels that the user has access to.
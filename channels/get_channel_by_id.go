@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -19,15 +18,7 @@ type getChannelByIDResponseData struct {
 }
 
 func (g *GetChannelByIDResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getChannelByIDResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getChannelByIDResponseData)
 }
 
 // GetChannelByID Fetch details for the channel with the ID.
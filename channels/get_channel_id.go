@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -18,15 +17,7 @@ type getChannelIDResponseData struct {
 }
 
 func (g *GetChannelIDResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getChannelIDResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getChannelIDResponseData)
 }
 
 // GetChannelID Get the unique ID of a given channel.
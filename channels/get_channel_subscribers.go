@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -19,15 +18,7 @@ type getChannelSubscribersResponseData struct {
 }
 
 func (g *GetChannelSubscribersResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getChannelSubscribersResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getChannelSubscribersResponseData)
 }
 
 func (svc *Service) GetChannelSubscribers(ctx context.Context, streamID int) (*GetChannelSubscribersResponse, error) {
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -32,15 +31,7 @@ type getSubscribedChannelsResponseData struct {
 }
 
 func (g *GetSubscribedChannelsResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getSubscribedChannelsResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getSubscribedChannelsResponseData)
 }
 
 type getSubscribedChannelsOptions struct {
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -19,15 +18,7 @@ type getSubscriptionStatusResponseData struct {
 }
 
 func (g *GetSubscriptionStatusResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getSubscriptionStatusResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getSubscriptionStatusResponseData)
 }
 
 // GetSubscriptionStatus Check whether a user is subscribed to a channel.
@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// GroupSetting tells the users allowed by a permission setting: a user group,
+// or since Zulip 10 the users and groups of an anonymous group.
+type GroupSetting struct {
+	// IsAnonymous is true when the setting lists its members instead of
+	// naming a group.
+	IsAnonymous     bool
+	GroupID         int
+	DirectMembers   []int
+	DirectSubgroups []int
+}
+
+type anonymousGroup struct {
+	DirectMembers   []int `json:"direct_members"`
+	DirectSubgroups []int `json:"direct_subgroups"`
+}
+
+func (gs *GroupSetting) UnmarshalJSON(b []byte) error {
+	var groupID int
+	if err := json.Unmarshal(b, &groupID); err == nil {
+		*gs = GroupSetting{GroupID: groupID}
+
+		return nil
+	}
+
+	var anonymous anonymousGroup
+	if err := json.Unmarshal(b, &anonymous); err == nil {
+		*gs = GroupSetting{
+			IsAnonymous:     true,
+			DirectMembers:   anonymous.DirectMembers,
+			DirectSubgroups: anonymous.DirectSubgroups,
+		}
+
+		return nil
+	}
+
+	return errors.New("failed to unmarshal GroupSetting")
+}
+
+// MarshalJSON encodes the setting in the shape it was received.
+func (gs GroupSetting) MarshalJSON() ([]byte, error) {
+	if gs.IsAnonymous {
+		return json.Marshal(anonymousGroup{DirectMembers: gs.DirectMembers, DirectSubgroups: gs.DirectSubgroups})
+	}
+
+	return json.Marshal(gs.GroupID)
+}
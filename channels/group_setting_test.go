@@ -0,0 +1,39 @@
+package channels_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/channels"
+)
+
+func TestGroupSetting(t *testing.T) {
+	info := channels.ChannelInfo{}
+	err := json.Unmarshal([]byte(`{
+    "can_add_subscribers_group": {"direct_members": [10], "direct_subgroups": [11]},
+    "can_remove_subscribers_group": 2,
+    "name": "private"
+}`), &info)
+	require.NoError(t, err)
+
+	// the group settings of Zulip 10 are either a group or its members
+	assert.Equal(t, channels.GroupSetting{GroupID: 2}, info.CanRemoveSubscribersGroup)
+	assert.Equal(t, channels.GroupSetting{
+		IsAnonymous:     true,
+		DirectMembers:   []int{10},
+		DirectSubgroups: []int{11},
+	}, info.CanAddSubscribersGroup)
+
+	b, err := json.Marshal(info.CanAddSubscribersGroup)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"direct_members": [10], "direct_subgroups": [11]}`, string(b))
+
+	b, err = json.Marshal(info.CanRemoveSubscribersGroup)
+	require.NoError(t, err)
+	assert.JSONEq(t, `2`, string(b))
+
+	v := channels.GroupSetting{}
+	require.EqualError(t, json.Unmarshal([]byte(`"admins"`), &v), "failed to unmarshal GroupSetting")
+}
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -22,15 +21,7 @@ type subscribeToChannelResponseData struct {
 }
 
 func (s *SubscribeToChannelResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &s.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &s.subscribeToChannelResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &s.APIResponseBase, &s.subscribeToChannelResponseData)
 }
 
 type subscribeToChannelOptions struct{}
@@ -52,13 +43,8 @@ func (svc *Service) SubscribeToChannel(ctx context.Context, list []SubscribeTo,
 		path   = "/api/v1/users/me/subscriptions"
 	)
 
-	channelJSONList, err := json.Marshal(list)
-	if err != nil {
-		return nil, err
-	}
-
 	msg := map[string]any{
-		"subscriptions": string(channelJSONList),
+		"subscriptions": list,
 	}
 
 	opts := subscribeToChannelOptions{}
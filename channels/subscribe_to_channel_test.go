@@ -28,7 +28,7 @@ func TestSubscribeToChannel(t *testing.T) {
 	channelSvc := channels.NewService(client)
 
 	msg := map[string]any{
-		"subscriptions": `[{"name":"testing-help","description":"test channel"}]`,
+		"subscriptions": []channels.SubscribeTo{{Name: "testing-help", Description: "test channel"}},
 	}
 
 	resp, err := channelSvc.SubscribeToChannel(context.Background(),
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -22,15 +21,7 @@ type unsubscribeFromChannelResponseData struct {
 }
 
 func (s *UnsubscribeFromChannelResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &s.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &s.unsubscribeFromChannelResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &s.APIResponseBase, &s.unsubscribeFromChannelResponseData)
 }
 
 type unsubscribeFromChannelOptions struct {
@@ -61,13 +52,8 @@ func (svc *Service) UnsubscribeFromChannel(ctx context.Context, subscriptions []
 		path   = "/api/v1/users/me/subscriptions"
 	)
 
-	channelJSONList, err := json.Marshal(subscriptions)
-	if err != nil {
-		return nil, err
-	}
-
 	msg := map[string]any{
-		"subscriptions": string(channelJSONList),
+		"subscriptions": subscriptions,
 	}
 
 	opts := unsubscribeFromChannelOptions{}
@@ -76,8 +62,7 @@ func (svc *Service) UnsubscribeFromChannel(ctx context.Context, subscriptions []
 	}
 
 	if opts.principals.value != nil {
-		jsonVal, _ := json.Marshal(opts.principals.value)
-		msg[opts.principals.fieldName] = string(jsonVal)
+		msg[opts.principals.fieldName] = opts.principals.value
 	}
 
 	resp := UnsubscribeFromChannelResponse{}
@@ -27,7 +27,7 @@ func TestUnsubscribeFromChannel(t *testing.T) {
 
 	// validate the parameters sent are correct
 	assert.Equal(t, map[string]any{
-		"subscriptions": "[\"testing-help\"]",
-		"principals":    "[1,2]",
+		"subscriptions": []string{"testing-help"},
+		"principals":    []int{1, 2},
 	}, client.(*mockClient).paramsSent)
 }
@@ -1,11 +1,60 @@
 package zulip
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables read by CredentialsFromEnv, as the Python zulip
+// library does.
+const (
+	EnvSite   = "ZULIP_SITE"
+	EnvEmail  = "ZULIP_EMAIL"
+	EnvAPIKey = "ZULIP_API_KEY"
+	// EnvConfig is the path of a zuliprc file.
+	EnvConfig = "ZULIP_CONFIG"
+)
+
+// DefaultZuliprcSection is the section of the zuliprc files holding the
+// credentials.
+const DefaultZuliprcSection = "api"
+
+// ErrCredentialsNotFound is returned by the providers finding no
+// credentials, so ChainCredentials tries the next one.
+var ErrCredentialsNotFound = errors.New("credentials not found")
 
 type credentials struct {
 	Email  string
 	APIKey string
 	Site   string
+	// Source describes where the credentials were found, like "env" or
+	// "zuliprc:/home/bot/.zuliprc".
+	Source string
+	// TLS holds the TLS settings of zuliprc files, used by NewClient to
+	// build the HTTP client.
+	TLS TLSSettings
+}
+
+// missing returns the names of the empty fields.
+func (c *credentials) missing() []string {
+	var missing []string
+
+	if c.Site == "" {
+		missing = append(missing, "site")
+	}
+
+	if c.Email == "" {
+		missing = append(missing, "email")
+	}
+
+	if c.APIKey == "" {
+		missing = append(missing, "key")
+	}
+
+	return missing
 }
 
 type CredentialsProvider func() (*credentials, error)
@@ -16,6 +65,7 @@ func Credentials(site, email, apiKey string) CredentialsProvider {
 			Email:  email,
 			APIKey: apiKey,
 			Site:   site,
+			Source: "static",
 		}, nil
 	}
 }
@@ -36,6 +86,120 @@ func CredentialsFromZuliprc(filePath string, section string) CredentialsProvider
 			Email:  apiSection.Email,
 			APIKey: apiSection.APIKey,
 			Site:   apiSection.Site,
+			Source: "zuliprc:" + filePath,
+			TLS:    apiSection.TLSSettings(),
 		}, nil
 	}
 }
+
+// DefaultZuliprcPath returns the default location of the zuliprc file,
+// ~/.zuliprc.
+func DefaultZuliprcPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".zuliprc"), nil
+}
+
+// CredentialsFromDefaultZuliprc reads the credentials from the api section
+// of ~/.zuliprc. It returns ErrCredentialsNotFound if the file does not
+// exist.
+func CredentialsFromDefaultZuliprc() CredentialsProvider {
+	return func() (*credentials, error) {
+		path, err := DefaultZuliprcPath()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCredentialsNotFound, err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCredentialsNotFound, err)
+		}
+
+		return CredentialsFromZuliprc(path, DefaultZuliprcSection)()
+	}
+}
+
+// CredentialsFromEnv reads the credentials from the ZULIP_SITE, ZULIP_EMAIL
+// and ZULIP_API_KEY environment variables. When ZULIP_CONFIG is set, the
+// credentials are read from the api section of the zuliprc file it points
+// to, and the variables override its values.
+//
+// It returns ErrCredentialsNotFound if none of the variables is set.
+func CredentialsFromEnv() CredentialsProvider {
+	return func() (*credentials, error) {
+		creds := &credentials{Source: "env"}
+
+		if config := os.Getenv(EnvConfig); config != "" {
+			fromFile, err := CredentialsFromZuliprc(config, DefaultZuliprcSection)()
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", EnvConfig, err)
+			}
+
+			creds = fromFile
+			creds.Source = "env:" + fromFile.Source
+		}
+
+		overrides := map[string]*string{
+			EnvSite:   &creds.Site,
+			EnvEmail:  &creds.Email,
+			EnvAPIKey: &creds.APIKey,
+		}
+
+		found := creds.Source != "env"
+
+		for name, field := range overrides {
+			if v := os.Getenv(name); v != "" {
+				*field = v
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: none of %s, %s, %s or %s is set",
+				ErrCredentialsNotFound, EnvSite, EnvEmail, EnvAPIKey, EnvConfig)
+		}
+
+		if missing := creds.missing(); len(missing) > 0 {
+			return nil, fmt.Errorf("incomplete credentials from the environment, missing %s", strings.Join(missing, ", "))
+		}
+
+		return creds, nil
+	}
+}
+
+// ChainCredentials tries the providers in order and returns the credentials
+// of the first one succeeding with complete credentials. Their Source tells
+// which provider it was, see also Client.CredentialsSource.
+//
+// If no provider succeeds, the returned error matches ErrCredentialsNotFound
+// and holds the error of every provider.
+func ChainCredentials(providers ...CredentialsProvider) CredentialsProvider {
+	return func() (*credentials, error) {
+		var errs []error
+
+		for i, provider := range providers {
+			creds, err := provider()
+			if err == nil {
+				if missing := creds.missing(); len(missing) > 0 {
+					err = fmt.Errorf("incomplete credentials from %s, missing %s", creds.Source, strings.Join(missing, ", "))
+				}
+			}
+
+			if err == nil {
+				return creds, nil
+			}
+
+			errs = append(errs, fmt.Errorf("provider %d: %w", i, err))
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrCredentialsNotFound, errors.Join(errs...))
+	}
+}
+
+// DefaultCredentials looks for the credentials in the environment, see
+// CredentialsFromEnv, then in ~/.zuliprc.
+func DefaultCredentials() CredentialsProvider {
+	return ChainCredentials(CredentialsFromEnv(), CredentialsFromDefaultZuliprc())
+}
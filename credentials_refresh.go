@@ -0,0 +1,147 @@
+package zulip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clientAuth holds the credentials sent with the requests. It is never
+// modified, refreshing the credentials swaps it for a new one so the
+// requests in flight keep a consistent email and API key.
+type clientAuth struct {
+	email       string
+	apiKey      string
+	refreshedAt time.Time
+}
+
+// refreshPolicy decides when the credentials are asked again to the
+// CredentialsProvider.
+type refreshPolicy struct {
+	onUnauthorized bool
+	interval       time.Duration
+}
+
+type RefreshOption func(*refreshPolicy) error
+
+// RefreshEvery also refreshes the credentials when they are older than the
+// interval. It is checked before sending each request, no goroutine runs in
+// the background.
+func RefreshEvery(interval time.Duration) RefreshOption {
+	return func(p *refreshPolicy) error {
+		if interval <= 0 {
+			return errors.New("refresh interval must be positive")
+		}
+
+		p.interval = interval
+
+		return nil
+	}
+}
+
+// RefreshOnlyScheduled does not refresh the credentials on unauthorized
+// responses, only every RefreshEvery interval.
+func RefreshOnlyScheduled() RefreshOption {
+	return func(p *refreshPolicy) error {
+		p.onUnauthorized = false
+		return nil
+	}
+}
+
+// WithCredentialsRefresh makes the client call its CredentialsProvider again
+// to pick up rotated API keys, instead of only once in NewClient.
+//
+// By default the credentials are refreshed when a request gets a 401
+// response, UNAUTHORIZED or INVALID_API_KEY, and the request is sent once
+// again with the new credentials. Requests with a file that cannot be
+// rewound are not sent again. Only the email and API key are refreshed, the
+// site of the client does not change.
+func WithCredentialsRefresh(options ...RefreshOption) ClientOption {
+	return func(o *clientOptions) error {
+		p := refreshPolicy{onUnauthorized: true}
+
+		for _, opt := range options {
+			if err := opt(&p); err != nil {
+				return err
+			}
+		}
+
+		if !p.onUnauthorized && p.interval == 0 {
+			return errors.New("credentials refresh needs RefreshEvery when not refreshing on unauthorized responses")
+		}
+
+		o.refreshPolicy = &p
+
+		return nil
+	}
+}
+
+// RefreshCredentials calls the CredentialsProvider of the client again and
+// uses the new credentials for the next requests, e.g. right after
+// regenerating the API key.
+func (c *Client) RefreshCredentials(ctx context.Context) error {
+	_, err := c.refreshCredentials(ctx, c.logger, nil)
+	return err
+}
+
+// currentAuth returns the credentials to send, refreshed first if they are
+// older than the refresh interval. A failed scheduled refresh keeps the
+// current credentials, they may still be valid.
+func (c *Client) currentAuth(ctx context.Context, reqLog *slog.Logger) *clientAuth {
+	auth := c.auth.Load()
+
+	if c.refreshPolicy == nil || c.refreshPolicy.interval == 0 || time.Since(auth.refreshedAt) < c.refreshPolicy.interval {
+		return auth
+	}
+
+	refreshed, err := c.refreshCredentials(ctx, reqLog, auth)
+	if err != nil {
+		reqLog.WarnContext(ctx, "Scheduled credentials refresh failed", slog.Any("error", err))
+		return auth
+	}
+
+	return refreshed
+}
+
+// refreshCredentials replaces the credentials, unless they are no longer
+// the stale ones, refreshed meanwhile by another request.
+func (c *Client) refreshCredentials(ctx context.Context, reqLog *slog.Logger, stale *clientAuth) (*clientAuth, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if current := c.auth.Load(); stale != nil && current != stale {
+		return current, nil
+	}
+
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("refreshing credentials: %w", err)
+	}
+
+	if missing := creds.missing(); len(missing) > 0 {
+		return nil, fmt.Errorf("refreshing credentials: incomplete credentials from %s, missing %s", creds.Source, strings.Join(missing, ", "))
+	}
+
+	auth := &clientAuth{email: creds.Email, apiKey: creds.APIKey, refreshedAt: time.Now()}
+	c.auth.Store(auth)
+
+	reqLog.InfoContext(ctx, "Credentials refreshed",
+		slog.String("email", auth.email),
+		slog.String("credentials_source", creds.Source))
+
+	return auth, nil
+}
+
+// refreshOnUnauthorized reports whether the outcome of a request calls for
+// refreshing the credentials and sending it again.
+func (c *Client) refreshOnUnauthorized(resp *Response, err error) bool {
+	if c.refreshPolicy == nil || !c.refreshPolicy.onUnauthorized {
+		return false
+	}
+
+	return resp.HTTPCode == http.StatusUnauthorized || errors.Is(err, ErrUnauthorized)
+}
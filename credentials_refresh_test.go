@@ -0,0 +1,259 @@
+package zulip_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/zuliptest"
+)
+
+// rotatingCredentials rotates the API key of a zuliprc file, counting the
+// calls to its provider.
+type rotatingCredentials struct {
+	t     *testing.T
+	path  string
+	site  string
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func newRotatingCredentials(t *testing.T, srv *zuliptest.Server) *rotatingCredentials {
+	t.Helper()
+
+	r := &rotatingCredentials{t: t, path: filepath.Join(t.TempDir(), "zuliprc"), site: srv.URL}
+	r.set(zuliptest.DefaultUserAPIKey, nil)
+
+	return r
+}
+
+// set writes the API key to the zuliprc file, err makes the provider fail.
+func (r *rotatingCredentials) set(apiKey string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+	require.NoError(r.t, zulip.SetZuliprcSection(r.path, "api", zulip.SectionData{
+		Email:  zuliptest.DefaultUserEmail,
+		APIKey: apiKey,
+		Site:   r.site,
+	}))
+}
+
+func (r *rotatingCredentials) callCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls
+}
+
+func (r *rotatingCredentials) provider() zulip.CredentialsProvider {
+	return counted(zulip.CredentialsFromZuliprc(r.path, "api"), r)
+}
+
+// counted wraps the provider to count its calls and inject errors.
+func counted[T any](provider func() (T, error), r *rotatingCredentials) func() (T, error) {
+	return func() (T, error) {
+		r.mu.Lock()
+		r.calls++
+		err := r.err
+		r.mu.Unlock()
+
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+
+		return provider()
+	}
+}
+
+func getMe(client *zulip.Client) (*zulip.APIResponseBase, error) {
+	var resp zulip.APIResponseBase
+	err := client.DoRequest(context.Background(), http.MethodGet, "/api/v1/users/me", nil, &resp)
+
+	return &resp, err
+}
+
+func TestCredentialsRefreshOnUnauthorized(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider(), zulip.WithCredentialsRefresh(), zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	resp, err := getMe(client)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	newKey, ok := srv.RegenerateAPIKey(zuliptest.DefaultUserEmail)
+	require.True(t, ok)
+	creds.set(newKey, nil)
+	srv.ResetRequests()
+
+	resp, err = getMe(client)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, 2, creds.callCount())
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/users/me"), 2)
+
+	// the new key is used from now on
+	srv.ResetRequests()
+
+	_, err = getMe(client)
+	require.NoError(t, err)
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/users/me"), 1)
+	assert.Equal(t, 2, creds.callCount())
+}
+
+func TestCredentialsRefreshDisabled(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider())
+	require.NoError(t, err)
+
+	newKey, _ := srv.RegenerateAPIKey(zuliptest.DefaultUserEmail)
+	creds.set(newKey, nil)
+
+	resp, err := getMe(client)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.HTTPCode())
+	assert.Equal(t, 1, creds.callCount())
+}
+
+func TestCredentialsRefreshFailure(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider(), zulip.WithCredentialsRefresh(), zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	srv.RegenerateAPIKey(zuliptest.DefaultUserEmail)
+	creds.set("", errors.New("vault unavailable"))
+
+	_, err = getMe(client)
+	require.ErrorIs(t, err, zulip.ErrUnauthorized)
+	assert.Equal(t, 2, creds.callCount())
+
+	// a refreshed but still outdated key is not retried forever
+	creds.set("outdated", nil)
+
+	_, err = getMe(client)
+	require.ErrorIs(t, err, zulip.ErrUnauthorized)
+	assert.Equal(t, 3, creds.callCount())
+}
+
+func TestCredentialsRefreshConcurrentRequests(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider(), zulip.WithCredentialsRefresh(), zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	newKey, _ := srv.RegenerateAPIKey(zuliptest.DefaultUserEmail)
+	creds.set(newKey, nil)
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, errs[i] = getMe(client)
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// the requests failing with the same stale key refresh it only once
+	assert.Equal(t, 2, creds.callCount())
+}
+
+func TestCredentialsRefreshEvery(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider(),
+		zulip.WithCredentialsRefresh(zulip.RefreshEvery(50*time.Millisecond), zulip.RefreshOnlyScheduled()))
+	require.NoError(t, err)
+
+	_, err = getMe(client)
+	require.NoError(t, err)
+	assert.Equal(t, 1, creds.callCount())
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = getMe(client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, creds.callCount())
+
+	// not refreshed on unauthorized responses
+	srv.RegenerateAPIKey(zuliptest.DefaultUserEmail)
+
+	resp, err := getMe(client)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.HTTPCode())
+	assert.Equal(t, 2, creds.callCount())
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	creds := newRotatingCredentials(t, srv)
+
+	client, err := zulip.NewClient(creds.provider())
+	require.NoError(t, err)
+
+	var regenerated zulip.APIResponseBase
+	require.NoError(t, client.DoRequest(context.Background(), http.MethodPost, "/api/v1/users/me/api_key/regenerate", nil, &regenerated))
+
+	newKey, err := regenerated.FieldValue("api_key")
+	require.NoError(t, err)
+	creds.set(newKey.(string), nil)
+
+	require.NoError(t, client.RefreshCredentials(context.Background()))
+
+	resp, err := getMe(client)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	creds.set("", nil)
+	require.ErrorContains(t, client.RefreshCredentials(context.Background()), "missing key")
+}
+
+func TestWithCredentialsRefreshOptions(t *testing.T) {
+	creds := zulip.Credentials("https://localhost", "bot@localhost", "key")
+
+	_, err := zulip.NewClient(creds, zulip.WithCredentialsRefresh(zulip.RefreshOnlyScheduled()))
+	require.Error(t, err)
+
+	_, err = zulip.NewClient(creds, zulip.WithCredentialsRefresh(zulip.RefreshEvery(0)))
+	require.Error(t, err)
+}
@@ -1,7 +1,9 @@
 package zulip_test
 
 import (
+	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,3 +46,117 @@ site=https://localhost
 	assert.Equal(t, "apikey", c.APIKey)
 	assert.Equal(t, "https://localhost", c.Site)
 }
+
+func writeZuliprc(t *testing.T, dir, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, ".zuliprc")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func clearZulipEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{zulip.EnvSite, zulip.EnvEmail, zulip.EnvAPIKey, zulip.EnvConfig} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	clearZulipEnv(t)
+
+	_, err := zulip.CredentialsFromEnv()()
+	require.ErrorIs(t, err, zulip.ErrCredentialsNotFound)
+
+	t.Setenv(zulip.EnvSite, "https://env.zulip.test")
+	t.Setenv(zulip.EnvEmail, "env@zulip.test")
+
+	_, err = zulip.CredentialsFromEnv()()
+	require.Error(t, err)
+	require.NotErrorIs(t, err, zulip.ErrCredentialsNotFound)
+	assert.Contains(t, err.Error(), "missing key")
+
+	t.Setenv(zulip.EnvAPIKey, "envkey")
+
+	c, err := zulip.CredentialsFromEnv()()
+	require.NoError(t, err)
+	assert.Equal(t, "https://env.zulip.test", c.Site)
+	assert.Equal(t, "env@zulip.test", c.Email)
+	assert.Equal(t, "envkey", c.APIKey)
+	assert.Equal(t, "env", c.Source)
+}
+
+func TestCredentialsFromEnvConfig(t *testing.T) {
+	clearZulipEnv(t)
+
+	path := writeZuliprc(t, t.TempDir(), `[api]
+email=file@zulip.test
+key=filekey
+site=https://file.zulip.test
+`)
+
+	t.Setenv(zulip.EnvConfig, path)
+	// the variables override the file values
+	t.Setenv(zulip.EnvAPIKey, "envkey")
+
+	c, err := zulip.CredentialsFromEnv()()
+	require.NoError(t, err)
+	assert.Equal(t, "https://file.zulip.test", c.Site)
+	assert.Equal(t, "file@zulip.test", c.Email)
+	assert.Equal(t, "envkey", c.APIKey)
+	assert.Equal(t, "env:zuliprc:"+path, c.Source)
+
+	t.Setenv(zulip.EnvConfig, filepath.Join(t.TempDir(), "missing"))
+
+	_, err = zulip.CredentialsFromEnv()()
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCredentialsFromDefaultZuliprc(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	_, err := zulip.CredentialsFromDefaultZuliprc()()
+	require.ErrorIs(t, err, zulip.ErrCredentialsNotFound)
+
+	path := writeZuliprc(t, home, `[api]
+email=home@zulip.test
+key=homekey
+site=https://home.zulip.test
+`)
+
+	c, err := zulip.CredentialsFromDefaultZuliprc()()
+	require.NoError(t, err)
+	assert.Equal(t, "home@zulip.test", c.Email)
+	assert.Equal(t, "zuliprc:"+path, c.Source)
+}
+
+func TestChainCredentials(t *testing.T) {
+	clearZulipEnv(t)
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := zulip.DefaultCredentials()()
+	require.ErrorIs(t, err, zulip.ErrCredentialsNotFound)
+
+	incomplete := zulip.Credentials("https://zulip.test", "", "")
+	complete := zulip.Credentials("https://zulip.test", "bot@zulip.test", "key")
+
+	c, err := zulip.ChainCredentials(zulip.CredentialsFromEnv(), incomplete, complete)()
+	require.NoError(t, err)
+	assert.Equal(t, "bot@zulip.test", c.Email)
+	assert.Equal(t, "static", c.Source)
+
+	_, err = zulip.ChainCredentials(zulip.CredentialsFromEnv(), incomplete)()
+	require.ErrorIs(t, err, zulip.ErrCredentialsNotFound)
+	assert.Contains(t, err.Error(), "missing email, key")
+
+	t.Setenv(zulip.EnvSite, "https://env.zulip.test")
+	t.Setenv(zulip.EnvEmail, "env@zulip.test")
+	t.Setenv(zulip.EnvAPIKey, "envkey")
+
+	client, err := zulip.NewClient(zulip.DefaultCredentials())
+	require.NoError(t, err)
+	assert.Equal(t, "env", client.CredentialsSource())
+}
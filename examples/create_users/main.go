@@ -24,10 +24,14 @@ func main() {
 		userEmail    string
 		userPassword string
 		userName     string
+		zuliprcPath  string
+		insecure     bool
 	)
 	flag.StringVar(&userEmail, "email", "", "email of the user to create")
 	flag.StringVar(&userPassword, "password", "", "password of the user to create")
 	flag.StringVar(&userName, "name", "", "name of the user to create")
+	flag.StringVar(&zuliprcPath, "zuliprc", "", "zuliprc file to save the credentials of the user to, in a section named after it")
+	flag.BoolVar(&insecure, "insecure", false, "disable the TLS certificate verification in the zuliprc file, for servers with self-signed certificates")
 	flag.Parse()
 
 	if userEmail == "" || userPassword == "" || userName == "" {
@@ -85,5 +89,20 @@ func main() {
 	fmt.Printf("\tEmail: %s\n", userEmail)
 	fmt.Printf("\tPassword: %s\n", userPassword)
 	fmt.Printf("\tAPI Key: %s\n", fetchAPIKeyResp.APIKey)
+
+	if zuliprcPath != "" {
+		if err := zulip.SetZuliprcSection(zuliprcPath, userName, zulip.SectionData{
+			Email:    userEmail,
+			APIKey:   fetchAPIKeyResp.APIKey,
+			Site:     site,
+			Insecure: insecure,
+		}); err != nil {
+			log.Printf("failed to save the credentials: %v\n", err)
+			return
+		}
+
+		fmt.Printf("\tSaved to: %s [%s]\n", zuliprcPath, userName)
+	}
+
 	fmt.Println("Done.")
 }
@@ -2,10 +2,8 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -26,15 +24,9 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	defer cancel()
 
-	insecureClient := http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
-	}
-
-	z, err := zulip.NewClient(zulip.CredentialsFromZuliprc("zuliprc", "api"), zulip.WithHTTPClient(&insecureClient))
+	// the zuliprc file sets insecure=true for the self-signed certificate
+	// of the local server
+	z, err := zulip.NewClient(zulip.CredentialsFromZuliprc("zuliprc", "api"))
 	if err != nil {
 		panic(err)
 	}
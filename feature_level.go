@@ -0,0 +1,221 @@
+package zulip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// Feature levels of the API changes the services adapt to. See
+// https://zulip.com/api/changelog.
+const (
+	// FeatureLevelDirectMessageType is the feature level of Zulip 7.0, which
+	// added "direct" as the type of direct messages, replacing "private".
+	FeatureLevelDirectMessageType = 174
+	// FeatureLevelDmNarrow is the feature level of Zulip 7.0 which renamed
+	// the pm-with and group-pm-with narrow operators to dm and dm-including,
+	// and is:private to is:dm.
+	FeatureLevelDmNarrow = 177
+	// FeatureLevelReadBySender is the feature level of Zulip 8.0, which added
+	// the read_by_sender parameter when sending messages.
+	FeatureLevelReadBySender = 236
+	// FeatureLevelChannelMessageType is the feature level of Zulip 9.0, which
+	// added "channel" as the type of channel messages, replacing "stream".
+	FeatureLevelChannelMessageType = 248
+	// FeatureLevelChannelNarrow is the feature level of Zulip 9.0 which
+	// renamed the stream and streams narrow operators to channel and
+	// channels.
+	FeatureLevelChannelNarrow = 250
+	// FeatureLevelMessageIDs is the feature level of Zulip 10.0, which added
+	// the message_ids parameter when getting messages.
+	FeatureLevelMessageIDs = 300
+)
+
+// ErrUnsupportedFeature matches the errors returned when a request needs a
+// newer server.
+var ErrUnsupportedFeature = errors.New("feature not supported by the server")
+
+// UnsupportedFeatureError is returned when a request uses a feature the
+// server does not support.
+type UnsupportedFeatureError struct {
+	// Feature describes the unsupported feature, like a parameter name.
+	Feature string
+	// RequiredLevel is the feature level introducing the feature.
+	RequiredLevel int
+	// ServerLevel is the feature level of the server.
+	ServerLevel int
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("zulip: %s requires feature level %d, the server has %d", e.Feature, e.RequiredLevel, e.ServerLevel)
+}
+
+// Is makes the error match ErrUnsupportedFeature.
+func (e *UnsupportedFeatureError) Is(target error) bool {
+	return target == ErrUnsupportedFeature
+}
+
+// FeatureLeveler is implemented by the clients knowing the feature level of
+// the server, like Client.
+type FeatureLeveler interface {
+	FeatureLevel(ctx context.Context) (int, error)
+}
+
+// WithFeatureLevel sets the feature level of the server instead of fetching
+// it from /server_settings when first needed.
+func WithFeatureLevel(level int) ClientOption {
+	return func(o *clientOptions) error {
+		if level < 0 {
+			return errors.New("feature level is negative")
+		}
+
+		o.featureLevel = &level
+
+		return nil
+	}
+}
+
+// FeatureLevel returns the zulip_feature_level of the server. It is fetched
+// from /server_settings on first use and cached, unless it was given with
+// WithFeatureLevel or learned from SetFeatureLevel. Concurrent callers share
+// the same request.
+func (c *Client) FeatureLevel(ctx context.Context) (int, error) {
+	if level, ok := c.CachedFeatureLevel(); ok {
+		return level, nil
+	}
+
+	v, err, _ := c.featureLevelGroup.Do("", func() (any, error) {
+		return c.fetchFeatureLevel(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(int), nil
+}
+
+// CachedFeatureLevel returns the feature level of the server if it is already
+// known, without fetching it.
+func (c *Client) CachedFeatureLevel() (int, bool) {
+	c.featureLevelMu.Lock()
+	defer c.featureLevelMu.Unlock()
+
+	if c.featureLevel == nil {
+		return 0, false
+	}
+
+	return *c.featureLevel, true
+}
+
+// fetchFeatureLevel gets the feature level from /server_settings and caches
+// it, unless another one was learned in the meantime.
+func (c *Client) fetchFeatureLevel(ctx context.Context) (int, error) {
+	var resp APIResponseBase
+	if err := c.DoRequest(ctx, http.MethodGet, "/api/v1/server_settings", nil, &resp); err != nil {
+		return 0, fmt.Errorf("fetching server feature level: %w", err)
+	}
+
+	if resp.IsError() {
+		return 0, fmt.Errorf("fetching server feature level: %s: %s", resp.Code(), resp.Msg())
+	}
+
+	// servers older than Zulip 3.0 do not report it
+	level := 0
+	if v, err := resp.FieldValue("zulip_feature_level"); err == nil {
+		if f, ok := v.(float64); ok {
+			level = int(f)
+		}
+	}
+
+	c.featureLevelMu.Lock()
+	defer c.featureLevelMu.Unlock()
+
+	if c.featureLevel != nil {
+		return *c.featureLevel, nil
+	}
+
+	c.featureLevel = &level
+
+	return level, nil
+}
+
+// SetFeatureLevel caches the feature level of the server, as returned when
+// registering an event queue.
+func (c *Client) SetFeatureLevel(level int) {
+	c.featureLevelMu.Lock()
+	defer c.featureLevelMu.Unlock()
+
+	c.featureLevel = &level
+}
+
+// LatestFeatureLevel is the feature level assumed for the clients not
+// implementing FeatureLeveler, like test doubles.
+const LatestFeatureLevel = math.MaxInt
+
+// ServerFeatureLevel returns the feature level of the server of the client,
+// LatestFeatureLevel if the client does not implement FeatureLeveler.
+func ServerFeatureLevel(ctx context.Context, client RESTClient) (int, error) {
+	leveler, ok := client.(FeatureLeveler)
+	if !ok {
+		return LatestFeatureLevel, nil
+	}
+
+	return leveler.FeatureLevel(ctx)
+}
+
+// AssumedFeatureLevel returns the feature level of the server of the client,
+// or LatestFeatureLevel when it can not be fetched: the requests are then sent
+// as to a recent server, which rejects by itself what it does not support.
+func AssumedFeatureLevel(ctx context.Context, client RESTClient) int {
+	level, err := ServerFeatureLevel(ctx, client)
+	if err != nil {
+		return LatestFeatureLevel
+	}
+
+	return level
+}
+
+// featureLevelCache is implemented by the clients caching the feature level
+// of the server, like Client.
+type featureLevelCache interface {
+	CachedFeatureLevel() (int, bool)
+}
+
+// KnownFeatureLevel returns the feature level of the server of the client if
+// it is already known, without fetching it. It is LatestFeatureLevel if the
+// client does not implement FeatureLeveler.
+func KnownFeatureLevel(client RESTClient) (int, bool) {
+	if cache, ok := client.(featureLevelCache); ok {
+		return cache.CachedFeatureLevel()
+	}
+
+	if _, ok := client.(FeatureLeveler); ok {
+		return 0, false
+	}
+
+	return LatestFeatureLevel, true
+}
+
+// SupportsFeature reports whether the server of the client has at least the
+// given feature level.
+func SupportsFeature(ctx context.Context, client RESTClient, level int) (bool, error) {
+	serverLevel, err := ServerFeatureLevel(ctx, client)
+	if err != nil {
+		return false, err
+	}
+
+	return serverLevel >= level, nil
+}
+
+// RequireFeature returns an *UnsupportedFeatureError when the server of the
+// client does not have the feature level of a feature. The server decides
+// when its feature level can not be fetched, see AssumedFeatureLevel.
+func RequireFeature(ctx context.Context, client RESTClient, feature string, level int) error {
+	if serverLevel := AssumedFeatureLevel(ctx, client); serverLevel < level {
+		return &UnsupportedFeatureError{Feature: feature, RequiredLevel: level, ServerLevel: serverLevel}
+	}
+
+	return nil
+}
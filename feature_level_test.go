@@ -0,0 +1,155 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestFeatureLevelFetchedOnce(t *testing.T) {
+	var requests atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "/api/v1/server_settings", r.URL.Path)
+
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "zulip_feature_level": 185, "zulip_version": "7.5"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	for range 3 {
+		level, err := client.FeatureLevel(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 185, level)
+	}
+
+	assert.Equal(t, int32(1), requests.Load())
+
+	supported, err := zulip.SupportsFeature(context.Background(), client, zulip.FeatureLevelDirectMessageType)
+	require.NoError(t, err)
+	assert.True(t, supported)
+
+	err = zulip.RequireFeature(context.Background(), client, "channel messages", zulip.FeatureLevelChannelMessageType)
+	require.ErrorIs(t, err, zulip.ErrUnsupportedFeature)
+
+	var featureErr *zulip.UnsupportedFeatureError
+	require.ErrorAs(t, err, &featureErr)
+	assert.Equal(t, zulip.FeatureLevelChannelMessageType, featureErr.RequiredLevel)
+	assert.Equal(t, 185, featureErr.ServerLevel)
+
+	// learned from a newer response, like registering an event queue
+	client.SetFeatureLevel(334)
+
+	level, err := client.FeatureLevel(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 334, level)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestFeatureLevelConcurrent(t *testing.T) {
+	var requests atomic.Int32
+
+	release := make(chan struct{})
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "zulip_feature_level": 334}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for range 5 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// the level learned while it is fetched wins
+			level, err := client.FeatureLevel(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 300, level)
+		}()
+	}
+
+	// the level is not locked while it is fetched
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	_, known := client.CachedFeatureLevel()
+	assert.False(t, known)
+
+	client.SetFeatureLevel(300)
+
+	close(release)
+	wg.Wait()
+
+	level, known := client.CachedFeatureLevel()
+	assert.True(t, known)
+	assert.Equal(t, 300, level)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestFeatureLevelOldServer(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "zulip_version": "2.1.8"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	level, err := client.FeatureLevel(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, level)
+}
+
+func TestWithFeatureLevel(t *testing.T) {
+	client, err := zulip.NewClient(zulip.Credentials("https://zulip.invalid", "email@test", "apikey"),
+		zulip.WithFeatureLevel(248),
+	)
+	require.NoError(t, err)
+
+	// no request is sent
+	level, err := client.FeatureLevel(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 248, level)
+
+	_, err = zulip.NewClient(zulip.Credentials("https://zulip.invalid", "email@test", "apikey"),
+		zulip.WithFeatureLevel(-1),
+	)
+	require.Error(t, err)
+}
+
+func TestAssumedFeatureLevel(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"result": "error", "msg": "upstream unavailable", "code": "BAD_REQUEST"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	_, err = client.FeatureLevel(context.Background())
+	require.Error(t, err)
+
+	// the server decides when the feature level can not be fetched
+	assert.Equal(t, zulip.LatestFeatureLevel, zulip.AssumedFeatureLevel(context.Background(), client))
+	require.NoError(t, zulip.RequireFeature(context.Background(), client, "message_ids", zulip.FeatureLevelMessageIDs))
+}
@@ -0,0 +1,137 @@
+// Package redact hides the secrets of the requests and responses, shared by
+// the debug logs of the client and the cassettes.
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces the redacted values.
+const Redacted = "[REDACTED]"
+
+// Params are the request parameters and top level response fields redacted
+// by default.
+var Params = []string{"api_key", "password", "old_password", "new_password", "token"}
+
+// Headers are the headers redacted by default.
+var Headers = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Policy tells which parameters, response fields and headers are redacted.
+// Parameters and fields are matched case insensitively.
+type Policy struct {
+	// params are lower case, headers canonical
+	params  map[string]bool
+	headers map[string]bool
+}
+
+// NewPolicy creates a policy redacting the given parameters and headers.
+func NewPolicy(params, headers []string) *Policy {
+	p := &Policy{
+		params:  map[string]bool{},
+		headers: map[string]bool{},
+	}
+
+	p.AddParams(params...)
+	p.AddHeaders(headers...)
+
+	return p
+}
+
+// AddParams redacts request parameters and response fields.
+func (p *Policy) AddParams(names ...string) {
+	for _, name := range names {
+		p.params[strings.ToLower(name)] = true
+	}
+}
+
+// RemoveParams stops redacting request parameters and response fields.
+func (p *Policy) RemoveParams(names ...string) {
+	for _, name := range names {
+		delete(p.params, strings.ToLower(name))
+	}
+}
+
+// AddHeaders redacts headers.
+func (p *Policy) AddHeaders(names ...string) {
+	for _, name := range names {
+		p.headers[http.CanonicalHeaderKey(name)] = true
+	}
+}
+
+// RemoveHeaders stops redacting headers.
+func (p *Policy) RemoveHeaders(names ...string) {
+	for _, name := range names {
+		delete(p.headers, http.CanonicalHeaderKey(name))
+	}
+}
+
+// IsParam tells whether a request parameter or response field is redacted.
+func (p *Policy) IsParam(name string) bool {
+	return p.params[strings.ToLower(name)]
+}
+
+// IsHeader tells whether a header is redacted.
+func (p *Policy) IsHeader(name string) bool {
+	return p.headers[http.CanonicalHeaderKey(name)]
+}
+
+// Form returns a copy of values with the redacted parameters replaced.
+func (p *Policy) Form(values url.Values) url.Values {
+	redacted := make(url.Values, len(values))
+
+	for k, v := range values {
+		if p.IsParam(k) {
+			v = slices.Repeat([]string{Redacted}, len(v))
+		}
+
+		redacted[k] = v
+	}
+
+	return redacted
+}
+
+// Header returns a copy of header with the redacted headers replaced.
+func (p *Policy) Header(header http.Header) http.Header {
+	redacted := header.Clone()
+
+	for k, v := range redacted {
+		if p.IsHeader(k) {
+			redacted[k] = slices.Repeat([]string{Redacted}, len(v))
+		}
+	}
+
+	return redacted
+}
+
+// JSON redacts the top level fields of a JSON object. Other bodies, and the
+// ones without redacted fields, are returned as they are.
+func (p *Policy) JSON(body []byte) []byte {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return body
+	}
+
+	redacted := false
+
+	for k := range object {
+		if p.IsParam(k) {
+			object[k] = json.RawMessage(`"` + Redacted + `"`)
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return body
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return body
+	}
+
+	return data
+}
@@ -0,0 +1,49 @@
+package redact_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wakumaku/go-zulip/internal/redact"
+)
+
+func TestPolicy(t *testing.T) {
+	p := redact.NewPolicy(redact.Params, redact.Headers)
+	p.AddParams("Email")
+	p.RemoveParams("TOKEN")
+	p.AddHeaders("x-secret")
+	p.RemoveHeaders("cookie")
+
+	assert.True(t, p.IsParam("API_KEY"))
+	assert.True(t, p.IsParam("email"))
+	assert.False(t, p.IsParam("token"))
+	assert.True(t, p.IsHeader("authorization"))
+	assert.True(t, p.IsHeader("X-Secret"))
+	assert.False(t, p.IsHeader("Cookie"))
+
+	values := url.Values{"api_key": {"secret"}, "content": {"hello"}}
+	assert.Equal(t, url.Values{"api_key": {redact.Redacted}, "content": {"hello"}}, p.Form(values))
+	assert.Equal(t, "secret", values.Get("api_key"))
+
+	header := http.Header{"Authorization": {"Basic abc"}, "Cookie": {"a=b"}}
+	assert.Equal(t, http.Header{"Authorization": {redact.Redacted}, "Cookie": {"a=b"}}, p.Header(header))
+	assert.Equal(t, "Basic abc", header.Get("Authorization"))
+}
+
+func TestPolicyJSON(t *testing.T) {
+	p := redact.NewPolicy(redact.Params, redact.Headers)
+
+	assert.JSONEq(t, `{"result": "success", "api_key": "[REDACTED]", "token": "[REDACTED]"}`,
+		string(p.JSON([]byte(`{"result": "success", "api_key": "secret", "token": "secret"}`))))
+
+	// returned as they are
+	for _, body := range []string{
+		`{"result": "success", "msg": ""}`,
+		`[{"api_key": "nested arrays are not redacted"}]`,
+		`<html>Bad gateway</html>`,
+	} {
+		assert.Equal(t, body, string(p.JSON([]byte(body))))
+	}
+}
@@ -2,10 +2,7 @@ package invitations
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/wakumaku/go-zulip"
 )
@@ -20,15 +17,7 @@ type createReusableInvitationLinkData struct {
 }
 
 func (c *CreateReusableInvitationLinkResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &c.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &c.createReusableInvitationLinkData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &c.APIResponseBase, &c.createReusableInvitationLinkData)
 }
 
 type createReusableInvitationLinkOptions struct {
@@ -86,7 +75,7 @@ func (svc *Service) CreateReusableInvitationLink(ctx context.Context, options ..
 	}
 
 	if opts.StreamIds != nil {
-		msg["stream_ids"] = strings.ReplaceAll(fmt.Sprint(*opts.StreamIds), " ", ",")
+		msg["stream_ids"] = *opts.StreamIds
 	}
 
 	if opts.IncludeRealmDefaultSubscriptions != nil {
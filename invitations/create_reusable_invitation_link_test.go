@@ -25,6 +25,6 @@ func TestCreateReusableInvitationLink(t *testing.T) {
 
 	// validate the parameters sent are correct
 	assert.Equal(t, map[string]any{
-		"stream_ids": "[1,2]",
+		"stream_ids": []int{1, 2},
 	}, client.(*mockClient).paramsSent)
 }
@@ -0,0 +1,168 @@
+package zulip
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wakumaku/go-zulip/internal/redact"
+)
+
+// Redacted replaces the values of the redacted parameters, response fields
+// and headers in the logs.
+const Redacted = redact.Redacted
+
+// DefaultLogMaxBodySize is the number of bytes of the request data and
+// response bodies logged, the rest is truncated.
+const DefaultLogMaxBodySize = 4096
+
+// DefaultRedactedParams are the request parameters and top level response
+// fields never logged.
+var DefaultRedactedParams = slices.Clone(redact.Params)
+
+// DefaultRedactedHeaders are the headers never logged.
+var DefaultRedactedHeaders = slices.Clone(redact.Headers)
+
+// logPolicy decides what the client debug logs show of the requests and
+// responses.
+type logPolicy struct {
+	redact      *redact.Policy
+	maxBodySize int
+}
+
+type LogOption func(*logPolicy) error
+
+// LogRedactParams adds request parameters and response fields to
+// DefaultRedactedParams.
+func LogRedactParams(names ...string) LogOption {
+	return func(p *logPolicy) error {
+		p.redact.AddParams(names...)
+
+		return nil
+	}
+}
+
+// LogAllowParams logs the values of request parameters and response fields
+// of DefaultRedactedParams.
+func LogAllowParams(names ...string) LogOption {
+	return func(p *logPolicy) error {
+		p.redact.RemoveParams(names...)
+
+		return nil
+	}
+}
+
+// LogRedactHeaders adds headers to DefaultRedactedHeaders.
+func LogRedactHeaders(names ...string) LogOption {
+	return func(p *logPolicy) error {
+		p.redact.AddHeaders(names...)
+
+		return nil
+	}
+}
+
+// LogAllowHeaders logs the values of headers of DefaultRedactedHeaders.
+func LogAllowHeaders(names ...string) LogOption {
+	return func(p *logPolicy) error {
+		p.redact.RemoveHeaders(names...)
+
+		return nil
+	}
+}
+
+// LogMaxBodySize sets how many bytes of the request data and response
+// bodies are logged, 0 to only log their size.
+func LogMaxBodySize(size int) LogOption {
+	return func(p *logPolicy) error {
+		if size < 0 {
+			return errors.New("log max body size is negative")
+		}
+
+		p.maxBodySize = size
+
+		return nil
+	}
+}
+
+// WithLogging configures what the debug logs of the client show. Without
+// it, the values of DefaultRedactedParams and DefaultRedactedHeaders are
+// redacted and the bodies are truncated to DefaultLogMaxBodySize bytes.
+func WithLogging(options ...LogOption) ClientOption {
+	return func(o *clientOptions) error {
+		p := newLogPolicy()
+
+		for _, opt := range options {
+			if err := opt(p); err != nil {
+				return err
+			}
+		}
+
+		o.logPolicy = p
+
+		return nil
+	}
+}
+
+func newLogPolicy() *logPolicy {
+	return &logPolicy{
+		redact:      redact.NewPolicy(DefaultRedactedParams, DefaultRedactedHeaders),
+		maxBodySize: DefaultLogMaxBodySize,
+	}
+}
+
+// form returns the log value of request data. It is only computed when
+// the record is logged.
+func (p *logPolicy) form(values url.Values) slog.LogValuer {
+	return logValuer(func() slog.Value {
+		return slog.StringValue(p.truncate(p.redact.Form(values).Encode()))
+	})
+}
+
+// header returns the log value of headers, as a group.
+func (p *logPolicy) header(header http.Header) slog.LogValuer {
+	return logValuer(func() slog.Value {
+		redacted := p.redact.Header(header)
+		attrs := make([]slog.Attr, 0, len(redacted))
+
+		for _, k := range slices.Sorted(maps.Keys(redacted)) {
+			attrs = append(attrs, slog.String(k, strings.Join(redacted[k], ", ")))
+		}
+
+		return slog.GroupValue(attrs...)
+	})
+}
+
+// body returns the log value of a response body. The top level fields of
+// JSON objects are redacted like the request parameters.
+func (p *logPolicy) body(body []byte) slog.LogValuer {
+	return logValuer(func() slog.Value {
+		return slog.StringValue(p.truncate(string(p.redact.JSON(body))))
+	})
+}
+
+// truncate cuts s to the max body size, on a rune boundary.
+func (p *logPolicy) truncate(s string) string {
+	if len(s) <= p.maxBodySize {
+		return s
+	}
+
+	n := p.maxBodySize
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return fmt.Sprintf("%s...[%d bytes truncated]", s[:n], len(s)-n)
+}
+
+// logValuer is a log value computed only when the record is logged.
+type logValuer func() slog.Value
+
+func (f logValuer) LogValue() slog.Value {
+	return f()
+}
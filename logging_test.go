@@ -0,0 +1,127 @@
+package zulip_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/specialty"
+	"github.com/wakumaku/go-zulip/users"
+)
+
+// loggedClient returns a client logging at debug level to the returned
+// buffer, for a server answering body to every request.
+func loggedClient(t *testing.T, body string, options ...zulip.ClientOption) (*zulip.Client, *bytes.Buffer) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "session-secret"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Internal-Token", "internal-secret")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client, err := zulip.NewClient(zulip.Credentials(srv.URL, "bot@localhost", "bot-api-key"),
+		append([]zulip.ClientOption{zulip.WithLogger(logger)}, options...)...)
+	require.NoError(t, err)
+
+	return client, &logs
+}
+
+// logRecords decodes the JSON log records with the given message.
+func logRecords(t *testing.T, logs *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+func TestLoggingRedactsSecrets(t *testing.T) {
+	client, logs := loggedClient(t, `{"result":"success","msg":"","api_key":"fetched-secret","email":"bot@localhost"}`)
+
+	_, err := users.NewService(client).UpdateSettings(context.Background(),
+		users.SetPassword("old-secret", "new-secret"),
+		users.SetFullName("Bot"),
+	)
+	require.NoError(t, err)
+
+	_, err = specialty.NewService(client).FetchAPIKeyProduction(context.Background(), "bot@localhost", "password-secret")
+	require.NoError(t, err)
+
+	for _, secret := range []string{"old-secret", "new-secret", "password-secret", "fetched-secret", "session-secret", "bot-api-key"} {
+		assert.NotContains(t, logs.String(), secret)
+	}
+
+	sent := logRecords(t, logs, "Sending request")
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent[0]["data"], "full_name=Bot")
+	assert.Contains(t, sent[0]["data"], "old_password=%5BREDACTED%5D")
+	assert.Contains(t, sent[1]["data"], "username=bot%40localhost")
+
+	received := logRecords(t, logs, "Received response")
+	require.Len(t, received, 2)
+
+	headers, ok := received[1]["headers"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, zulip.Redacted, headers["Set-Cookie"])
+	assert.Equal(t, "internal-secret", headers["X-Internal-Token"])
+	assert.Contains(t, received[1]["body"], `"email":"bot@localhost"`)
+	assert.Contains(t, received[1]["body"], `"api_key":"[REDACTED]"`)
+}
+
+func TestLoggingOptions(t *testing.T) {
+	client, logs := loggedClient(t, `{"result":"success","msg":"","api_key":"fetched-secret","note":"`+strings.Repeat("é", 20)+`"}`,
+		zulip.WithLogging(
+			zulip.LogRedactParams("Topic"),
+			zulip.LogAllowParams("api_key"),
+			zulip.LogRedactHeaders("x-internal-token"),
+			zulip.LogAllowHeaders("Set-Cookie"),
+			zulip.LogMaxBodySize(70),
+		))
+
+	var resp zulip.APIResponseBase
+	require.NoError(t, client.DoRequest(context.Background(), http.MethodPost, "/api/v1/messages",
+		map[string]any{"topic": "secret plans", "content": "hello"}, &resp))
+
+	assert.NotContains(t, logs.String(), "secret plans")
+	assert.NotContains(t, logs.String(), "internal-secret")
+	assert.Contains(t, logs.String(), "session-secret")
+
+	received := logRecords(t, logs, "Received response")
+	require.Len(t, received, 1)
+
+	body, ok := received[0]["body"].(string)
+	require.True(t, ok)
+	assert.Contains(t, body, "fetched-secret")
+	assert.Contains(t, body, "bytes truncated]")
+	// cut on a rune boundary
+	assert.True(t, utf8.ValidString(body))
+
+	_, err := zulip.NewClient(zulip.Credentials("https://localhost", "bot@localhost", "key"),
+		zulip.WithLogging(zulip.LogMaxBodySize(-1)))
+	require.Error(t, err)
+}
@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -132,15 +131,7 @@ type editMessageResponseData struct {
 }
 
 func (e *EditMessageResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &e.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &e.editMessageResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &e.APIResponseBase, &e.editMessageResponseData)
 }
 
 func (svc *Service) EditMessage(ctx context.Context, id int, options ...EditMessageOption) (*EditMessageResponse, error) {
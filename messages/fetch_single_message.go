@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -20,15 +19,7 @@ type fetchSingleMessageResponseData struct {
 }
 
 func (f *FetchSingleMessageResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &f.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &f.fetchSingleMessageResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &f.APIResponseBase, &f.fetchSingleMessageResponseData)
 }
 
 type fetchSingleMessageOptions struct {
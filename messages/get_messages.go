@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -26,15 +25,7 @@ type getMessagesResponseData struct {
 }
 
 func (g *GetMessagesResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getMessagesResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getMessagesResponseData)
 }
 
 type Message struct {
@@ -241,12 +232,12 @@ func (svc *Service) GetMessages(ctx context.Context, options ...GetMessageOption
 	}
 
 	if len(opts.narrow.value) > 0 {
-		narrowJSON, err := opts.narrow.value.MarshalJSON()
-		if err != nil {
-			return nil, fmt.Errorf("marshaling narrow: %w", err)
+		filter := opts.narrow.value
+		if filter.DependsOnFeatureLevel() {
+			filter = filter.ForFeatureLevel(zulip.AssumedFeatureLevel(ctx, svc.client))
 		}
 
-		msg[opts.narrow.fieldName] = string(narrowJSON)
+		msg[opts.narrow.fieldName] = filter
 	}
 
 	if opts.clientGravatar.value != nil {
@@ -258,6 +249,10 @@ func (svc *Service) GetMessages(ctx context.Context, options ...GetMessageOption
 	}
 
 	if opts.messageIDs.value != nil {
+		if err := zulip.RequireFeature(ctx, svc.client, opts.messageIDs.fieldName, zulip.FeatureLevelMessageIDs); err != nil {
+			return nil, err
+		}
+
 		msg[opts.messageIDs.fieldName] = opts.messageIDs.value
 	}
 
@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -20,15 +19,7 @@ type getMessagesReadReceiptsData struct {
 }
 
 func (g *GetMessagesReadReceipts) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getMessagesReadReceiptsData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getMessagesReadReceiptsData)
 }
 
 func (svc *Service) GetMessagesReadReceipts(ctx context.Context, messageID int) (*GetMessagesReadReceipts, error) {
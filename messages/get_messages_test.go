@@ -2,12 +2,15 @@ package messages_test
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
 	"github.com/wakumaku/go-zulip/messages"
 	"github.com/wakumaku/go-zulip/narrow"
+	"github.com/wakumaku/go-zulip/zuliptest"
 )
 
 func TestGetMessages(t *testing.T) {
@@ -90,11 +93,13 @@ func TestGetMessages(t *testing.T) {
 	messagesSvc := messages.NewService(client)
 
 	msg := map[string]any{
-		"anchor":          "21",
-		"include_anchor":  true,
-		"num_before":      1,
-		"num_after":       3,
-		"narrow":          `[{"operator":"channel","operand":"Verona","negated":false},{"operator":"sender","operand":"iago@zulip.com","negated":false}]`,
+		"anchor":         "21",
+		"include_anchor": true,
+		"num_before":     1,
+		"num_after":      3,
+		"narrow": narrow.NewFilter().
+			Add(narrow.New(narrow.Channel, "Verona")).
+			Add(narrow.New(narrow.Sender, "iago@zulip.com")),
 		"client_gravatar": true,
 		"apply_markdown":  true,
 		"message_ids":     []int{16, 21},
@@ -136,3 +141,38 @@ func TestGetMessages(t *testing.T) {
 	assert.Equal(t, "/api/v1/messages", client.(*mockClient).path)
 	assert.Equal(t, msg, client.(*mockClient).paramsSent)
 }
+
+func TestGetMessagesNarrowFeatureLevel(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	srv.AddChannel(zuliptest.Channel{Name: "general"})
+
+	msgSvc := messages.NewService(client)
+
+	// the operators understood by every server do not need the feature level
+	_, err = msgSvc.GetMessages(context.Background(), messages.NarrowMessage(narrow.NewFilter().Add(narrow.IsStarred)))
+	require.NoError(t, err)
+	assert.Empty(t, srv.RequestsTo(http.MethodGet, "/api/v1/server_settings"))
+
+	// the current names are sent when the feature level can not be fetched
+	srv.InjectFault(zuliptest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/api/v1/server_settings",
+		StatusCode: http.StatusBadGateway,
+		Code:       zulip.CodeBadRequest,
+		Msg:        "upstream unavailable",
+		Times:      1,
+	})
+
+	_, err = msgSvc.GetMessages(context.Background(), messages.NarrowMessage(narrow.NewFilter().Add(narrow.New(narrow.Channel, "general"))))
+	require.NoError(t, err)
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/server_settings"), 1)
+
+	requests := srv.RequestsTo(http.MethodGet, "/api/v1/messages")
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[1].Form.Get("narrow"), `"operator":"channel"`)
+}
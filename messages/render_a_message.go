@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -18,15 +17,7 @@ type renderAMessageResponseData struct {
 }
 
 func (r *RenderAMessageResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &r.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &r.renderAMessageResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &r.APIResponseBase, &r.renderAMessageResponseData)
 }
 
 func (svc *Service) RenderAMessage(ctx context.Context, content string) (*RenderAMessageResponse, error) {
@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,7 +15,7 @@ import (
 const (
 	// In Zulip 9.0 (feature level 248), "channel" was added as an additional value for this parameter to request a channel message.
 	toChannel string = "channel"
-	// toStream  string = "stream"
+	toStream  string = "stream"
 	// Direct messages are also known as private messages.
 	toDirect string = "direct"
 	// ToPrivate
@@ -26,7 +25,7 @@ const (
 	// messages, clients are encouraged to use to the modern convention with
 	// servers that support it, because support for "private" will eventually
 	// be removed.
-	// toPrivate string = "private"
+	toPrivate string = "private"
 )
 
 type sendMessageOptions struct {
@@ -81,15 +80,7 @@ type sendMessageResponseData struct {
 }
 
 func (s *SendMessageResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &s.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &s.sendMessageResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &s.APIResponseBase, &s.sendMessageResponseData)
 }
 
 func (svc *Service) SendMessageToChannelTopic(ctx context.Context, channel recipient.Channel, topic string, content string, options ...SendMessageOption) (*SendMessageResponse, error) {
@@ -100,6 +91,10 @@ func (svc *Service) SendMessageToUsers(ctx context.Context, users recipient.Dire
 	return svc.SendMessage(ctx, users, content, options...)
 }
 
+// SendMessage sends a message to a channel or to users. The message type is
+// adapted to the feature level of the server when it is already known, or
+// else "stream" or "direct" are sent, accepted since Zulip 7.0: the feature
+// level is only fetched for the options depending on it.
 func (svc *Service) SendMessage(ctx context.Context, to recipient.Recipient, content string, options ...SendMessageOption) (*SendMessageResponse, error) {
 	const (
 		method = http.MethodPost
@@ -111,18 +106,23 @@ func (svc *Service) SendMessage(ctx context.Context, to recipient.Recipient, con
 		recipientType string
 	)
 
+	level, known := zulip.KnownFeatureLevel(svc.client)
+
 	switch t := to.(type) {
 	case recipient.Direct:
-		v, err := json.Marshal(t.To())
-		if err != nil {
-			return nil, err
-		}
-
-		toRecipient = string(v)
+		toRecipient = t.To()
 		recipientType = toDirect
+
+		if known && level < zulip.FeatureLevelDirectMessageType {
+			recipientType = toPrivate
+		}
 	case recipient.Channel:
 		toRecipient = to.To()
 		recipientType = toChannel
+
+		if !known || level < zulip.FeatureLevelChannelMessageType {
+			recipientType = toStream
+		}
 	default:
 		return nil, fmt.Errorf("unsupported recipient type: %T", to)
 	}
@@ -145,6 +145,10 @@ func (svc *Service) SendMessage(ctx context.Context, to recipient.Recipient, con
 	}
 
 	if opts.readBySender.value != nil {
+		if err := zulip.RequireFeature(ctx, svc.client, opts.readBySender.fieldName, zulip.FeatureLevelReadBySender); err != nil {
+			return nil, err
+		}
+
 		msg[opts.readBySender.fieldName] = *opts.readBySender.value
 	}
 
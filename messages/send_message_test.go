@@ -2,12 +2,15 @@ package messages_test
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
 	"github.com/wakumaku/go-zulip/messages"
 	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/zuliptest"
 )
 
 func TestSendMessageToChannel(t *testing.T) {
@@ -72,7 +75,7 @@ func TestSendMessageToUserIDs(t *testing.T) {
 	messagesSvc := messages.NewService(client)
 
 	msg := map[string]any{
-		"to":             "[1,2,3]",
+		"to":             recipient.ToUsers([]int{1, 2, 3}).To(),
 		"type":           "direct",
 		"content":        "the message",
 		"read_by_sender": true,
@@ -105,7 +108,7 @@ func TestSendMessageToUserName(t *testing.T) {
 	messagesSvc := messages.NewService(client)
 
 	msg := map[string]any{
-		"to":             "[\"iago\"]",
+		"to":             recipient.ToUser("iago").To(),
 		"type":           "direct",
 		"content":        "the message",
 		"read_by_sender": true,
@@ -138,7 +141,7 @@ func TestSendMessageToUserNames(t *testing.T) {
 	messagesSvc := messages.NewService(client)
 
 	msg := map[string]any{
-		"to":             "[\"iago\",\"cordelia\"]",
+		"to":             recipient.ToUsers([]string{"iago", "cordelia"}).To(),
 		"type":           "direct",
 		"content":        "the message",
 		"read_by_sender": true,
@@ -159,3 +162,80 @@ func TestSendMessageToUserNames(t *testing.T) {
 	assert.Equal(t, "/api/v1/messages", client.(*mockClient).path)
 	assert.Equal(t, msg, client.(*mockClient).paramsSent)
 }
+
+func TestSendMessageOldServer(t *testing.T) {
+	// Zulip 6.0
+	srv := zuliptest.NewServer(zuliptest.WithFeatureLevel(150))
+	defer srv.Close()
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	srv.AddChannel(zuliptest.Channel{Name: "general"})
+
+	messagesSvc := messages.NewService(client)
+
+	// the feature level is fetched for the options depending on it
+	_, err = messagesSvc.SendMessageToUsers(context.Background(), recipient.ToUser(zuliptest.DefaultUserEmail), "hello",
+		messages.ReadBySender(true))
+	require.ErrorIs(t, err, zulip.ErrUnsupportedFeature)
+	assert.Empty(t, srv.RequestsTo(http.MethodPost, "/api/v1/messages"))
+
+	_, err = messagesSvc.SendMessageToChannelTopic(context.Background(), recipient.ToChannel("general"), "topic", "hello")
+	require.NoError(t, err)
+
+	_, err = messagesSvc.SendMessageToUsers(context.Background(), recipient.ToUser(zuliptest.DefaultUserEmail), "hello")
+	require.NoError(t, err)
+
+	requests := srv.RequestsTo(http.MethodPost, "/api/v1/messages")
+	require.Len(t, requests, 2)
+	assert.Equal(t, "stream", requests[0].Form.Get("type"))
+	assert.Equal(t, "private", requests[1].Form.Get("type"))
+
+	// the feature level is fetched once
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/server_settings"), 1)
+}
+
+func TestSendMessageUnknownFeatureLevel(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	srv.AddChannel(zuliptest.Channel{Name: "general"})
+
+	messagesSvc := messages.NewService(client)
+
+	// the types accepted by every server are sent without fetching the
+	// feature level
+	_, err = messagesSvc.SendMessageToChannelTopic(context.Background(), recipient.ToChannel("general"), "topic", "hello")
+	require.NoError(t, err)
+
+	_, err = messagesSvc.SendMessageToUsers(context.Background(), recipient.ToUser(zuliptest.DefaultUserEmail), "hello")
+	require.NoError(t, err)
+
+	requests := srv.RequestsTo(http.MethodPost, "/api/v1/messages")
+	require.Len(t, requests, 2)
+	assert.Equal(t, "stream", requests[0].Form.Get("type"))
+	assert.Equal(t, "direct", requests[1].Form.Get("type"))
+	assert.Empty(t, srv.RequestsTo(http.MethodGet, "/api/v1/server_settings"))
+
+	// the option is sent as is when the feature level can not be fetched
+	srv.InjectFault(zuliptest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/api/v1/server_settings",
+		StatusCode: http.StatusBadGateway,
+		Code:       zulip.CodeBadRequest,
+		Msg:        "upstream unavailable",
+		Times:      1,
+	})
+
+	_, err = messagesSvc.SendMessageToUsers(context.Background(), recipient.ToUser(zuliptest.DefaultUserEmail), "hello",
+		messages.ReadBySender(true))
+	require.NoError(t, err)
+
+	requests = srv.RequestsTo(http.MethodPost, "/api/v1/messages")
+	require.Len(t, requests, 3)
+	assert.Equal(t, "true", requests[2].Form.Get("read_by_sender"))
+}
@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -18,15 +17,7 @@ type updatePersonalMessageFlagsData struct {
 }
 
 func (g *UpdatePersonalMessageFlags) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.updatePersonalMessageFlagsData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.updatePersonalMessageFlagsData)
 }
 
 type Operation string
@@ -57,13 +48,8 @@ func (svc *Service) UpdatePersonalMessageFlags(ctx context.Context, messageIDs [
 		path   = "/api/v1/messages/flags"
 	)
 
-	messageIDsJSON, err := json.Marshal(messageIDs)
-	if err != nil {
-		return nil, err
-	}
-
 	msg := map[string]any{
-		"messages": string(messageIDsJSON),
+		"messages": messageIDs,
 		"op":       op,
 		"flag":     flag,
 	}
@@ -2,7 +2,6 @@ package messages
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -24,15 +23,7 @@ type updatePersonalMessageFlagsNarrowData struct {
 }
 
 func (g *UpdatePersonalMessageFlagsNarrow) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.updatePersonalMessageFlagsNarrowData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.updatePersonalMessageFlagsNarrowData)
 }
 
 type updatePersonalMessageFlagsNarrowOptions struct {
@@ -66,16 +57,15 @@ func (svc *Service) UpdatePersonalMessageFlagsNarrow(
 		path   = "/api/v1/messages/flags/narrow"
 	)
 
-	narrowJSON, err := json.Marshal(narrow)
-	if err != nil {
-		return nil, err
+	if narrow.DependsOnFeatureLevel() {
+		narrow = narrow.ForFeatureLevel(zulip.AssumedFeatureLevel(ctx, svc.client))
 	}
 
 	msg := map[string]any{
 		"anchor":     anchor,
 		"num_before": numBefore,
 		"num_after":  numAfter,
-		"narrow":     string(narrowJSON),
+		"narrow":     narrow,
 		"op":         op,
 		"flag":       flag,
 	}
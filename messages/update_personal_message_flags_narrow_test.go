@@ -47,7 +47,7 @@ func TestUpdatePersonalMessageFlagsNarrow(t *testing.T) {
 		"anchor":         "anchor",
 		"num_before":     10,
 		"num_after":      10,
-		"narrow":         `[{"operator":"channel","operand":"Denmark","negated":false}]`,
+		"narrow":         narrow.NewFilter().Add(narrow.New(narrow.Channel, "Denmark")),
 		"op":             messages.OperationAdd,
 		"flag":           messages.FlagRead,
 		"include_anchor": true,
@@ -31,7 +31,7 @@ func TestUpdatePersonalMessageFlags(t *testing.T) {
 	assert.Equal(t, http.MethodPost, client.(*mockClient).method)
 
 	expectedParams := map[string]interface{}{
-		"messages": "[4,18,15]",
+		"messages": []int{4, 18, 15},
 		"op":       messages.OperationAdd,
 		"flag":     messages.FlagRead,
 	}
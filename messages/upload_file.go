@@ -3,11 +3,11 @@ package messages
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/wakumaku/go-zulip"
 )
@@ -24,23 +24,53 @@ type uploadFileResponseData struct {
 }
 
 func (u *UploadFileResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &u.APIResponseBase); err != nil {
-		return err
-	}
+	return zulip.UnmarshalResponse(b, &u.APIResponseBase, &u.uploadFileResponseData)
+}
+
+type uploadFileOptions struct {
+	progress zulip.ProgressFunc
+	timeout  time.Duration
+
+	// resumable uploads only
+	chunkSize int64
+	store     ResumableUploadStore
+	resumeKey string
+}
+
+type UploadFileOption func(*uploadFileOptions)
 
-	if err := json.Unmarshal(b, &u.uploadFileResponseData); err != nil {
-		return err
+// UploadProgress sets a function called while the file is uploaded with the
+// bytes sent so far and the total size of the file, -1 if unknown.
+func UploadProgress(progress zulip.ProgressFunc) UploadFileOption {
+	return func(o *uploadFileOptions) {
+		o.progress = progress
 	}
+}
 
-	return nil
+// UploadTimeout sets the timeout of the upload requests. There is none by
+// default, the uploads are bounded by their context only.
+func UploadTimeout(timeout time.Duration) UploadFileOption {
+	return func(o *uploadFileOptions) {
+		o.timeout = timeout
+	}
 }
 
-func (svc *Service) UploadFile(ctx context.Context, filePath string) (*UploadFileResponse, error) {
-	const (
-		method = http.MethodPost
-		path   = "/api/v1/user_uploads"
-	)
+func (o uploadFileOptions) requestOptions() []zulip.DoRequestOption {
+	var opts []zulip.DoRequestOption
+	if o.progress != nil {
+		opts = append(opts, zulip.WithProgress(o.progress))
+	}
+
+	if o.timeout > 0 {
+		opts = append(opts, zulip.WithTimeout(o.timeout))
+	}
 
+	return opts
+}
+
+// UploadFile uploads the file at the given path. The file is streamed to
+// the server, it is not loaded in memory.
+func (svc *Service) UploadFile(ctx context.Context, filePath string, opts ...UploadFileOption) (*UploadFileResponse, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open file: %v", err)
@@ -48,26 +78,28 @@ func (svc *Service) UploadFile(ctx context.Context, filePath string) (*UploadFil
 
 	defer func() { _ = file.Close() }()
 
-	resp := UploadFileResponse{}
-	if err := svc.client.DoFileRequest(ctx, method, path, file.Name(), file, &resp); err != nil {
-		return nil, err
-	}
-
-	return &resp, nil
+	return svc.UploadFileFromReader(ctx, file.Name(), file, opts...)
 }
 
-func (svc *Service) UploadFileFromBytes(ctx context.Context, fileName string, fileBytes []byte) (*UploadFileResponse, error) {
-	return svc.UploadFileFromReader(ctx, fileName, bytes.NewReader(fileBytes))
+func (svc *Service) UploadFileFromBytes(ctx context.Context, fileName string, fileBytes []byte, opts ...UploadFileOption) (*UploadFileResponse, error) {
+	return svc.UploadFileFromReader(ctx, fileName, bytes.NewReader(fileBytes), opts...)
 }
 
-func (svc *Service) UploadFileFromReader(ctx context.Context, fileName string, fileReader io.Reader) (*UploadFileResponse, error) {
+// UploadFileFromReader uploads the content read from fileReader. Requests
+// are retried by the client only if fileReader is an io.Seeker.
+func (svc *Service) UploadFileFromReader(ctx context.Context, fileName string, fileReader io.Reader, opts ...UploadFileOption) (*UploadFileResponse, error) {
 	const (
 		method = http.MethodPost
 		path   = "/api/v1/user_uploads"
 	)
 
+	options := uploadFileOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	resp := UploadFileResponse{}
-	if err := svc.client.DoFileRequest(ctx, method, path, fileName, fileReader, &resp); err != nil {
+	if err := svc.client.DoFileRequest(ctx, method, path, fileName, fileReader, &resp, options.requestOptions()...); err != nil {
 		return nil, err
 	}
 
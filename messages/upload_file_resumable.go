@@ -0,0 +1,417 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+const (
+	// tusPath is the endpoint of the tus resumable upload protocol.
+	tusPath    = "/api/v1/tus/"
+	tusVersion = "1.0.0"
+
+	// tusMaxConflicts is the number of offset conflicts in a row after which
+	// an upload gives up instead of syncing its offset with the server again.
+	tusMaxConflicts = 3
+
+	// DefaultUploadChunkSize is the size of the chunks sent by resumable
+	// uploads unless UploadChunkSize is given.
+	DefaultUploadChunkSize int64 = 5 << 20
+)
+
+// ErrUploadExpired is returned when the server does not know anymore the
+// upload being resumed and it cannot be started again.
+var ErrUploadExpired = errors.New("upload expired")
+
+// UploadChunkSize sets the size of the chunks sent by resumable uploads. A
+// failed chunk is the most that has to be sent again when an upload resumes.
+func UploadChunkSize(size int64) UploadFileOption {
+	return func(o *uploadFileOptions) {
+		o.chunkSize = size
+	}
+}
+
+// UploadResumeStore sets where the state of resumable uploads is persisted.
+// Without it, an interrupted upload starts again from the beginning.
+func UploadResumeStore(store ResumableUploadStore) UploadFileOption {
+	return func(o *uploadFileOptions) {
+		o.store = store
+	}
+}
+
+// UploadResumeKey sets the key used to persist the upload state. By default
+// it is derived from the file name and size, and for UploadFileResumable
+// also from the file path and modification time.
+func UploadResumeKey(key string) UploadFileOption {
+	return func(o *uploadFileOptions) {
+		o.resumeKey = key
+	}
+}
+
+// UploadFileResumable uploads the file at the given path in chunks using the
+// tus protocol. If the upload is interrupted, calling it again with the same
+// store resumes it from the last chunk acknowledged by the server.
+//
+// Servers without tus support, and clients unable to send raw requests, fall
+// back to the single request upload of UploadFile.
+func (svc *Service) UploadFileResumable(ctx context.Context, filePath string, opts ...UploadFileOption) (*UploadFileResponse, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %v", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat file: %v", err)
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+
+	defaultKey := fmt.Sprintf("%s:%d:%d", absPath, info.Size(), info.ModTime().UnixNano())
+
+	return svc.uploadResumable(ctx, file.Name(), file, defaultKey, opts)
+}
+
+// UploadFileResumableFromReader is UploadFileResumable for any seekable
+// content, the upload starts at its current offset.
+func (svc *Service) UploadFileResumableFromReader(ctx context.Context, fileName string, fileReader io.ReadSeeker, opts ...UploadFileOption) (*UploadFileResponse, error) {
+	return svc.uploadResumable(ctx, fileName, fileReader, "", opts)
+}
+
+func (svc *Service) uploadResumable(ctx context.Context, fileName string, file io.ReadSeeker, defaultKey string, opts []UploadFileOption) (*UploadFileResponse, error) {
+	options := uploadFileOptions{
+		chunkSize: DefaultUploadChunkSize,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.chunkSize <= 0 {
+		return nil, errors.New("chunk size must be positive")
+	}
+
+	start, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek file: %v", err)
+	}
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek file: %v", err)
+	}
+
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("cannot seek file: %v", err)
+	}
+
+	size := end - start
+
+	client, ok := svc.client.(zulip.RawRequester)
+	if !ok || size == 0 {
+		return svc.UploadFileFromReader(ctx, fileName, file, opts...)
+	}
+
+	key := options.resumeKey
+	if key == "" {
+		key = defaultKey
+	}
+
+	if key == "" {
+		key = fmt.Sprintf("%s:%d", filepath.Base(fileName), size)
+	}
+
+	t := tusUpload{
+		client:  client,
+		options: options,
+		key:     key,
+		file:    file,
+		start:   start,
+	}
+
+	upload, err := t.resume(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload == nil {
+		upload, err = t.create(ctx, fileName, size)
+		if errors.Is(err, errTusUnsupported) {
+			return svc.UploadFileFromReader(ctx, fileName, file, opts...)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t.send(ctx, upload)
+}
+
+var errTusUnsupported = errors.New("tus uploads are not supported by the server")
+
+// tusUpload sends a file with the tus protocol, see https://tus.io/protocols/resumable-upload
+type tusUpload struct {
+	client  zulip.RawRequester
+	options uploadFileOptions
+	key     string
+	file    io.ReadSeeker
+	start   int64
+}
+
+// resume returns the upload stored under the upload key with its offset
+// updated from the server, nil if there is nothing to resume.
+func (t *tusUpload) resume(ctx context.Context, size int64) (*ResumableUpload, error) {
+	if t.options.store == nil {
+		return nil, nil //nolint:nilnil // nothing to resume
+	}
+
+	upload, err := t.options.store.Load(t.key)
+	if err != nil || upload == nil {
+		return nil, err
+	}
+
+	if upload.Size != size {
+		return nil, t.options.store.Delete(t.key)
+	}
+
+	offset, err := t.offset(ctx, upload.URL)
+	if errors.Is(err, ErrUploadExpired) || errors.Is(err, zulip.ErrForeignURL) {
+		// started again, not sent to another site
+		return nil, t.options.store.Delete(t.key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	upload.Offset = offset
+
+	return upload, nil
+}
+
+// offset asks the server how many bytes of the upload it has received.
+func (t *tusUpload) offset(ctx context.Context, uploadURL string) (int64, error) {
+	header := http.Header{}
+	header.Set("Tus-Resumable", tusVersion)
+
+	resp, err := t.client.DoRawRequest(ctx, http.MethodHead, uploadURL, header, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+	case http.StatusNotFound, http.StatusGone, http.StatusForbidden:
+		return 0, ErrUploadExpired
+	default:
+		return 0, fmt.Errorf("cannot get upload offset: received status code %d", resp.StatusCode)
+	}
+
+	return uploadOffset(resp)
+}
+
+// create starts a new upload on the server.
+func (t *tusUpload) create(ctx context.Context, fileName string, size int64) (*ResumableUpload, error) {
+	name := filepath.Base(fileName)
+
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	header := http.Header{}
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	header.Set("Upload-Metadata", strings.Join([]string{
+		"filename " + base64.StdEncoding.EncodeToString([]byte(name)),
+		"filetype " + base64.StdEncoding.EncodeToString([]byte(mimeType)),
+	}, ","))
+
+	resp, err := t.client.DoRawRequest(ctx, http.MethodPost, tusPath, header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errTusUnsupported
+	default:
+		return nil, fmt.Errorf("cannot create upload: received status code %d", resp.StatusCode)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, errors.New("cannot create upload: no location received")
+	}
+
+	if resp.Request != nil {
+		if u, err := resp.Request.URL.Parse(location); err == nil {
+			location = u.String()
+		}
+	}
+
+	upload := &ResumableUpload{
+		URL:      location,
+		FileName: name,
+		Size:     size,
+	}
+
+	if err := t.save(upload); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// send uploads the file from the upload offset, chunk by chunk.
+func (t *tusUpload) send(ctx context.Context, upload *ResumableUpload) (*UploadFileResponse, error) {
+	chunk := make([]byte, min(t.options.chunkSize, upload.Size))
+	conflicts := 0
+
+	for {
+		if t.options.progress != nil {
+			t.options.progress(upload.Offset, upload.Size)
+		}
+
+		if _, err := t.file.Seek(t.start+upload.Offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("cannot seek file: %v", err)
+		}
+
+		n, err := io.ReadFull(t.file, chunk[:min(int64(len(chunk)), upload.Size-upload.Offset)])
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file: %v", err)
+		}
+
+		header := http.Header{}
+		header.Set("Tus-Resumable", tusVersion)
+		header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		header.Set("Content-Type", "application/offset+octet-stream")
+
+		// the chunks are bounded by ctx only, like the other uploads
+		resp, err := t.client.DoRawRequest(ctx, http.MethodPatch, upload.URL, header, bytes.NewReader(chunk[:n]), zulip.WithTimeout(t.options.timeout))
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNoContent:
+		case http.StatusConflict:
+			// the offset sent does not match the one of the server
+			if conflicts++; conflicts > tusMaxConflicts {
+				return nil, fmt.Errorf("cannot upload chunk: offset conflict %d times in a row", conflicts)
+			}
+
+			if upload.Offset, err = t.offset(ctx, upload.URL); err != nil {
+				return nil, err
+			}
+
+			continue
+		case http.StatusNotFound, http.StatusGone, http.StatusForbidden:
+			return nil, errors.Join(ErrUploadExpired, t.delete())
+		default:
+			return nil, fmt.Errorf("cannot upload chunk: received status code %d", resp.StatusCode)
+		}
+
+		conflicts = 0
+
+		if upload.Offset, err = uploadOffset(resp); err != nil {
+			return nil, err
+		}
+
+		if upload.Offset < upload.Size {
+			if err := t.save(upload); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if t.options.progress != nil {
+			t.options.progress(upload.Offset, upload.Size)
+		}
+
+		if err := t.delete(); err != nil {
+			return nil, err
+		}
+
+		return uploadFileResponse(resp, upload)
+	}
+}
+
+func (t *tusUpload) save(upload *ResumableUpload) error {
+	if t.options.store == nil {
+		return nil
+	}
+
+	return t.options.store.Save(t.key, *upload)
+}
+
+func (t *tusUpload) delete() error {
+	if t.options.store == nil {
+		return nil
+	}
+
+	return t.options.store.Delete(t.key)
+}
+
+func uploadOffset(resp *http.Response) (int64, error) {
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid upload offset: %w", err)
+	}
+
+	return offset, nil
+}
+
+// uploadFileResponse decodes the response of the last chunk. Zulip returns
+// the url and file name of the upload, the same as the classic upload
+// endpoint, but without the result field.
+func uploadFileResponse(resp *http.Response, upload *ResumableUpload) (*UploadFileResponse, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	result := UploadFileResponse{}
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := zulip.UnmarshalResponse(body, &result.APIResponseBase, &result.uploadFileResponseData); err != nil {
+			return nil, fmt.Errorf("cannot read response body: %w", err)
+		}
+	}
+
+	if result.Result() == "" {
+		result.SetResult(zulip.ResultSuccess)
+	}
+
+	if result.FileName == "" {
+		result.FileName = upload.FileName
+	}
+
+	if result.URI == "" {
+		result.URI = result.URL
+	}
+
+	result.SetHTTPCode(resp.StatusCode)
+	result.SetHTTPHeaders(resp.Header)
+
+	return &result, nil
+}
@@ -0,0 +1,328 @@
+package messages_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/messages"
+)
+
+// tusServer is a minimal stand-in of the tus endpoint of a Zulip server.
+type tusServer struct {
+	mu       sync.Mutex
+	uploads  map[string]*tusServerUpload
+	next     int
+	disabled bool
+	// failPatch makes the nth PATCH request fail, starting at 1
+	failPatch int
+	patches   int
+	received  int64
+	classic   bool
+	// location overrides the URL of the uploads created
+	location string
+	// conflict makes every PATCH request fail with an offset conflict
+	conflict bool
+}
+
+type tusServerUpload struct {
+	length   int64
+	filename string
+	content  bytes.Buffer
+}
+
+func newTusServer(t *testing.T, ts *tusServer) *httptest.Server {
+	t.Helper()
+
+	ts.uploads = map[string]*tusServerUpload{}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(ts.handle))
+	t.Cleanup(mockServer.Close)
+
+	return mockServer
+}
+
+func (ts *tusServer) handle(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if r.URL.Path == "/api/v1/user_uploads" {
+		ts.classic = true
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "url": "/user_uploads/classic.txt", "filename": "classic.txt"}`))
+
+		return
+	}
+
+	if ts.disabled || !strings.HasPrefix(r.URL.Path, "/api/v1/tus/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != "1.0.0" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		length, _ := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+
+		upload := &tusServerUpload{length: length}
+
+		for _, kv := range strings.Split(r.Header.Get("Upload-Metadata"), ",") {
+			if k, v, ok := strings.Cut(kv, " "); ok && k == "filename" {
+				name, _ := base64.StdEncoding.DecodeString(v)
+				upload.filename = string(name)
+			}
+		}
+
+		ts.next++
+		id := strconv.Itoa(ts.next)
+		ts.uploads[id] = upload
+
+		location := "/api/v1/tus/" + id
+		if ts.location != "" {
+			location = ts.location
+		}
+
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusCreated)
+
+		return
+	}
+
+	upload, found := ts.uploads[strings.TrimPrefix(r.URL.Path, "/api/v1/tus/")]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.Itoa(upload.content.Len()))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		ts.patches++
+		if ts.patches == ts.failPatch {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if ts.conflict || r.Header.Get("Upload-Offset") != strconv.Itoa(upload.content.Len()) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		n, _ := io.Copy(&upload.content, r.Body)
+		ts.received += n
+
+		w.Header().Set("Upload-Offset", strconv.Itoa(upload.content.Len()))
+
+		if int64(upload.content.Len()) < upload.length {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(w, `{"url": "/user_uploads/1/ab/%s", "filename": %q}`, upload.filename, upload.filename)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (ts *tusServer) content(id string) string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.uploads[id].content.String()
+}
+
+func newTusService(t *testing.T, ts *tusServer) *messages.Service {
+	t.Helper()
+
+	mockServer := newTusServer(t, ts)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	return messages.NewService(client)
+}
+
+func TestUploadFileResumable(t *testing.T) {
+	ts := &tusServer{}
+	messagesSvc := newTusService(t, ts)
+
+	content := strings.Repeat("0123456789", 100)
+
+	filePath := filepath.Join(t.TempDir(), "numbers.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o600))
+
+	var progress []int64
+
+	resp, err := messagesSvc.UploadFileResumable(context.Background(), filePath,
+		messages.UploadChunkSize(300),
+		messages.UploadProgress(func(sent, total int64) {
+			assert.Equal(t, int64(1000), total)
+			progress = append(progress, sent)
+		}),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "/user_uploads/1/ab/numbers.txt", resp.URL)
+	assert.Equal(t, resp.URL, resp.URI)
+	assert.Equal(t, "numbers.txt", resp.FileName)
+
+	assert.Equal(t, content, ts.content("1"))
+	assert.Equal(t, 4, ts.patches)
+	assert.Equal(t, []int64{0, 300, 600, 900, 1000}, progress)
+}
+
+func TestUploadFileResumableResumes(t *testing.T) {
+	ts := &tusServer{failPatch: 3}
+	messagesSvc := newTusService(t, ts)
+
+	content := strings.Repeat("abcdefghij", 100)
+	storePath := filepath.Join(t.TempDir(), "uploads.json")
+	store := messages.NewFileUploadStore(storePath)
+
+	_, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader(content),
+		messages.UploadChunkSize(300),
+		messages.UploadResumeStore(store),
+	)
+	require.Error(t, err)
+
+	upload, err := store.Load("letters.txt:1000")
+	require.NoError(t, err)
+	require.NotNil(t, upload)
+	assert.Equal(t, int64(600), upload.Offset)
+	assert.Equal(t, int64(600), ts.received)
+
+	// a new store on the same file, as after a restart
+	store = messages.NewFileUploadStore(storePath)
+
+	resp, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader(content),
+		messages.UploadChunkSize(300),
+		messages.UploadResumeStore(store),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	assert.Equal(t, content, ts.content("1"))
+	assert.Equal(t, int64(1000), ts.received)
+
+	upload, err = store.Load("letters.txt:1000")
+	require.NoError(t, err)
+	assert.Nil(t, upload)
+}
+
+func TestUploadFileResumableExpired(t *testing.T) {
+	ts := &tusServer{}
+	messagesSvc := newTusService(t, ts)
+
+	store := messages.NewMemoryUploadStore()
+	require.NoError(t, store.Save("key", messages.ResumableUpload{
+		URL:      "/api/v1/tus/unknown",
+		FileName: "letters.txt",
+		Size:     3,
+		Offset:   2,
+	}))
+
+	resp, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader("abc"),
+		messages.UploadResumeStore(store),
+		messages.UploadResumeKey("key"),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "abc", ts.content("1"))
+}
+
+func TestUploadFileResumableForeignURL(t *testing.T) {
+	ts := &tusServer{location: "https://attacker.example/api/v1/tus/1"}
+	messagesSvc := newTusService(t, ts)
+
+	// the credentials are not sent to the location received
+	_, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader("abc"))
+	require.ErrorIs(t, err, zulip.ErrForeignURL)
+	assert.Zero(t, ts.patches)
+
+	// nor to the URL of a stored upload, started again instead
+	ts = &tusServer{}
+	messagesSvc = newTusService(t, ts)
+
+	store := messages.NewMemoryUploadStore()
+	require.NoError(t, store.Save("key", messages.ResumableUpload{
+		URL:      "https://attacker.example/api/v1/tus/1",
+		FileName: "letters.txt",
+		Size:     3,
+		Offset:   2,
+	}))
+
+	resp, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader("abc"),
+		messages.UploadResumeStore(store),
+		messages.UploadResumeKey("key"),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "abc", ts.content("1"))
+}
+
+func TestUploadFileResumableConflicts(t *testing.T) {
+	ts := &tusServer{conflict: true}
+	messagesSvc := newTusService(t, ts)
+
+	_, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "letters.txt", strings.NewReader("abc"))
+	require.ErrorContains(t, err, "offset conflict")
+	assert.Equal(t, 4, ts.patches)
+}
+
+func TestUploadFileResumableFallback(t *testing.T) {
+	ts := &tusServer{disabled: true}
+	messagesSvc := newTusService(t, ts)
+
+	resp, err := messagesSvc.UploadFileResumableFromReader(context.Background(), "classic.txt", strings.NewReader("content"))
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "/user_uploads/classic.txt", resp.URL)
+	assert.True(t, ts.classic)
+}
+
+func TestFileUploadStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uploads.json")
+	store := messages.NewFileUploadStore(path)
+
+	upload, err := store.Load("missing")
+	require.NoError(t, err)
+	assert.Nil(t, upload)
+
+	require.NoError(t, store.Save("key", messages.ResumableUpload{URL: "/api/v1/tus/1", Size: 10, Offset: 5}))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	upload, err = messages.NewFileUploadStore(path).Load("key")
+	require.NoError(t, err)
+	require.NotNil(t, upload)
+	assert.Equal(t, int64(5), upload.Offset)
+
+	require.NoError(t, store.Delete("key"))
+
+	upload, err = store.Load("key")
+	require.NoError(t, err)
+	assert.Nil(t, upload)
+}
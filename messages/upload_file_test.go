@@ -2,11 +2,16 @@ package messages_test
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
 	"github.com/wakumaku/go-zulip/messages"
 )
 
@@ -80,3 +85,31 @@ func TestUploadFileFromBytes(t *testing.T) {
 	assert.Equal(t, "/api/v1/user_uploads", client.(*mockClient).path)
 	assert.Equal(t, msg, client.(*mockClient).paramsSent)
 }
+
+func TestUploadFileProgress(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "filename": "zulip.txt"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	messagesSvc := messages.NewService(client)
+
+	var sent, total int64
+
+	resp, err := messagesSvc.UploadFileFromBytes(context.Background(),
+		"zulip.txt",
+		[]byte("hello world"),
+		messages.UploadProgress(func(s, t int64) { sent, total = s, t }),
+		messages.UploadTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	assert.Equal(t, int64(11), sent)
+	assert.Equal(t, int64(11), total)
+}
@@ -0,0 +1,174 @@
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/wakumaku/go-zulip/internal/atomicfile"
+)
+
+// ResumableUpload is the state of an upload started with the tus protocol,
+// enough to resume it later.
+type ResumableUpload struct {
+	// URL is the location of the upload returned by the server.
+	URL string `json:"url"`
+	// FileName is the name of the uploaded file.
+	FileName string `json:"filename"`
+	// Size is the total size of the file.
+	Size int64 `json:"size"`
+	// Offset is the number of bytes acknowledged by the server.
+	Offset int64 `json:"offset"`
+}
+
+// ResumableUploadStore persists the state of resumable uploads by key, so an
+// interrupted upload can be resumed, even after a process restart.
+type ResumableUploadStore interface {
+	// Load returns the upload stored under key, nil if there is none.
+	Load(key string) (*ResumableUpload, error)
+	// Save stores the upload under key, replacing any previous one.
+	Save(key string, upload ResumableUpload) error
+	// Delete removes the upload stored under key, if any.
+	Delete(key string) error
+}
+
+// MemoryUploadStore keeps resumable uploads in memory. Uploads can be resumed
+// within the same process only.
+type MemoryUploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]ResumableUpload
+}
+
+func NewMemoryUploadStore() *MemoryUploadStore {
+	return &MemoryUploadStore{uploads: map[string]ResumableUpload{}}
+}
+
+func (s *MemoryUploadStore) Load(key string) (*ResumableUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, found := s.uploads[key]
+	if !found {
+		return nil, nil //nolint:nilnil // not found is not an error
+	}
+
+	return &upload, nil
+}
+
+func (s *MemoryUploadStore) Save(key string, upload ResumableUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.uploads[key] = upload
+
+	return nil
+}
+
+func (s *MemoryUploadStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uploads, key)
+
+	return nil
+}
+
+// FileUploadStore keeps resumable uploads in a JSON file. The file is
+// rewritten atomically on every change and is only readable by its owner.
+type FileUploadStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileUploadStore(path string) *FileUploadStore {
+	return &FileUploadStore{path: path}
+}
+
+func (s *FileUploadStore) Load(key string) (*ResumableUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploads, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	upload, found := uploads[key]
+	if !found {
+		return nil, nil //nolint:nilnil // not found is not an error
+	}
+
+	return &upload, nil
+}
+
+func (s *FileUploadStore) Save(key string, upload ResumableUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploads, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	uploads[key] = upload
+
+	return s.write(uploads)
+}
+
+func (s *FileUploadStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploads, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if _, found := uploads[key]; !found {
+		return nil
+	}
+
+	delete(uploads, key)
+
+	return s.write(uploads)
+}
+
+func (s *FileUploadStore) read() (map[string]ResumableUpload, error) {
+	uploads := map[string]ResumableUpload{}
+
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return uploads, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading upload store: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &uploads); err != nil {
+		return nil, fmt.Errorf("decoding upload store: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (s *FileUploadStore) write(uploads map[string]ResumableUpload) error {
+	content, err := json.Marshal(uploads)
+	if err != nil {
+		return fmt.Errorf("encoding upload store: %w", err)
+	}
+
+	err = atomicfile.Write(s.path, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing upload store: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package zulip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Request is a request sent through the client middleware chain by
+// DoRequest and DoFileRequest. Middlewares can modify it before calling the
+// next handler.
+type Request struct {
+	// ID is a unique identifier of the request, also used in the client logs.
+	ID string
+	// Method is the HTTP method of the request.
+	Method string
+	// Path is the API path of the request, without the site URL.
+	Path string
+	// Data is the form data of the request, nil for file requests.
+	Data map[string]any
+	// FileName is the name of the file sent, empty for non file requests.
+	FileName string
+	// File is the content of the file sent, nil for non file requests.
+	File io.Reader
+	// Header holds extra HTTP headers to send with the request.
+	Header http.Header
+	// Timeout is the timeout of every attempt of the request, none when 0.
+	Timeout time.Duration
+	// Progress is called while the file of a file request is sent.
+	Progress ProgressFunc
+}
+
+// Response is the result of a request sent through the client middleware
+// chain.
+type Response struct {
+	// APIResponse is the decoded response, the same value passed to
+	// DoRequest or DoFileRequest.
+	APIResponse APIResponse
+	// HTTPCode is the HTTP status code of the last attempt.
+	HTTPCode int
+	// Header holds the HTTP headers of the last attempt.
+	Header http.Header
+	// Attempts is the number of attempts made, including retries.
+	Attempts int
+	// Duration is the time spent sending the request and decoding the
+	// response, including retries and rate limit waits.
+	Duration time.Duration
+}
+
+// Handler sends a request and fills in its response.
+type Handler func(ctx context.Context, req *Request, resp *Response) error
+
+// Middleware wraps a Handler to add behaviour before and after a request is
+// sent: logging, metrics, fault injection ...
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middlewares to the client. They are applied to both
+// DoRequest and DoFileRequest in the given order, the first one being the
+// outermost. They see every call once: retries and rate limit waits happen
+// inside the chain.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(o *clientOptions) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return errors.New("middleware is nil")
+			}
+		}
+
+		o.middlewares = append(o.middlewares, middlewares...)
+
+		return nil
+	}
+}
+
+func chainMiddlewares(h Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,147 @@
+package zulip_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var receivedHeader, receivedBody string
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header.Get("X-Custom")
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "id": 42}`))
+	}))
+	defer mockServer.Close()
+
+	var calls []string
+
+	tracer := func(name string) zulip.Middleware {
+		return func(next zulip.Handler) zulip.Handler {
+			return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+				calls = append(calls, name+" before "+req.Method+" "+req.Path)
+				err := next(ctx, req, resp)
+				calls = append(calls, name+" after "+http.StatusText(resp.HTTPCode))
+
+				return err
+			}
+		}
+	}
+
+	modifier := func(next zulip.Handler) zulip.Handler {
+		return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+			req.Header.Set("X-Custom", "custom")
+
+			if req.Data != nil {
+				req.Data["added"] = "by middleware"
+			}
+
+			return next(ctx, req, resp)
+		}
+	}
+
+	var observed *zulip.Response
+
+	observer := func(next zulip.Handler) zulip.Handler {
+		return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+			err := next(ctx, req, resp)
+			observed = resp
+
+			return err
+		}
+	}
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithMiddleware(tracer("first"), tracer("second")),
+		zulip.WithMiddleware(modifier, observer),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodPost, "/endpoint", map[string]any{"key": "value"}, &resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"first before POST /endpoint",
+		"second before POST /endpoint",
+		"second after OK",
+		"first after OK",
+	}, calls)
+
+	assert.Equal(t, "custom", receivedHeader)
+	assert.Equal(t, "added=by+middleware&key=value", receivedBody)
+
+	require.NotNil(t, observed)
+	assert.Equal(t, http.StatusOK, observed.HTTPCode)
+	assert.Equal(t, 1, observed.Attempts)
+	assert.Positive(t, observed.Duration)
+	assert.Same(t, &resp, observed.APIResponse)
+
+	id, err := resp.FieldValue("id")
+	require.NoError(t, err)
+	assert.InDelta(t, 42, id, 0)
+
+	// file requests go through the same chain
+	calls = nil
+
+	err = client.DoFileRequest(context.TODO(), http.MethodPost, "/upload", "file.txt", strings.NewReader("content"), &resp)
+	require.NoError(t, err)
+	assert.Equal(t, "first before POST /upload", calls[0])
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	// dry-run: no request reaches the server
+	dryRun := func(next zulip.Handler) zulip.Handler {
+		return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+			resp.HTTPCode = http.StatusOK
+			return json.Unmarshal([]byte(`{"result": "success", "msg": "dry run"}`), resp.APIResponse)
+		}
+	}
+
+	client, err := zulip.NewClient(zulip.Credentials("http://localhost:0", "email@test", "apikey"),
+		zulip.WithMiddleware(dryRun),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodPost, "/endpoint", nil, &resp))
+	assert.Equal(t, "dry run", resp.Msg())
+
+	// fault injection
+	errInjected := errors.New("injected")
+	faulty := func(next zulip.Handler) zulip.Handler {
+		return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+			return errInjected
+		}
+	}
+
+	client, err = zulip.NewClient(zulip.Credentials("http://localhost:0", "email@test", "apikey"),
+		zulip.WithMiddleware(faulty),
+	)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, client.DoRequest(context.TODO(), http.MethodPost, "/endpoint", nil, &resp), errInjected)
+}
+
+func TestMiddlewareNil(t *testing.T) {
+	_, err := zulip.NewClient(zulip.Credentials("http://localhost", "email@test", "apikey"),
+		zulip.WithMiddleware(nil),
+	)
+	require.Error(t, err)
+}
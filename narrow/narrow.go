@@ -9,7 +9,10 @@ package narrow
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+
+	"github.com/wakumaku/go-zulip"
 )
 
 // Operator is a type that represents the concrete operators that can be used in the narrow parameter.
@@ -42,6 +45,10 @@ const (
 	Dm Operator = "dm"
 	// Search all direct messages (1-on-1 and group) that include you and user ID 1234.
 	DmIncluding Operator = "dm-including"
+	// pm-with is the legacy name of "dm", before Zulip 7.0
+	PmWith Operator = "pm-with"
+	// group-pm-with is the legacy name of "dm-including", before Zulip 7.0
+	GroupPmWith Operator = "group-pm-with"
 
 	Is  Operator = "is"
 	Has Operator = "has"
@@ -101,11 +108,58 @@ func (f *Filter) String() string {
 	return strings.Join(ns, " ")
 }
 
+// ForFeatureLevel returns a copy of the Filter with the operators renamed to
+// the legacy names understood by a server with the given feature level
+func (f Filter) ForFeatureLevel(level int) Filter {
+	out := make(Filter, len(f))
+	copy(out, f)
+
+	for i, item := range out {
+		if level < zulip.FeatureLevelChannelNarrow {
+			switch item.Operator {
+			case Channel:
+				out[i].Operator = Stream
+			case Channels:
+				out[i].Operator = Streams
+			}
+		}
+
+		if level < zulip.FeatureLevelDmNarrow {
+			switch {
+			case item.Operator == Dm:
+				out[i].Operator = PmWith
+			case item.Operator == DmIncluding:
+				out[i].Operator = GroupPmWith
+			case item.Operator == Is && item.Operand == Operand("dm"):
+				out[i].Operand = Operand("private")
+			}
+		}
+	}
+
+	return out
+}
+
+// DependsOnFeatureLevel reports whether the Filter has operators renamed for
+// older servers, see ForFeatureLevel
+func (f Filter) DependsOnFeatureLevel() bool {
+	return !slices.Equal(f, f.ForFeatureLevel(0))
+}
+
 // MarshalJSON returns the JSON encoding of the Filter
 func (f Filter) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]Narrow(f))
 }
 
+// EncodeParam returns the Filter as the narrow parameter of a request
+func (f Filter) EncodeParam() (string, error) {
+	b, err := f.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
 // MarshalEvent returns the JSON encoding of the Filter for events
 func (f Filter) MarshalEvent() ([]byte, error) {
 	out := make([][]string, 0, len(f))
@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
 )
 
 func TestNarrower(t *testing.T) {
@@ -67,6 +68,10 @@ func TestNarrower(t *testing.T) {
 			require.NoError(t, err)
 			assert.JSONEq(t, tc.expected, string(actual))
 
+			param, err := tc.narrower.EncodeParam()
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, param)
+
 			if tc.expectedEvent != "" {
 				eventJSON, err := tc.narrower.MarshalEvent()
 				require.NoError(t, err)
@@ -122,3 +127,34 @@ func TestNarrowerBasic(t *testing.T) {
 	require.NoError(t, err)
 	assert.JSONEq(t, expectedNarrowersJSON, string(currentNarrowersJSON))
 }
+
+func TestFilterForFeatureLevel(t *testing.T) {
+	filter := NewFilter().
+		Add(New(Channel, "general")).
+		Add(New(Dm, "iago@zulip.com")).
+		Add(IsDm)
+
+	// up to date servers get the filter unchanged
+	assert.Equal(t, filter, filter.ForFeatureLevel(zulip.FeatureLevelChannelNarrow))
+
+	// Zulip 8
+	assert.Equal(t, NewFilter().
+		Add(New(Stream, "general")).
+		Add(New(Dm, "iago@zulip.com")).
+		Add(IsDm),
+		filter.ForFeatureLevel(zulip.FeatureLevelChannelNarrow-1))
+
+	// Zulip 6
+	assert.Equal(t, NewFilter().
+		Add(New(Stream, "general")).
+		Add(New(PmWith, "iago@zulip.com")).
+		Add(New(Is, "private")),
+		filter.ForFeatureLevel(zulip.FeatureLevelDmNarrow-1))
+
+	// the original filter is not modified
+	assert.Equal(t, Channel, filter[0].Operator)
+
+	assert.True(t, filter.DependsOnFeatureLevel())
+	assert.True(t, NewFilter().Add(IsDm).DependsOnFeatureLevel())
+	assert.False(t, NewFilter().Add(New(Stream, "general")).Add(IsStarred).DependsOnFeatureLevel())
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/wakumaku/go-zulip"
 )
@@ -24,46 +25,64 @@ func (u *UploadCustomEmojiResponse) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (svc *Service) UploadCustomEmoji(ctx context.Context, name, filePath string) (*UploadCustomEmojiResponse, error) {
-	const (
-		method = http.MethodPost
-		path   = "/api/v1/realm/emoji/%s"
-	)
+type uploadCustomEmojiOptions struct {
+	progress zulip.ProgressFunc
+	timeout  time.Duration
+}
 
-	patchPath := fmt.Sprintf(path, name)
+type UploadCustomEmojiOption func(*uploadCustomEmojiOptions)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot open file: %v", err)
+// UploadCustomEmojiProgress sets a function called while the image is
+// uploaded with the bytes sent so far and the total size of the image, -1 if
+// unknown.
+func UploadCustomEmojiProgress(progress zulip.ProgressFunc) UploadCustomEmojiOption {
+	return func(o *uploadCustomEmojiOptions) {
+		o.progress = progress
 	}
+}
 
-	defer func() { _ = file.Close() }()
+// UploadCustomEmojiTimeout sets the timeout of the upload. There is none by
+// default, the upload is bounded by its context only.
+func UploadCustomEmojiTimeout(timeout time.Duration) UploadCustomEmojiOption {
+	return func(o *uploadCustomEmojiOptions) {
+		o.timeout = timeout
+	}
+}
 
-	resp := UploadCustomEmojiResponse{}
-	if err := svc.client.DoFileRequest(ctx, method, patchPath, file.Name(), file, &resp); err != nil {
-		return nil, err
+func (o uploadCustomEmojiOptions) requestOptions() []zulip.DoRequestOption {
+	var opts []zulip.DoRequestOption
+	if o.progress != nil {
+		opts = append(opts, zulip.WithProgress(o.progress))
 	}
 
-	return &resp, nil
+	if o.timeout > 0 {
+		opts = append(opts, zulip.WithTimeout(o.timeout))
+	}
+
+	return opts
 }
 
-func (svc *Service) UploadCustomEmojiFromBytes(ctx context.Context, name, fileName string, fileBytes []byte) (*UploadCustomEmojiResponse, error) {
-	const (
-		method = http.MethodPost
-		path   = "/api/v1/realm/emoji/%s"
-	)
+// UploadCustomEmoji uploads the image at the given path as the custom emoji
+// name. The image is streamed to the server, it is not loaded in memory.
+func (svc *Service) UploadCustomEmoji(ctx context.Context, name, filePath string, opts ...UploadCustomEmojiOption) (*UploadCustomEmojiResponse, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %v", err)
+	}
 
-	patchPath := fmt.Sprintf(path, name)
+	defer func() { _ = file.Close() }()
 
-	resp := UploadCustomEmojiResponse{}
-	if err := svc.client.DoFileRequest(ctx, method, patchPath, fileName, bytes.NewReader(fileBytes), &resp); err != nil {
-		return nil, err
-	}
+	return svc.UploadCustomEmojiFromReader(ctx, name, file.Name(), file, opts...)
+}
 
-	return &resp, nil
+func (svc *Service) UploadCustomEmojiFromBytes(ctx context.Context, name, fileName string, fileBytes []byte, opts ...UploadCustomEmojiOption) (*UploadCustomEmojiResponse, error) {
+	return svc.UploadCustomEmojiFromReader(ctx, name, fileName, bytes.NewReader(fileBytes), opts...)
 }
 
-func (svc *Service) UploadCustomEmojiFromReader(ctx context.Context, name, fileName string, fileReader io.Reader) (*UploadCustomEmojiResponse, error) {
+// UploadCustomEmojiFromReader uploads the image read from fileReader as the
+// custom emoji name. Requests are retried by the client only if fileReader is
+// an io.Seeker.
+func (svc *Service) UploadCustomEmojiFromReader(ctx context.Context, name, fileName string, fileReader io.Reader, opts ...UploadCustomEmojiOption) (*UploadCustomEmojiResponse, error) {
 	const (
 		method = http.MethodPost
 		path   = "/api/v1/realm/emoji/%s"
@@ -71,8 +90,13 @@ func (svc *Service) UploadCustomEmojiFromReader(ctx context.Context, name, fileN
 
 	patchPath := fmt.Sprintf(path, name)
 
+	options := uploadCustomEmojiOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	resp := UploadCustomEmojiResponse{}
-	if err := svc.client.DoFileRequest(ctx, method, patchPath, fileName, fileReader, &resp); err != nil {
+	if err := svc.client.DoFileRequest(ctx, method, patchPath, fileName, fileReader, &resp, options.requestOptions()...); err != nil {
 		return nil, err
 	}
 
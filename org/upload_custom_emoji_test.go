@@ -2,11 +2,17 @@ package org_test
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
 	"github.com/wakumaku/go-zulip/org"
 )
 
@@ -34,3 +40,75 @@ func TestUploadCustomEmoji(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "success", resp.Result())
 }
+
+func TestUploadCustomEmojiProgress(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/realm/emoji/party", r.URL.Path)
+
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": ""}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	service := org.NewService(client)
+
+	var sent, total int64
+
+	resp, err := service.UploadCustomEmojiFromBytes(context.Background(),
+		"party",
+		"party.png",
+		[]byte("test emoji data"),
+		org.UploadCustomEmojiProgress(func(s, t int64) { sent, total = s, t }),
+		org.UploadCustomEmojiTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	assert.Equal(t, int64(15), sent)
+	assert.Equal(t, int64(15), total)
+
+	// the size of a plain reader is unknown
+	resp, err = service.UploadCustomEmojiFromReader(context.Background(),
+		"party",
+		"party.png",
+		io.MultiReader(strings.NewReader("test emoji data")),
+		org.UploadCustomEmojiProgress(func(s, t int64) { sent, total = s, t }),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	assert.Equal(t, int64(15), sent)
+	assert.Equal(t, int64(-1), total)
+}
+
+func TestUploadCustomEmojiTimeout(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": ""}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	service := org.NewService(client)
+
+	_, err = service.UploadCustomEmojiFromReader(context.Background(),
+		"party",
+		"party.png",
+		strings.NewReader("test emoji data"),
+		org.UploadCustomEmojiTimeout(50*time.Millisecond),
+	)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,251 @@
+// Package otelzulip provides OpenTelemetry instrumentation for the Zulip
+// client.
+//
+// Implemented features:
+//   - A span per API call (method, path template, request id, result, code,
+//     HTTP status code and attempts)
+//   - A span per event queue long poll (queue id, last event id and number of
+//     received events)
+//   - Request duration histogram
+//   - Error counter by Zulip error code
+//   - Rate limit remaining gauge
+//
+// Usage:
+//
+//	mw, err := otelzulip.Middleware()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	client, err := zulip.NewClient(credentials, zulip.WithMiddleware(mw))
+//
+// The global tracer and meter providers are used unless WithTracerProvider
+// or WithMeterProvider are given.
+package otelzulip
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wakumaku/go-zulip"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/wakumaku/go-zulip/otelzulip"
+
+// eventsPath is the path used to long poll event queues.
+const eventsPath = "/api/v1/events"
+
+// Attribute keys specific to Zulip.
+const (
+	RequestIDKey   = attribute.Key("zulip.request_id")
+	ResultKey      = attribute.Key("zulip.result")
+	CodeKey        = attribute.Key("zulip.code")
+	AttemptsKey    = attribute.Key("zulip.attempts")
+	QueueIDKey     = attribute.Key("zulip.queue_id")
+	LastEventIDKey = attribute.Key("zulip.last_event_id")
+	EventsCountKey = attribute.Key("zulip.events.count")
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+type Option func(*config)
+
+// WithTracerProvider sets the tracer provider used to create spans.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider sets the meter provider used to create the metrics.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+type instrumentation struct {
+	tracer             trace.Tracer
+	duration           metric.Float64Histogram
+	errors             metric.Int64Counter
+	rateLimitRemaining metric.Int64Gauge
+}
+
+// Middleware returns a zulip.Middleware that records traces and metrics for
+// every request sent by the client.
+func Middleware(options ...Option) (zulip.Middleware, error) {
+	cfg := config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
+	meter := cfg.meterProvider.Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram("zulip.client.request.duration",
+		metric.WithDescription("Duration of the Zulip API requests, including retries."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	errorsCounter, err := meter.Int64Counter("zulip.client.request.errors",
+		metric.WithDescription("Number of failed Zulip API requests by error code."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitRemaining, err := meter.Int64Gauge("zulip.client.ratelimit.remaining",
+		metric.WithDescription("Requests remaining before hitting the rate limit, as reported by the server."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &instrumentation{
+		tracer:             cfg.tracerProvider.Tracer(instrumentationName),
+		duration:           duration,
+		errors:             errorsCounter,
+		rateLimitRemaining: rateLimitRemaining,
+	}
+
+	return inst.middleware, nil
+}
+
+// zulipResponse is implemented by every response embedding
+// zulip.APIResponseBase.
+type zulipResponse interface {
+	Result() string
+	Code() string
+}
+
+// eventCounter is implemented by the responses of the event queue long polls,
+// like realtime.GetEventsEventQueueResponse.
+type eventCounter interface {
+	EventCount() int
+}
+
+func (i *instrumentation) middleware(next zulip.Handler) zulip.Handler {
+	return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+		template := PathTemplate(req.Path)
+		longPoll := req.Method == http.MethodGet && req.Path == eventsPath
+
+		spanName := "zulip " + req.Method + " " + template
+		if longPoll {
+			spanName = "zulip events long poll"
+		}
+
+		commonAttrs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLTemplate(template),
+		}
+
+		spanAttrs := append([]attribute.KeyValue{RequestIDKey.String(req.ID)}, commonAttrs...)
+		if longPoll {
+			spanAttrs = append(spanAttrs, longPollAttributes(req.Data)...)
+		}
+
+		ctx, span := i.tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(spanAttrs...))
+		defer span.End()
+
+		err := next(ctx, req, resp)
+
+		var result, code string
+		if r, ok := resp.APIResponse.(zulipResponse); ok {
+			result, code = r.Result(), r.Code()
+		}
+
+		if r, ok := resp.APIResponse.(eventCounter); ok && longPoll && err == nil {
+			span.SetAttributes(EventsCountKey.Int(r.EventCount()))
+		}
+
+		span.SetAttributes(AttemptsKey.Int(resp.Attempts))
+
+		if resp.HTTPCode > 0 {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.HTTPCode))
+			commonAttrs = append(commonAttrs, semconv.HTTPResponseStatusCode(resp.HTTPCode))
+		}
+
+		if result != "" {
+			span.SetAttributes(ResultKey.String(result))
+		}
+
+		if code != "" {
+			span.SetAttributes(CodeKey.String(code))
+		}
+
+		i.duration.Record(ctx, resp.Duration.Seconds(), metric.WithAttributes(commonAttrs...))
+
+		if remaining, convErr := strconv.Atoi(resp.Header.Get(zulip.XRateLimitRemaining)); convErr == nil {
+			i.rateLimitRemaining.Record(ctx, int64(remaining), metric.WithAttributes(commonAttrs...))
+		}
+
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+
+			if code == "" {
+				code = "TRANSPORT_ERROR"
+			}
+
+			i.errors.Add(ctx, 1, metric.WithAttributes(append(commonAttrs, CodeKey.String(code))...))
+		case result == zulip.ResultError:
+			span.SetStatus(codes.Error, code)
+			i.errors.Add(ctx, 1, metric.WithAttributes(append(commonAttrs, CodeKey.String(code))...))
+		}
+
+		return err
+	}
+}
+
+func longPollAttributes(data map[string]any) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	if queueID, ok := data["queue_id"].(string); ok {
+		attrs = append(attrs, QueueIDKey.String(queueID))
+	}
+
+	if lastEventID, ok := data["last_event_id"].(int); ok {
+		attrs = append(attrs, LastEventIDKey.Int(lastEventID))
+	}
+
+	return attrs
+}
+
+var rxNumericSegment = regexp.MustCompile(`^-?\d+$`)
+
+// PathTemplate replaces the variable segments of an API path (ids and
+// emails) with placeholders, so it can be used as a low cardinality span
+// name and metric attribute. For example "/api/v1/streams/12/members"
+// becomes "/api/v1/streams/{id}/members".
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case rxNumericSegment.MatchString(s):
+			segments[i] = "{id}"
+		case strings.Contains(s, "@"), strings.Contains(s, "%40"):
+			segments[i] = "{email}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,172 @@
+package otelzulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/otelzulip"
+	"github.com/wakumaku/go-zulip/realtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newInstrumentedClient(t *testing.T, handler http.HandlerFunc) (*zulip.Client, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	mockServer := httptest.NewServer(handler)
+	t.Cleanup(mockServer.Close)
+
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+
+	metricReader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader))
+
+	mw, err := otelzulip.Middleware(
+		otelzulip.WithTracerProvider(tracerProvider),
+		otelzulip.WithMeterProvider(meterProvider),
+	)
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithMiddleware(mw),
+	)
+	require.NoError(t, err)
+
+	return client, spanRecorder, metricReader
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func findMetric(t *testing.T, rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	t.Helper()
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+
+	require.Failf(t, "metric not found", "metric %s not found", name)
+
+	return metricdata.Metrics{}
+}
+
+func TestMiddlewareSuccess(t *testing.T) {
+	client, spanRecorder, metricReader := newInstrumentedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(zulip.XRateLimitRemaining, "199")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "subscribers": [1, 2]}`))
+	})
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/streams/12/members", nil, &resp))
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "zulip GET /api/v1/streams/{id}/members", span.Name())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+
+	attrs := spanAttributes(span)
+	assert.Equal(t, "GET", attrs["http.request.method"].AsString())
+	assert.Equal(t, "/api/v1/streams/{id}/members", attrs["url.template"].AsString())
+	assert.Equal(t, int64(http.StatusOK), attrs["http.response.status_code"].AsInt64())
+	assert.Equal(t, zulip.ResultSuccess, attrs[otelzulip.ResultKey].AsString())
+	assert.Equal(t, int64(1), attrs[otelzulip.AttemptsKey].AsInt64())
+	assert.NotEmpty(t, attrs[otelzulip.RequestIDKey].AsString())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, metricReader.Collect(context.TODO(), &rm))
+
+	duration := findMetric(t, rm, "zulip.client.request.duration").Data.(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, uint64(1), duration.DataPoints[0].Count)
+
+	remaining := findMetric(t, rm, "zulip.client.ratelimit.remaining").Data.(metricdata.Gauge[int64])
+	require.Len(t, remaining.DataPoints, 1)
+	assert.Equal(t, int64(199), remaining.DataPoints[0].Value)
+}
+
+func TestMiddlewareError(t *testing.T) {
+	client, spanRecorder, metricReader := newInstrumentedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"result": "error", "msg": "Invalid channel ID", "code": "BAD_REQUEST"}`))
+	})
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/streams/12", nil, &resp))
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "BAD_REQUEST", spanAttributes(spans[0])[otelzulip.CodeKey].AsString())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, metricReader.Collect(context.TODO(), &rm))
+
+	errorsCount := findMetric(t, rm, "zulip.client.request.errors").Data.(metricdata.Sum[int64])
+	require.Len(t, errorsCount.DataPoints, 1)
+	assert.Equal(t, int64(1), errorsCount.DataPoints[0].Value)
+
+	code, ok := errorsCount.DataPoints[0].Attributes.Value(otelzulip.CodeKey)
+	require.True(t, ok)
+	assert.Equal(t, "BAD_REQUEST", code.AsString())
+}
+
+func TestMiddlewareEventQueueLongPoll(t *testing.T) {
+	client, spanRecorder, _ := newInstrumentedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": "", "events": [{"id": 5, "type": "heartbeat"}], "queue_id": "abc"}`))
+	})
+
+	realtimeSvc := realtime.NewService(client)
+
+	_, err := realtimeSvc.GetEventsEventQueue(context.TODO(), "abc", realtime.LastEventID(4))
+	require.NoError(t, err)
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "zulip events long poll", spans[0].Name())
+
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "abc", attrs[otelzulip.QueueIDKey].AsString())
+	assert.Equal(t, int64(4), attrs[otelzulip.LastEventIDKey].AsInt64())
+	assert.Equal(t, int64(1), attrs[otelzulip.EventsCountKey].AsInt64())
+}
+
+func TestPathTemplate(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/messages":                  "/api/v1/messages",
+		"/api/v1/messages/42/reactions":     "/api/v1/messages/{id}/reactions",
+		"/api/v1/users/1/subscriptions/2":   "/api/v1/users/{id}/subscriptions/{id}",
+		"/api/v1/users/iago@zulip.com":      "/api/v1/users/{email}",
+		"/api/v1/users/iago%40zulip.com/me": "/api/v1/users/{email}/me",
+		"/api/v1/users/me/status":           "/api/v1/users/me/status",
+	}
+
+	for path, expected := range cases {
+		assert.Equal(t, expected, otelzulip.PathTemplate(path))
+	}
+}
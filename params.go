@@ -0,0 +1,103 @@
+package zulip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// ParamEncoder is implemented by values that know how to encode themselves
+// as a request parameter, for example a narrow.Filter.
+type ParamEncoder interface {
+	EncodeParam() (string, error)
+}
+
+// RepeatedParam is a request parameter sent once per value, with the same
+// key: a=1&a=2. Each value is encoded as any other parameter.
+type RepeatedParam []any
+
+// encodeParams encodes the request data following Zulip's conventions:
+//   - strings and numbers as they are
+//   - booleans as true or false
+//   - ParamEncoder values with their own encoding
+//   - slices, arrays, maps, structs and json.Marshaler values as JSON
+//   - pointers as the value they point to, nil as null
+//   - RepeatedParam values as repeated keys
+func encodeParams(data map[string]any) (url.Values, error) {
+	values := url.Values{}
+
+	for k, v := range data {
+		if repeated, ok := v.(RepeatedParam); ok {
+			for _, item := range repeated {
+				encoded, err := encodeParam(item)
+				if err != nil {
+					return nil, fmt.Errorf("encoding parameter %q: %w", k, err)
+				}
+
+				values.Add(k, encoded)
+			}
+
+			continue
+		}
+
+		encoded, err := encodeParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("encoding parameter %q: %w", k, err)
+		}
+
+		values.Set(k, encoded)
+	}
+
+	return values, nil
+}
+
+func encodeParam(v any) (string, error) {
+	switch p := v.(type) {
+	case nil:
+		return "null", nil
+	case ParamEncoder:
+		return p.EncodeParam()
+	case string:
+		return p, nil
+	case bool:
+		return strconv.FormatBool(p), nil
+	case json.Marshaler:
+		return encodeJSON(p)
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return "null", nil
+		}
+
+		return encodeParam(rv.Elem().Interface())
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return encodeJSON(v)
+	default:
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+func encodeJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,113 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/narrow"
+)
+
+type role int
+
+type flag string
+
+type upperParam string
+
+func (u upperParam) EncodeParam() (string, error) {
+	return "UPPER:" + string(u), nil
+}
+
+func newParamsServer(t *testing.T, received *url.Values) *httptest.Server {
+	t.Helper()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		*received = r.Form
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": ""}`))
+	}))
+	t.Cleanup(mockServer.Close)
+
+	return mockServer
+}
+
+func TestDoRequestEncodesParams(t *testing.T) {
+	var received url.Values
+
+	mockServer := newParamsServer(t, &received)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	gravatar := true
+
+	var noLimit *int
+
+	data := map[string]any{
+		"content":     "hello",
+		"read":        false,
+		"gravatar":    &gravatar,
+		"limit":       noLimit,
+		"num_before":  10,
+		"ratio":       0.5,
+		"role":        role(400),
+		"flag":        flag("read"),
+		"to":          []int{1, 2, 3},
+		"emails":      []string{"iago@zulip.com"},
+		"profile":     map[string]string{"4": "0"},
+		"subscribe":   []struct{ Name string }{{Name: "general"}},
+		"narrow":      narrow.NewFilter().Add(narrow.New(narrow.Channel, "Verona")),
+		"custom":      upperParam("value"),
+		"message_ids": zulip.RepeatedParam{1, 2},
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		t.Run(method, func(t *testing.T) {
+			var resp zulip.APIResponseBase
+
+			require.NoError(t, client.DoRequest(context.TODO(), method, "/api/v1/test", data, &resp))
+
+			assert.Equal(t, url.Values{
+				"content":     {"hello"},
+				"read":        {"false"},
+				"gravatar":    {"true"},
+				"limit":       {"null"},
+				"num_before":  {"10"},
+				"ratio":       {"0.5"},
+				"role":        {"400"},
+				"flag":        {"read"},
+				"to":          {"[1,2,3]"},
+				"emails":      {`["iago@zulip.com"]`},
+				"profile":     {`{"4":"0"}`},
+				"subscribe":   {`[{"Name":"general"}]`},
+				"narrow":      {`[{"operator":"channel","operand":"Verona","negated":false}]`},
+				"custom":      {"UPPER:value"},
+				"message_ids": {"1", "2"},
+			}, received)
+		})
+	}
+}
+
+func TestDoRequestUnsupportedParam(t *testing.T) {
+	var received url.Values
+
+	mockServer := newParamsServer(t, &received)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodPost, "/api/v1/test", map[string]any{
+		"callback": func() {},
+	}, &resp)
+	require.ErrorContains(t, err, `encoding parameter "callback"`)
+	assert.Nil(t, received)
+}
@@ -0,0 +1,302 @@
+package zulip
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitClassDefault is the bucket every request is accounted in unless a
+// classifier says otherwise.
+const RateLimitClassDefault = "default"
+
+// Endpoint classes of RateLimitEndpointClass.
+const (
+	RateLimitClassMessages = "messages"
+	RateLimitClassUploads  = "uploads"
+)
+
+// RateLimitBudget is the current request budget of a rate limit bucket as
+// last reported by the server and consumed by the client since then.
+type RateLimitBudget struct {
+	// Limit is the burst size reported by the server (X-RateLimit-Limit).
+	Limit int
+	// Remaining is the number of requests that can be sent right now
+	// without waiting.
+	Remaining int
+	// Reset is the time at which the server reported the bucket will be
+	// full again (X-RateLimit-Reset).
+	Reset time.Time
+}
+
+// RateLimiter paces outgoing requests with a token bucket per endpoint class,
+// fed by the X-RateLimit-* headers returned by the server, so the client
+// avoids hitting the server rate limits in the first place.
+//
+// A RateLimiter is safe for concurrent use and can be shared by several
+// clients authenticated as the same user.
+type RateLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*rateLimitBucket
+	classify func(method, path string) string
+
+	initialLimit  int
+	initialWindow time.Duration
+}
+
+type rateLimiterOptions struct {
+	classify      func(method, path string) string
+	initialLimit  int
+	initialWindow time.Duration
+}
+
+type RateLimiterOption func(*rateLimiterOptions) error
+
+// RateLimitClassifier sets the function that assigns every request to a
+// bucket, so different endpoint classes (e.g. file uploads and messages) are
+// paced independently.
+func RateLimitClassifier(classify func(method, path string) string) RateLimiterOption {
+	return func(o *rateLimiterOptions) error {
+		if classify == nil {
+			return errors.New("rate limit classifier is nil")
+		}
+
+		o.classify = classify
+
+		return nil
+	}
+}
+
+// RateLimitEndpointClass is a classifier, see RateLimitClassifier, pacing the
+// file uploads (RateLimitClassUploads), the messages (RateLimitClassMessages)
+// and every other request (RateLimitClassDefault) independently.
+func RateLimitEndpointClass(method, path string) string {
+	if u, err := url.Parse(path); err == nil {
+		// absolute URLs, like the ones of resumable uploads
+		path = u.Path
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/api/v1/user_uploads"),
+		strings.HasPrefix(path, "/api/v1/tus"),
+		method == http.MethodPost && strings.HasPrefix(path, "/api/v1/realm/emoji/"):
+		return RateLimitClassUploads
+	case strings.HasPrefix(path, "/api/v1/messages"):
+		return RateLimitClassMessages
+	default:
+		return RateLimitClassDefault
+	}
+}
+
+// RateLimitInitial sets the budget used for a bucket before the server has
+// reported any rate limit headers for it. By default requests are not paced
+// until the first response is received.
+func RateLimitInitial(limit int, window time.Duration) RateLimiterOption {
+	return func(o *rateLimiterOptions) error {
+		if limit < 1 || window <= 0 {
+			return errors.New("initial rate limit and window must be positive")
+		}
+
+		o.initialLimit = limit
+		o.initialWindow = window
+
+		return nil
+	}
+}
+
+// NewRateLimiter creates a new RateLimiter.
+func NewRateLimiter(options ...RateLimiterOption) (*RateLimiter, error) {
+	opts := rateLimiterOptions{
+		classify: func(string, string) string { return RateLimitClassDefault },
+	}
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RateLimiter{
+		buckets:       map[string]*rateLimitBucket{},
+		classify:      opts.classify,
+		initialLimit:  opts.initialLimit,
+		initialWindow: opts.initialWindow,
+	}, nil
+}
+
+// WithRateLimiter paces the requests sent by the client using the given
+// limiter. The same limiter is used by every service built on the client.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(o *clientOptions) error {
+		if limiter == nil {
+			return errors.New("rate limiter is nil")
+		}
+
+		o.rateLimiter = limiter
+
+		return nil
+	}
+}
+
+// Budget returns the current budget of the given bucket class. The second
+// value is false when nothing is known about the class yet.
+func (r *RateLimiter) Budget(class string) (RateLimitBudget, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[class]
+	if !ok {
+		return RateLimitBudget{}, false
+	}
+
+	return b.budget(time.Now()), true
+}
+
+// Budgets returns the current budget of every known bucket class.
+func (r *RateLimiter) Budgets() map[string]RateLimitBudget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	budgets := make(map[string]RateLimitBudget, len(r.buckets))
+	for class, b := range r.buckets {
+		budgets[class] = b.budget(now)
+	}
+
+	return budgets
+}
+
+// Wait blocks until the request can be sent without exceeding the rate limit
+// of its class, or the context is done.
+func (r *RateLimiter) Wait(ctx context.Context, method, path string) error {
+	if r == nil {
+		return nil
+	}
+
+	class := r.classify(method, path)
+
+	r.mu.Lock()
+	delay := r.bucket(class).take(time.Now())
+	r.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Update adjusts the bucket of the request class with the rate limit headers
+// of its response.
+func (r *RateLimiter) Update(method, path string, headers http.Header) {
+	if r == nil {
+		return
+	}
+
+	limit, errLimit := strconv.Atoi(headers.Get(XRateLimitLimit))
+	remaining, errRemaining := strconv.Atoi(headers.Get(XRateLimitRemaining))
+	reset, errReset := strconv.ParseFloat(headers.Get(XRateLimitReset), 64)
+
+	if errLimit != nil || errRemaining != nil || errReset != nil || limit < 1 {
+		return
+	}
+
+	class := r.classify(method, path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bucket(class).update(limit, remaining, time.Unix(0, int64(reset*float64(time.Second))), time.Now())
+}
+
+// bucket returns the bucket of the class, creating it if needed. It must be
+// called with the lock held.
+func (r *RateLimiter) bucket(class string) *rateLimitBucket {
+	b, ok := r.buckets[class]
+	if !ok {
+		b = &rateLimitBucket{last: time.Now()}
+		if r.initialLimit > 0 {
+			b.limit = float64(r.initialLimit)
+			b.tokens = b.limit
+			b.rate = b.limit / r.initialWindow.Seconds()
+		}
+
+		r.buckets[class] = b
+	}
+
+	return b
+}
+
+// rateLimitBucket is a token bucket refilled at a constant rate. Tokens can go
+// below zero: every caller reserves its token and waits until it would have
+// been refilled.
+type rateLimitBucket struct {
+	limit  float64
+	tokens float64
+	rate   float64 // tokens per second
+	last   time.Time
+	reset  time.Time
+}
+
+func (b *rateLimitBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.limit, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take reserves a token and returns how long to wait before using it.
+func (b *rateLimitBucket) take(now time.Time) time.Duration {
+	if b.limit == 0 || b.rate == 0 {
+		// nothing known about the limits yet
+		return 0
+	}
+
+	b.refill(now)
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *rateLimitBucket) update(limit, remaining int, reset, now time.Time) {
+	b.limit = float64(limit)
+	b.tokens = float64(remaining)
+	b.last = now
+	b.reset = reset
+
+	// the server refills the whole budget by the reset time, without a
+	// window to refill the rate is left as it is
+	if untilReset := reset.Sub(now).Seconds(); untilReset > 0 && remaining < limit {
+		b.rate = float64(limit-remaining) / untilReset
+	}
+}
+
+func (b *rateLimitBucket) budget(now time.Time) RateLimitBudget {
+	if b.limit > 0 {
+		b.refill(now)
+	}
+
+	return RateLimitBudget{
+		Limit:     int(b.limit),
+		Remaining: max(int(b.tokens), 0),
+		Reset:     b.reset,
+	}
+}
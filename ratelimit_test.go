@@ -0,0 +1,193 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestRateLimiterPacesRequests(t *testing.T) {
+	// The server reports an exhausted budget of 10 requests that will be
+	// fully refilled in one second: one request every 100ms.
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(zulip.XRateLimitLimit, "10")
+		w.Header().Set(zulip.XRateLimitRemaining, "0")
+		w.Header().Set(zulip.XRateLimitReset, strconv.FormatFloat(float64(time.Now().Add(time.Second).UnixMilli())/1000, 'f', 3, 64))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	limiter, err := zulip.NewRateLimiter()
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRateLimiter(limiter),
+	)
+	require.NoError(t, err)
+
+	_, known := limiter.Budget(zulip.RateLimitClassDefault)
+	assert.False(t, known)
+
+	var resp zulip.APIResponseBase
+
+	// first request is not paced, nothing is known yet
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp))
+
+	budget, known := limiter.Budget(zulip.RateLimitClassDefault)
+	require.True(t, known)
+	assert.Equal(t, 10, budget.Limit)
+	assert.Equal(t, 0, budget.Remaining)
+	assert.WithinDuration(t, time.Now().Add(time.Second), budget.Reset, 200*time.Millisecond)
+
+	start := time.Now()
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp))
+
+	assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+}
+
+func TestRateLimiterWithoutWindow(t *testing.T) {
+	// The server reports an exhausted budget with a reset time already
+	// passed: there is no window to derive the refill rate from.
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(zulip.XRateLimitLimit, "10")
+		w.Header().Set(zulip.XRateLimitRemaining, "0")
+		w.Header().Set(zulip.XRateLimitReset, strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	limiter, err := zulip.NewRateLimiter()
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRateLimiter(limiter),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp))
+
+	start := time.Now()
+
+	for range 5 {
+		require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp))
+	}
+
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRateLimitEndpointClass(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		class  string
+	}{
+		{http.MethodPost, "/api/v1/user_uploads", zulip.RateLimitClassUploads},
+		{http.MethodGet, "/api/v1/user_uploads/1/ab/file.txt", zulip.RateLimitClassUploads},
+		{http.MethodPost, "/api/v1/tus", zulip.RateLimitClassUploads},
+		{http.MethodPatch, "https://chat.example.com/api/v1/tus/c3f4", zulip.RateLimitClassUploads},
+		{http.MethodPost, "/api/v1/realm/emoji/smile", zulip.RateLimitClassUploads},
+		{http.MethodDelete, "/api/v1/realm/emoji/smile", zulip.RateLimitClassDefault},
+		{http.MethodPost, "/api/v1/messages", zulip.RateLimitClassMessages},
+		{http.MethodPatch, "/api/v1/messages/42", zulip.RateLimitClassMessages},
+		{http.MethodGet, "/api/v1/users", zulip.RateLimitClassDefault},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, zulip.RateLimitEndpointClass(tt.method, tt.path), tt.method+" "+tt.path)
+	}
+}
+
+func TestRateLimiterConcurrentServices(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(zulip.XRateLimitLimit, "1000")
+		w.Header().Set(zulip.XRateLimitRemaining, "900")
+		w.Header().Set(zulip.XRateLimitReset, strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	limiter, err := zulip.NewRateLimiter(
+		zulip.RateLimitClassifier(zulip.RateLimitEndpointClass),
+	)
+	require.NoError(t, err)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRateLimiter(limiter),
+	)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			var resp zulip.APIResponseBase
+			assert.NoError(t, client.DoRequest(context.TODO(), http.MethodPost, "/api/v1/messages", nil, &resp))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			var resp zulip.APIResponseBase
+			assert.NoError(t, client.DoFileRequest(context.TODO(), http.MethodPost, "/api/v1/user_uploads", "file.txt", strings.NewReader("content"), &resp))
+		}()
+	}
+
+	wg.Wait()
+
+	budgets := limiter.Budgets()
+	assert.Len(t, budgets, 2)
+	assert.Equal(t, 1000, budgets[zulip.RateLimitClassUploads].Limit)
+	assert.Equal(t, 1000, budgets[zulip.RateLimitClassMessages].Limit)
+}
+
+func TestRateLimiterInitialBudget(t *testing.T) {
+	limiter, err := zulip.NewRateLimiter(zulip.RateLimitInitial(2, time.Second))
+	require.NoError(t, err)
+
+	// the burst is allowed straight away
+	require.NoError(t, limiter.Wait(context.TODO(), http.MethodGet, "/endpoint"))
+	require.NoError(t, limiter.Wait(context.TODO(), http.MethodGet, "/endpoint"))
+
+	budget, known := limiter.Budget(zulip.RateLimitClassDefault)
+	require.True(t, known)
+	assert.Equal(t, 2, budget.Limit)
+	assert.Equal(t, 0, budget.Remaining)
+
+	// the third one has to wait for a token to be refilled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, limiter.Wait(ctx, http.MethodGet, "/endpoint"), context.DeadlineExceeded)
+}
+
+func TestRateLimiterInvalidOptions(t *testing.T) {
+	_, err := zulip.NewRateLimiter(zulip.RateLimitInitial(0, time.Second))
+	require.Error(t, err)
+
+	_, err = zulip.NewRateLimiter(zulip.RateLimitClassifier(nil))
+	require.Error(t, err)
+
+	_, err = zulip.NewClient(zulip.Credentials("http://localhost", "email@test", "apikey"),
+		zulip.WithRateLimiter(nil),
+	)
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package zulip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrForeignURL is returned by DoRawRequest for the absolute URLs of another
+// site, the credentials of the client are never sent to them.
+var ErrForeignURL = errors.New("url is not of the client site")
+
+// RawRequester is implemented by clients able to send requests that are not
+// encoded as Zulip's REST API does, like the tus resumable upload protocol.
+type RawRequester interface {
+	DoRawRequest(ctx context.Context, method, path string, header http.Header, body io.Reader, opts ...DoRequestOption) (*http.Response, error)
+}
+
+var _ RawRequester = (*Client)(nil)
+
+// DoRawRequest sends body as is with the given headers, authenticated like
+// any other request, and returns the HTTP response without decoding it. path
+// is either relative to the site or an absolute URL of the same site, see
+// ErrForeignURL.
+//
+// The response body is fully read before returning, it does not need to be
+// closed. Requests are not retried nor sent through the middleware chain,
+// but they wait for the rate limiter. The credentials are not refreshed on
+// unauthorized responses, see WithCredentialsRefresh.
+func (c *Client) DoRawRequest(ctx context.Context, method, path string, header http.Header, body io.Reader, opts ...DoRequestOption) (*http.Response, error) {
+	options := clientSendRequestOptions{
+		timeout: RESTClientDefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	fullURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		fullURL = c.baseURL + path
+	} else if !c.sameSite(path) {
+		return nil, fmt.Errorf("%w: %s", ErrForeignURL, path)
+	}
+
+	reqLog := c.logger.With(slog.String("request_id", uuid.New().String()))
+
+	if err := c.rateLimiter.Wait(ctx, method, path); err != nil {
+		return nil, err
+	}
+
+	reqCtx, reqCancel := withTimeout(ctx, options.timeout)
+	defer reqCancel()
+
+	bodySize := int64(-1)
+	if body != nil {
+		bodySize = readerSize(body)
+		body = &progressReader{
+			reader:   &contextReader{ctx: reqCtx, reader: body},
+			total:    bodySize,
+			progress: options.progress,
+		}
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, method, fullURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating send request: %w", err)
+	}
+
+	if bodySize >= 0 {
+		req.ContentLength = bodySize
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	auth := c.currentAuth(ctx, reqLog)
+	req.SetBasicAuth(auth.email, auth.apiKey)
+
+	reqLog.DebugContext(ctx, "Sending raw request",
+		slog.String("method", method),
+		slog.String("url", fullURL),
+		slog.Int64("content_length", bodySize))
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	defer func() { _ = httpResp.Body.Close() }()
+
+	c.rateLimiter.Update(method, path, httpResp.Header)
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	httpResp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	reqLog.DebugContext(ctx, "Received raw response",
+		slog.Int("status_code", httpResp.StatusCode))
+
+	return httpResp, nil
+}
+
+// sameSite tells whether the absolute URL rawURL has the scheme and host of
+// the site of the client.
+func (c *Client) sameSite(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	site, err := url.Parse(c.baseURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Scheme, site.Scheme) &&
+		strings.EqualFold(u.Hostname(), site.Hostname()) &&
+		urlPort(u) == urlPort(site)
+}
+
+// urlPort returns the port of u, the default one of its scheme if none.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+
+	return "80"
+}
@@ -0,0 +1,57 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestDoRawRequest(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "email@test", user)
+		assert.Equal(t, "apikey", password)
+		assert.Equal(t, "1.0.0", r.Header.Get("Tus-Resumable"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("Tus-Resumable", "1.0.0")
+
+	// relative to the site
+	resp, err := client.DoRawRequest(context.Background(), http.MethodPatch, "/api/v1/tus/1", header, strings.NewReader("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// absolute URL of the site
+	resp, err = client.DoRawRequest(context.Background(), http.MethodHead, mockServer.URL+"/api/v1/tus/1", header, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestDoRawRequestForeignURL(t *testing.T) {
+	client, err := zulip.NewClient(zulip.Credentials("https://chat.example.com", "email@test", "apikey"))
+	require.NoError(t, err)
+
+	for _, url := range []string{
+		"https://attacker.example/api/v1/tus/1",
+		"http://chat.example.com/api/v1/tus/1",
+		"https://chat.example.com:8443/api/v1/tus/1",
+		"https://chat.example.com.attacker.example/api/v1/tus/1",
+	} {
+		_, err := client.DoRawRequest(context.Background(), http.MethodHead, url, nil, nil)
+		require.ErrorIs(t, err, zulip.ErrForeignURL, url)
+	}
+}
@@ -0,0 +1,359 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+const (
+	// ConsumerDefaultMinBackoff and ConsumerDefaultMaxBackoff are the bounds
+	// of the backoff of the consumer, see ConsumerBackoff.
+	ConsumerDefaultMinBackoff = time.Second
+	ConsumerDefaultMaxBackoff = time.Minute
+	// ConsumerDeleteTimeout bounds the deletion of the event queue when the
+	// consumer stops.
+	ConsumerDeleteTimeout = 5 * time.Second
+)
+
+// EventHandler handles the events received by a Consumer. Returning an error
+// stops the consumer.
+type EventHandler func(ctx context.Context, event events.Event) error
+
+type consumerOptions struct {
+	registerOptions []RegisterEventQueueOption
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	onRegister      func(context.Context, *RegisterEventQueueResponse) error
+	heartbeats      bool
+	logger          *slog.Logger
+}
+
+type ConsumerOption func(*consumerOptions)
+
+// ConsumerRegisterOptions sets the options used to register the event queue,
+// every time it is registered.
+func ConsumerRegisterOptions(options ...RegisterEventQueueOption) ConsumerOption {
+	return func(co *consumerOptions) {
+		co.registerOptions = options
+	}
+}
+
+// ConsumerBackoff sets the bounds of the exponential backoff between the
+// attempts to register the event queue or get its events after a failure.
+func ConsumerBackoff(minBackoff, maxBackoff time.Duration) ConsumerOption {
+	return func(co *consumerOptions) {
+		co.minBackoff = minBackoff
+		co.maxBackoff = max(minBackoff, maxBackoff)
+	}
+}
+
+// ConsumerOnRegister calls fn every time the event queue is registered,
+// including after it expired. The events sent meanwhile are lost, fn can
+// fetch again the state they would have updated. An error stops the
+// consumer.
+func ConsumerOnRegister(fn func(ctx context.Context, queue *RegisterEventQueueResponse) error) ConsumerOption {
+	return func(co *consumerOptions) {
+		co.onRegister = fn
+	}
+}
+
+// ConsumerHeartbeats also passes the heartbeat events to the handler.
+func ConsumerHeartbeats() ConsumerOption {
+	return func(co *consumerOptions) {
+		co.heartbeats = true
+	}
+}
+
+// ConsumerLogger sets the logger of the consumer, reporting the queue
+// registrations and the failures it recovers from.
+func ConsumerLogger(logger *slog.Logger) ConsumerOption {
+	return func(co *consumerOptions) {
+		co.logger = logger
+	}
+}
+
+// Consumer receives the events of an event queue: it registers the queue,
+// long polls its events and keeps track of the last one handled.
+//
+// When the queue is garbage collected by the server, or lost in a restart,
+// a new queue is registered transparently. Failed requests are retried with
+// an exponential backoff.
+type Consumer struct {
+	svc  *Service
+	opts consumerOptions
+
+	mu          sync.Mutex
+	queueID     string
+	lastEventID int
+}
+
+// NewConsumer creates a consumer of the event queues of svc, see Run.
+func NewConsumer(svc *Service, options ...ConsumerOption) *Consumer {
+	opts := consumerOptions{
+		minBackoff: ConsumerDefaultMinBackoff,
+		maxBackoff: ConsumerDefaultMaxBackoff,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return &Consumer{svc: svc, opts: opts, lastEventID: -1}
+}
+
+// QueueID returns the ID of the current event queue, empty when none is
+// registered.
+func (c *Consumer) QueueID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queueID
+}
+
+// LastEventID returns the ID of the last event handled.
+func (c *Consumer) LastEventID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastEventID
+}
+
+// Run passes the events to handle until ctx is done or an error can not be
+// recovered from, and deletes the event queue before returning. Events are
+// handled one at a time, in order.
+//
+// It returns the error of the handler, of the ConsumerOnRegister function,
+// the non retryable errors of the server or ctx.Err().
+func (c *Consumer) Run(ctx context.Context, handle EventHandler) error {
+	defer c.deleteQueue(ctx)
+
+	failures := 0
+
+	for {
+		queueID, lastEventID := c.QueueID(), c.LastEventID()
+
+		if queueID == "" {
+			err := c.register(ctx)
+			if err == nil {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if !retryable(err) {
+				return err
+			}
+
+			failures++
+			c.opts.logger.WarnContext(ctx, "Registering event queue failed", slog.Any("error", err))
+
+			if err := c.backoff(ctx, failures); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		resp, err := c.svc.GetEventsEventQueue(ctx, queueID, LastEventID(lastEventID))
+		if err == nil {
+			err = zulip.ResponseError(resp)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			failures++
+
+			if errors.Is(err, zulip.ErrBadEventQueueID) {
+				c.opts.logger.InfoContext(ctx, "Event queue expired", slog.String("queue_id", queueID))
+				c.setQueue("", -1)
+
+				// the first registration is immediate, a server losing the
+				// queues again and again is not hammered
+				if failures == 1 {
+					continue
+				}
+			} else if !retryable(err) {
+				return err
+			} else {
+				c.opts.logger.WarnContext(ctx, "Getting events failed", slog.Any("error", err))
+			}
+
+			if err := c.backoff(ctx, failures); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		failures = 0
+
+		for _, event := range resp.Events {
+			if event.EventType() != events.HeartbeatType || c.opts.heartbeats {
+				if err := handle(ctx, event); err != nil {
+					return err
+				}
+			}
+
+			c.setLastEventID(event.EventID())
+		}
+	}
+}
+
+// register registers a new event queue.
+func (c *Consumer) register(ctx context.Context) error {
+	queue, err := c.svc.RegisterEvetQueue(ctx, c.opts.registerOptions...)
+	if err == nil {
+		err = zulip.ResponseError(queue)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.opts.logger.InfoContext(ctx, "Event queue registered",
+		slog.String("queue_id", queue.QueueID),
+		slog.Int("last_event_id", queue.LastEventID))
+
+	c.setQueue(queue.QueueID, queue.LastEventID)
+
+	if c.opts.onRegister != nil {
+		if err := c.opts.onRegister(ctx, queue); err != nil {
+			return &onRegisterError{err: err}
+		}
+	}
+
+	return nil
+}
+
+// deleteQueue deletes the event queue, even when ctx is done.
+func (c *Consumer) deleteQueue(ctx context.Context) {
+	queueID := c.QueueID()
+	if queueID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ConsumerDeleteTimeout)
+	defer cancel()
+
+	resp, err := c.svc.DeleteEventQueue(ctx, queueID)
+	if err == nil {
+		err = zulip.ResponseError(resp)
+	}
+
+	if err != nil {
+		c.opts.logger.WarnContext(ctx, "Deleting event queue failed",
+			slog.String("queue_id", queueID),
+			slog.Any("error", err))
+	}
+
+	c.setQueue("", -1)
+}
+
+// backoff waits before the next attempt after the given number of
+// consecutive failures.
+func (c *Consumer) backoff(ctx context.Context, failures int) error {
+	delay := c.opts.minBackoff
+	for i := 1; i < failures && delay < c.opts.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, c.opts.maxBackoff)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Consumer) setQueue(queueID string, lastEventID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queueID, c.lastEventID = queueID, lastEventID
+}
+
+func (c *Consumer) setLastEventID(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if id > c.lastEventID {
+		c.lastEventID = id
+	}
+}
+
+// onRegisterError is an error of the ConsumerOnRegister function, it stops
+// the consumer.
+type onRegisterError struct {
+	err error
+}
+
+func (e *onRegisterError) Error() string {
+	return fmt.Sprintf("on register: %v", e.err)
+}
+
+func (e *onRegisterError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether a request failing with err can be sent again:
+// rate limits, server errors and the network failures that can go away, like
+// timeouts, refused or reset connections and temporary DNS failures. Other
+// errors, like the responses that can not be decoded, the invalid
+// certificates or the invalid site URLs, would fail again.
+func retryable(err error) bool {
+	var (
+		registerErr  *onRegisterError
+		apiErr       *zulip.APIError
+		transportErr *zulip.TransportError
+		urlErr       *url.Error
+		dnsErr       *net.DNSError
+		netErr       net.Error
+	)
+
+	switch {
+	case errors.As(err, &registerErr):
+		return false
+	case errors.As(err, &apiErr):
+		return errors.Is(err, zulip.ErrRateLimited) || apiErr.HTTPCode >= 500
+	case errors.As(err, &transportErr):
+		return transportErr.Retryable()
+	}
+
+	// every error of http.Client.Do is a *url.Error, a net.Error itself
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
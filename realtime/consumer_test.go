@@ -0,0 +1,293 @@
+package realtime_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/messages"
+	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/realtime"
+	"github.com/wakumaku/go-zulip/realtime/events"
+	"github.com/wakumaku/go-zulip/zuliptest"
+)
+
+const consumerTimeout = 5 * time.Second
+
+// consumerServer starts a server with a channel to send messages to, and
+// returns the realtime and messages services of a client.
+func consumerServer(t *testing.T) (*zuliptest.Server, *realtime.Service, *messages.Service) {
+	t.Helper()
+
+	srv := zuliptest.NewServer(zuliptest.WithHeartbeatInterval(50 * time.Millisecond))
+	t.Cleanup(srv.Close)
+
+	srv.AddChannel(zuliptest.Channel{Name: "general"})
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	return srv, realtime.NewService(client), messages.NewService(client)
+}
+
+// receive returns the next value of ch, failing the test after a while.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(consumerTimeout):
+		require.FailNow(t, "timeout")
+	}
+
+	var zero T
+
+	return zero
+}
+
+func TestConsumer(t *testing.T) {
+	srv, svc, msgSvc := consumerServer(t)
+
+	registered := make(chan string, 4)
+	received := make(chan events.Event, 4)
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerRegisterOptions(realtime.EventTypes(events.MessageType)),
+		realtime.ConsumerBackoff(time.Millisecond, 10*time.Millisecond),
+		realtime.ConsumerOnRegister(func(_ context.Context, queue *realtime.RegisterEventQueueResponse) error {
+			registered <- queue.QueueID
+			return nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- consumer.Run(ctx, func(_ context.Context, event events.Event) error {
+			received <- event
+			return nil
+		})
+	}()
+
+	send := func(content string) *events.Message {
+		_, err := msgSvc.SendMessageToChannelTopic(ctx, recipient.ToChannel("general"), "greetings", content)
+		require.NoError(t, err)
+
+		message, ok := receive(t, received).(*events.Message)
+		require.True(t, ok)
+
+		return message
+	}
+
+	firstQueue := receive(t, registered)
+	assert.Equal(t, firstQueue, consumer.QueueID())
+
+	message := send("first")
+	assert.Equal(t, "first", message.Message.Content)
+	assert.Eventually(t, func() bool { return consumer.LastEventID() == message.EventID() }, consumerTimeout, 10*time.Millisecond)
+
+	// the expired queue is registered again
+	srv.ExpireEventQueues()
+
+	secondQueue := receive(t, registered)
+	assert.NotEqual(t, firstQueue, secondQueue)
+
+	message = send("second")
+	assert.Equal(t, "second", message.Message.Content)
+
+	cancel()
+	require.ErrorIs(t, receive(t, done), context.Canceled)
+
+	// the queue is deleted on return
+	assert.Empty(t, srv.EventQueues())
+	assert.Empty(t, consumer.QueueID())
+}
+
+func TestConsumerRetries(t *testing.T) {
+	srv, svc, msgSvc := consumerServer(t)
+
+	srv.InjectFault(zuliptest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/api/v1/events",
+		StatusCode: http.StatusBadGateway,
+		Code:       zulip.CodeBadRequest,
+		Msg:        "upstream unavailable",
+		Times:      2,
+	})
+
+	_, err := msgSvc.SendMessageToChannelTopic(context.Background(), recipient.ToChannel("general"), "greetings", "Hello!")
+	require.NoError(t, err)
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerRegisterOptions(realtime.EventTypes(events.MessageType)),
+		realtime.ConsumerBackoff(time.Millisecond, 10*time.Millisecond),
+		realtime.ConsumerOnRegister(func(ctx context.Context, _ *realtime.RegisterEventQueueResponse) error {
+			// only the messages sent after the registration are received
+			_, err := msgSvc.SendMessageToChannelTopic(ctx, recipient.ToChannel("general"), "greetings", "Registered!")
+			return err
+		}),
+	)
+
+	errStop := errors.New("stop")
+
+	err = consumer.Run(context.Background(), func(_ context.Context, event events.Event) error {
+		message, ok := event.(*events.Message)
+		require.True(t, ok)
+		assert.Equal(t, "Registered!", message.Message.Content)
+
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/events"), 3)
+	assert.Empty(t, srv.EventQueues())
+}
+
+func TestConsumerErrors(t *testing.T) {
+	srv, svc, _ := consumerServer(t)
+
+	handle := func(context.Context, events.Event) error { return nil }
+
+	// errors of the server that can not be recovered from
+	srv.InjectFault(zuliptest.Fault{
+		Method:     http.MethodPost,
+		Path:       "/api/v1/register",
+		StatusCode: http.StatusUnauthorized,
+		Code:       zulip.CodeUnauthorized,
+		Msg:        "Invalid API key",
+		Times:      1,
+	})
+
+	err := realtime.NewConsumer(svc).Run(context.Background(), handle)
+	require.ErrorIs(t, err, zulip.ErrUnauthorized)
+
+	// errors of the register function
+	errRegister := errors.New("loading state")
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerOnRegister(func(context.Context, *realtime.RegisterEventQueueResponse) error {
+			return errRegister
+		}),
+	)
+
+	err = consumer.Run(context.Background(), handle)
+	require.ErrorIs(t, err, errRegister)
+	assert.Empty(t, srv.EventQueues())
+
+	// a done context stops the retries
+	srv.InjectFault(zuliptest.Fault{
+		Method:     http.MethodPost,
+		Path:       "/api/v1/register",
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       zulip.CodeBadRequest,
+		Msg:        "maintenance",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = realtime.NewConsumer(svc, realtime.ConsumerBackoff(time.Millisecond, 5*time.Millisecond)).Run(ctx, handle)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Greater(t, len(srv.RequestsTo(http.MethodPost, "/api/v1/register")), 2)
+}
+
+func TestConsumerUnexpectedResponses(t *testing.T) {
+	srv, svc, _ := consumerServer(t)
+
+	handle := func(context.Context, events.Event) error { return nil }
+
+	// an HTML page is not retried, unlike a proxy error while the server
+	// restarts
+	srv.InjectFault(zuliptest.Fault{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/events",
+		StatusCode:  http.StatusNotFound,
+		Body:        "<html>Not Found</html>",
+		ContentType: "text/html",
+		Times:       1,
+	})
+
+	consumer := realtime.NewConsumer(svc, realtime.ConsumerBackoff(time.Millisecond, 5*time.Millisecond))
+
+	err := consumer.Run(context.Background(), handle)
+	require.ErrorIs(t, err, zulip.ErrUnexpectedResponse)
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/events"), 1)
+	assert.Empty(t, srv.EventQueues())
+}
+
+func TestConsumerInvalidSite(t *testing.T) {
+	client, err := zulip.NewClient(zulip.Credentials("htps://zulip.example.com", "bot@zulip.example.com", "apikey"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), consumerTimeout)
+	defer cancel()
+
+	// the request would fail the same way again and again
+	err = realtime.NewConsumer(realtime.NewService(client), realtime.ConsumerBackoff(time.Millisecond, 5*time.Millisecond)).
+		Run(ctx, func(context.Context, events.Event) error { return nil })
+	require.ErrorContains(t, err, "unsupported protocol scheme")
+	require.NoError(t, ctx.Err())
+
+	// unlike a server not listening, as while it restarts
+	srv := zuliptest.NewServer()
+	srv.Close()
+
+	client, err = zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = realtime.NewConsumer(realtime.NewService(client), realtime.ConsumerBackoff(time.Millisecond, 5*time.Millisecond)).
+		Run(ctx, func(context.Context, events.Event) error { return nil })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConsumerUndecodableEvent(t *testing.T) {
+	srv, svc, _ := consumerServer(t)
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerBackoff(time.Millisecond, 5*time.Millisecond),
+		realtime.ConsumerOnRegister(func(context.Context, *realtime.RegisterEventQueueResponse) error {
+			srv.PushEvent(map[string]any{"type": "typing", "op": "start", "recipients": "oops"})
+			srv.PushEvent(map[string]any{"type": "typing", "op": "stop", "sender": map[string]any{"user_id": 8}})
+			return nil
+		}),
+	)
+
+	errStop := errors.New("stop")
+
+	var received []events.Event
+
+	// the event is delivered as an unknown one, not polled again and again
+	err := consumer.Run(context.Background(), func(_ context.Context, event events.Event) error {
+		received = append(received, event)
+		if len(received) == 2 {
+			return errStop
+		}
+
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Len(t, received, 2)
+
+	unknown, ok := received[0].(*events.Unknown)
+	require.True(t, ok)
+	require.ErrorContains(t, unknown.Err, "decoding typing event")
+
+	stop, ok := received[1].(*events.Typing)
+	require.True(t, ok)
+	assert.Equal(t, 8, stop.Sender.UserID)
+
+	assert.Len(t, srv.RequestsTo(http.MethodGet, "/api/v1/events"), 1)
+	assert.Empty(t, srv.EventQueues())
+}
@@ -2,7 +2,6 @@ package realtime
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -18,15 +17,7 @@ type deleteEventQueueData struct {
 }
 
 func (d *DeleteEventQueueResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &d.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &d.deleteEventQueueData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &d.APIResponseBase, &d.deleteEventQueueData)
 }
 
 func (svc *Service) DeleteEventQueue(ctx context.Context, queueID string) (*DeleteEventQueueResponse, error) {
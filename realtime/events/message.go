@@ -15,25 +15,25 @@ type Message struct {
 }
 
 type MessageData struct {
-	ID               int              `json:"id"`
-	Type             string           `json:"type"`
-	AvatarURL        string           `json:"avatar_url"`
-	Client           string           `json:"client"`
-	Content          string           `json:"content"`
-	ContentType      string           `json:"content_type"`
-	DisplayRecipient DisplayRecipient `json:"display_recipient"`
-	IsMeMessage      bool             `json:"is_me_message"`
-	Reactions        []Reaction       `json:"reactions"`
-	RecipientID      int              `json:"recipient_id"`
-	SenderEmail      string           `json:"sender_email"`
-	SenderFullName   string           `json:"sender_full_name"`
-	SenderID         int              `json:"sender_id"`
-	SenderRealmStr   string           `json:"sender_realm_str"`
-	StreamID         int              `json:"stream_id"`
-	Subject          string           `json:"subject"`
-	Submessages      []Submessage     `json:"submessages"`
-	Timestamp        int              `json:"timestamp"`
-	TopicLinks       []TopicLinks     `json:"topic_links"`
+	ID               int               `json:"id"`
+	Type             string            `json:"type"`
+	AvatarURL        string            `json:"avatar_url"`
+	Client           string            `json:"client"`
+	Content          string            `json:"content"`
+	ContentType      string            `json:"content_type"`
+	DisplayRecipient DisplayRecipient  `json:"display_recipient"`
+	IsMeMessage      bool              `json:"is_me_message"`
+	Reactions        []MessageReaction `json:"reactions"`
+	RecipientID      int               `json:"recipient_id"`
+	SenderEmail      string            `json:"sender_email"`
+	SenderFullName   string            `json:"sender_full_name"`
+	SenderID         int               `json:"sender_id"`
+	SenderRealmStr   string            `json:"sender_realm_str"`
+	StreamID         int               `json:"stream_id"`
+	Subject          string            `json:"subject"`
+	Submessages      []Submessage      `json:"submessages"`
+	Timestamp        int               `json:"timestamp"`
+	TopicLinks       []TopicLinks      `json:"topic_links"`
 }
 
 type DisplayRecipient struct {
@@ -68,10 +68,13 @@ func (dr *DisplayRecipient) UnmarshalJSON(b []byte) error {
 	return errors.New("failed to unmarshal DisplayRecipient")
 }
 
-type Reaction struct {
+// MessageReaction is a reaction to a message, see Reaction for the reaction
+// events. It was named Reaction before the reaction events were decoded.
+type MessageReaction struct {
 	EmojiName    string `json:"emoji_name"`
 	EmojiCode    string `json:"emoji_code"`
 	ReactionType string `json:"reaction_type"`
+	UserID       int    `json:"user_id"`
 }
 
 type TopicLinks struct {
@@ -0,0 +1,28 @@
+package events
+
+const ReactionType EventType = "reaction"
+
+// Reaction is sent when a user adds ("add") or removes ("remove") an emoji
+// reaction to a message.
+type Reaction struct {
+	ID           int       `json:"id"`
+	Type         EventType `json:"type"`
+	Op           string    `json:"op"`
+	MessageID    int       `json:"message_id"`
+	UserID       int       `json:"user_id"`
+	EmojiName    string    `json:"emoji_name"`
+	EmojiCode    string    `json:"emoji_code"`
+	ReactionType string    `json:"reaction_type"`
+}
+
+func (e *Reaction) EventID() int {
+	return e.ID
+}
+
+func (e *Reaction) EventType() EventType {
+	return e.Type
+}
+
+func (e *Reaction) EventOp() string {
+	return e.Op
+}
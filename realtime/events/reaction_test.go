@@ -0,0 +1,42 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func TestReaction(t *testing.T) {
+	eventExample := `{
+    "emoji_code": "1f389",
+    "emoji_name": "tada",
+    "id": 0,
+    "message_id": 32,
+    "op": "add",
+    "reaction_type": "unicode_emoji",
+    "type": "reaction",
+    "user": {
+        "email": "user10@zulip.testserver",
+        "full_name": "King Hamlet",
+        "user_id": 10
+    },
+    "user_id": 10
+}`
+
+	v := events.Reaction{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, v.EventID())
+	assert.Equal(t, events.ReactionType, v.EventType())
+	assert.Equal(t, "add", v.EventOp())
+
+	assert.Equal(t, 32, v.MessageID)
+	assert.Equal(t, 10, v.UserID)
+	assert.Equal(t, "tada", v.EmojiName)
+	assert.Equal(t, "1f389", v.EmojiCode)
+	assert.Equal(t, "unicode_emoji", v.ReactionType)
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Factory returns an empty event to decode the JSON of an event into.
+type Factory func() Event
+
+var registry = struct {
+	sync.RWMutex
+	factories map[EventType]Factory
+}{
+	factories: map[EventType]Factory{
+		AlertWordsType:          func() Event { return &AlertWords{} },
+		AttachmentType:          func() Event { return &Attachment{} },
+		CustomProfileFieldsType: func() Event { return &CustomProfileFields{} },
+		DeleteMessageType:       func() Event { return &DeleteMessage{} },
+		HeartbeatType:           func() Event { return &Heartbeat{} },
+		MessageType:             func() Event { return &Message{} },
+		PresenceType:            func() Event { return &Presence{} },
+		ReactionType:            func() Event { return &Reaction{} },
+		RealmEmojiType:          func() Event { return &RealmEmoji{} },
+		RealmUserType:           func() Event { return &RealmUser{} },
+		StreamType:              func() Event { return &Stream{} },
+		SubmessageType:          func() Event { return &Submessage{} },
+		SubscriptionType:        func() Event { return &Subscription{} },
+		TypingType:              func() Event { return &Typing{} },
+		UpdateMessageFlagsType:  func() Event { return &UpdateMessageFlags{} },
+		UpdateMessageType:       func() Event { return &UpdateMessage{} },
+		UserStatusType:          func() Event { return &UserStatus{} },
+	},
+}
+
+// Register sets the factory of the events of the given type, used by Decode
+// and so by the realtime package, replacing the previous one. It lets
+// applications decode the event types the library does not model:
+//
+//	events.Register("realm_linkifiers", func() events.Event { return &RealmLinkifiers{} })
+//
+// It panics if factory is nil.
+func Register(eventType EventType, factory Factory) {
+	if factory == nil {
+		panic("events: Register factory is nil for " + string(eventType))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.factories[eventType] = factory
+}
+
+// New returns an empty event of the given type, an Unknown one when the type
+// is not registered.
+func New(eventType EventType) Event {
+	registry.RLock()
+	factory, found := registry.factories[eventType]
+	registry.RUnlock()
+
+	if !found {
+		return &Unknown{}
+	}
+
+	return factory()
+}
+
+// Decode decodes the JSON of an event into the type registered for its type
+// field, see New. The events the decoder fails to decode are returned as an
+// Unknown one holding the error, the others of a batch being still usable.
+func Decode(raw []byte) (Event, error) {
+	var peek struct {
+		Type *string `json:"type"`
+	}
+
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field == "type" {
+			return nil, errors.New("type is not a string")
+		}
+
+		return nil, err
+	}
+
+	if peek.Type == nil {
+		return nil, errors.New("type field not found")
+	}
+
+	event := New(EventType(*peek.Type))
+	if err := json.Unmarshal(raw, event); err != nil {
+		if _, unknown := event.(*Unknown); unknown {
+			return nil, err
+		}
+
+		fallback := &Unknown{}
+		if err := json.Unmarshal(raw, fallback); err != nil {
+			return nil, err
+		}
+
+		fallback.Err = fmt.Errorf("decoding %s event: %w", *peek.Type, err)
+
+		return fallback, nil
+	}
+
+	return event, nil
+}
@@ -0,0 +1,88 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func TestDecodeBuiltins(t *testing.T) {
+	ev, err := events.Decode([]byte(`{"id":3,"type":"user_status","user_id":10,"status_text":"on vacation"}`))
+	require.NoError(t, err)
+
+	status, ok := ev.(*events.UserStatus)
+	require.True(t, ok)
+	assert.Equal(t, 3, status.EventID())
+	assert.Equal(t, "on vacation", status.StatusText)
+
+	ev, err = events.Decode([]byte(`{"id":4,"type":"custom_profile_fields","fields":[{"id":1,"name":"Phone"}]}`))
+	require.NoError(t, err)
+
+	fields, ok := ev.(*events.CustomProfileFields)
+	require.True(t, ok)
+	assert.Equal(t, "Phone", fields.Fields[0].Name)
+}
+
+// pollVote is an event type decoded by an application.
+type pollVote struct {
+	ID     int              `json:"id"`
+	Type   events.EventType `json:"type"`
+	Option string           `json:"option"`
+}
+
+func (e *pollVote) EventID() int                { return e.ID }
+func (e *pollVote) EventType() events.EventType { return e.Type }
+func (e *pollVote) EventOp() string             { return "vote" }
+
+func TestRegister(t *testing.T) {
+	raw := []byte(`{"id":7,"type":"test_poll_vote","option":"yes"}`)
+
+	ev, err := events.Decode(raw)
+	require.NoError(t, err)
+
+	unknown, ok := ev.(*events.Unknown)
+	require.True(t, ok)
+	assert.Equal(t, 7, unknown.EventID())
+	assert.Equal(t, "yes", unknown.Fields["option"])
+	assert.Equal(t, raw, []byte(unknown.Raw))
+
+	events.Register("test_poll_vote", func() events.Event { return &pollVote{} })
+
+	ev, err = events.Decode(raw)
+	require.NoError(t, err)
+
+	vote, ok := ev.(*pollVote)
+	require.True(t, ok)
+	assert.Equal(t, 7, vote.EventID())
+	assert.Equal(t, "yes", vote.Option)
+
+	// every event gets its own value
+	assert.NotSame(t, vote, events.New("test_poll_vote"))
+
+	assert.Panics(t, func() { events.Register("test_nil", nil) })
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	_, err := events.Decode([]byte(`{"id":1}`))
+	require.EqualError(t, err, "type field not found")
+
+	_, err = events.Decode([]byte(`{"id":1,"type":3}`))
+	require.EqualError(t, err, "type is not a string")
+
+	_, err = events.Decode([]byte(`[]`))
+	require.Error(t, err)
+
+	// the events failing to decode are kept
+	raw := []byte(`{"id":"1","type":"typing"}`)
+
+	ev, err := events.Decode(raw)
+	require.NoError(t, err)
+
+	unknown, ok := ev.(*events.Unknown)
+	require.True(t, ok)
+	require.ErrorContains(t, unknown.Err, "decoding typing event")
+	assert.Equal(t, "1", unknown.Fields["id"])
+	assert.Equal(t, raw, []byte(unknown.Raw))
+}
@@ -0,0 +1,42 @@
+package events
+
+import "github.com/wakumaku/go-zulip/channels"
+
+const StreamType EventType = "stream"
+
+// Stream is sent when channels are created ("create"), archived ("delete")
+// or when a property of a channel changes ("update").
+type Stream struct {
+	ID   int       `json:"id"`
+	Type EventType `json:"type"`
+	Op   string    `json:"op"`
+	// Streams holds the channels created or archived.
+	Streams []channels.ChannelInfo `json:"streams"`
+	// StreamIDs holds the IDs of the channels archived, sent instead of
+	// Streams by the newer servers.
+	StreamIDs []int `json:"stream_ids"`
+
+	// StreamID, Name, Property and Value describe an "update": the
+	// property of the channel and its new value, like "name" when it is
+	// renamed or "invite_only" when its permissions change.
+	StreamID int    `json:"stream_id"`
+	Name     string `json:"name"`
+	Property string `json:"property"`
+	Value    any    `json:"value"`
+	// The fields depending on the property updated, set with it.
+	RenderedDescription        *string `json:"rendered_description"`
+	HistoryPublicToSubscribers *bool   `json:"history_public_to_subscribers"`
+	IsWebPublic                *bool   `json:"is_web_public"`
+}
+
+func (e *Stream) EventID() int {
+	return e.ID
+}
+
+func (e *Stream) EventType() EventType {
+	return e.Type
+}
+
+func (e *Stream) EventOp() string {
+	return e.Op
+}
@@ -0,0 +1,117 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/channels"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func TestStreamCreate(t *testing.T) {
+	eventExample := `{
+    "id": 0,
+    "op": "create",
+    "streams": [
+        {
+            "can_add_subscribers_group": {
+                "direct_members": [10],
+                "direct_subgroups": [11]
+            },
+            "can_remove_subscribers_group": 2,
+            "creator_id": null,
+            "date_created": 1691057093,
+            "description": "",
+            "first_message_id": null,
+            "history_public_to_subscribers": false,
+            "invite_only": true,
+            "is_announcement_only": false,
+            "is_archived": false,
+            "is_web_public": false,
+            "message_retention_days": null,
+            "name": "private",
+            "rendered_description": "",
+            "stream_id": 12,
+            "stream_post_policy": 1,
+            "stream_weekly_traffic": null
+        }
+    ],
+    "type": "stream"
+}`
+
+	v := events.Stream{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, v.EventID())
+	assert.Equal(t, events.StreamType, v.EventType())
+	assert.Equal(t, "create", v.EventOp())
+
+	require.Len(t, v.Streams, 1)
+	assert.Equal(t, 12, v.Streams[0].StreamID)
+	assert.Equal(t, "private", v.Streams[0].Name)
+	assert.True(t, v.Streams[0].InviteOnly)
+
+	// the group settings of Zulip 10 are either a group or its members
+	assert.Equal(t, channels.GroupSetting{GroupID: 2}, v.Streams[0].CanRemoveSubscribersGroup)
+	assert.Equal(t, channels.GroupSetting{
+		IsAnonymous:     true,
+		DirectMembers:   []int{10},
+		DirectSubgroups: []int{11},
+	}, v.Streams[0].CanAddSubscribersGroup)
+}
+
+func TestStreamUpdate(t *testing.T) {
+	eventExample := `{
+    "history_public_to_subscribers": false,
+    "id": 0,
+    "is_web_public": false,
+    "name": "test_stream",
+    "op": "update",
+    "property": "invite_only",
+    "stream_id": 11,
+    "type": "stream",
+    "value": true
+}`
+
+	v := events.Stream{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "update", v.EventOp())
+	assert.Equal(t, 11, v.StreamID)
+	assert.Equal(t, "test_stream", v.Name)
+	assert.Equal(t, "invite_only", v.Property)
+	assert.Equal(t, true, v.Value)
+	require.NotNil(t, v.HistoryPublicToSubscribers)
+	assert.False(t, *v.HistoryPublicToSubscribers)
+	assert.Nil(t, v.RenderedDescription)
+}
+
+func TestStreamDelete(t *testing.T) {
+	eventExample := `{
+    "id": 0,
+    "op": "delete",
+    "stream_ids": [
+        12
+    ],
+    "streams": [
+        {
+            "name": "private",
+            "stream_id": 12
+        }
+    ],
+    "type": "stream"
+}`
+
+	v := events.Stream{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "delete", v.EventOp())
+	assert.Equal(t, []int{12}, v.StreamIDs)
+	require.Len(t, v.Streams, 1)
+	assert.Equal(t, "private", v.Streams[0].Name)
+}
@@ -0,0 +1,55 @@
+package events
+
+import "github.com/wakumaku/go-zulip/channels"
+
+const SubscriptionType EventType = "subscription"
+
+// Subscription is sent when the subscriptions of the user change ("add",
+// "remove", "update") or when other users subscribe to or unsubscribe from
+// channels ("peer_add", "peer_remove").
+type Subscription struct {
+	ID   int       `json:"id"`
+	Type EventType `json:"type"`
+	Op   string    `json:"op"`
+	// Subscriptions holds the channels subscribed to ("add") or
+	// unsubscribed from ("remove"), only with their name and ID then.
+	Subscriptions []SubscriptionData `json:"subscriptions"`
+
+	// StreamID, Property and Value describe an "update": the property of
+	// the subscription to a channel and its new value.
+	StreamID int    `json:"stream_id"`
+	Property string `json:"property"`
+	Value    any    `json:"value"`
+
+	// StreamIDs and UserIDs tell the users subscribed to ("peer_add") or
+	// unsubscribed from ("peer_remove") the channels.
+	StreamIDs []int `json:"stream_ids"`
+	UserIDs   []int `json:"user_ids"`
+}
+
+// SubscriptionData is a channel with the settings of the user's
+// subscription to it.
+type SubscriptionData struct {
+	channels.ChannelInfo
+	Color                  string `json:"color"`
+	IsMuted                bool   `json:"is_muted"`
+	PinToTop               bool   `json:"pin_to_top"`
+	DesktopNotifications   *bool  `json:"desktop_notifications"`
+	AudibleNotifications   *bool  `json:"audible_notifications"`
+	PushNotifications      *bool  `json:"push_notifications"`
+	EmailNotifications     *bool  `json:"email_notifications"`
+	WildcardMentionsNotify *bool  `json:"wildcard_mentions_notify"`
+	Subscribers            []int  `json:"subscribers"`
+}
+
+func (e *Subscription) EventID() int {
+	return e.ID
+}
+
+func (e *Subscription) EventType() EventType {
+	return e.Type
+}
+
+func (e *Subscription) EventOp() string {
+	return e.Op
+}
@@ -0,0 +1,118 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func TestSubscriptionAdd(t *testing.T) {
+	eventExample := `{
+    "id": 0,
+    "op": "add",
+    "subscriptions": [
+        {
+            "audible_notifications": null,
+            "can_add_subscribers_group": 3,
+            "can_remove_subscribers_group": {
+                "direct_members": [],
+                "direct_subgroups": [2]
+            },
+            "color": "#76ce90",
+            "creator_id": null,
+            "date_created": 1691057093,
+            "description": "",
+            "desktop_notifications": null,
+            "email_notifications": null,
+            "first_message_id": null,
+            "history_public_to_subscribers": true,
+            "in_home_view": true,
+            "invite_only": false,
+            "is_announcement_only": false,
+            "is_muted": false,
+            "is_web_public": false,
+            "message_retention_days": null,
+            "name": "test_stream",
+            "pin_to_top": false,
+            "push_notifications": null,
+            "rendered_description": "",
+            "stream_id": 9,
+            "stream_post_policy": 1,
+            "stream_weekly_traffic": null,
+            "subscribers": [
+                10
+            ],
+            "wildcard_mentions_notify": null
+        }
+    ],
+    "type": "subscription"
+}`
+
+	v := events.Subscription{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, v.EventID())
+	assert.Equal(t, events.SubscriptionType, v.EventType())
+	assert.Equal(t, "add", v.EventOp())
+
+	require.Len(t, v.Subscriptions, 1)
+
+	sub := v.Subscriptions[0]
+	assert.Equal(t, 9, sub.StreamID)
+	assert.Equal(t, "test_stream", sub.Name)
+	assert.True(t, sub.HistoryPublicToSubscribers)
+	assert.Equal(t, 3, sub.CanAddSubscribersGroup.GroupID)
+	assert.True(t, sub.CanRemoveSubscribersGroup.IsAnonymous)
+	assert.Equal(t, []int{2}, sub.CanRemoveSubscribersGroup.DirectSubgroups)
+	assert.Equal(t, "#76ce90", sub.Color)
+	assert.Nil(t, sub.DesktopNotifications)
+	assert.Equal(t, []int{10}, sub.Subscribers)
+}
+
+func TestSubscriptionUpdate(t *testing.T) {
+	eventExample := `{
+    "id": 0,
+    "op": "update",
+    "property": "pin_to_top",
+    "stream_id": 11,
+    "type": "subscription",
+    "value": true
+}`
+
+	v := events.Subscription{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "update", v.EventOp())
+	assert.Equal(t, 11, v.StreamID)
+	assert.Equal(t, "pin_to_top", v.Property)
+	assert.Equal(t, true, v.Value)
+}
+
+func TestSubscriptionPeerAdd(t *testing.T) {
+	eventExample := `{
+    "id": 0,
+    "op": "peer_add",
+    "stream_ids": [
+        9,
+        12
+    ],
+    "type": "subscription",
+    "user_ids": [
+        12,
+        13
+    ]
+}`
+
+	v := events.Subscription{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "peer_add", v.EventOp())
+	assert.Equal(t, []int{9, 12}, v.StreamIDs)
+	assert.Equal(t, []int{12, 13}, v.UserIDs)
+}
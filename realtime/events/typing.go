@@ -8,6 +8,8 @@ type Typing struct {
 	Op          string      `json:"op"`
 	Recipients  []Recipient `json:"recipients"`
 	Sender      Sender      `json:"sender"`
+	StreamID    int         `json:"stream_id"`
+	Topic       string      `json:"topic"`
 	Type        EventType   `json:"type"`
 }
 
@@ -1,10 +1,42 @@
 package events
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 const UnknownType EventType = "unknown"
 
-type Unknown map[string]any
+// Unknown is an event of a type without a registered decoder, see Register,
+// or that its decoder failed to decode.
+type Unknown struct {
+	// Fields holds the decoded fields of the event, its type and ID among
+	// them.
+	Fields map[string]any
+	// Raw is the event as received, to decode it later.
+	Raw json.RawMessage
+	// Err is the error of the decoder of the event type, if any.
+	Err error
+}
+
+func (e *Unknown) UnmarshalJSON(b []byte) error {
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	e.Fields = fields
+	e.Raw = bytes.Clone(b)
 
+	return nil
+}
+
+// EventID returns the id field of the event, -1 when it has none.
 func (e *Unknown) EventID() int {
+	if id, ok := e.Fields["id"].(float64); ok {
+		return int(id)
+	}
+
 	return -1
 }
 
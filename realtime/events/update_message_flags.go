@@ -0,0 +1,40 @@
+package events
+
+const UpdateMessageFlagsType EventType = "update_message_flags"
+
+// UpdateMessageFlags is sent when the personal flags of messages, like "read"
+// or "starred", are added ("add") or removed ("remove").
+type UpdateMessageFlags struct {
+	ID       int       `json:"id"`
+	Type     EventType `json:"type"`
+	Op       string    `json:"op"`
+	Flag     string    `json:"flag"`
+	Messages []int     `json:"messages"`
+	// All is true when the flag was added to every message, Messages is
+	// then empty.
+	All bool `json:"all"`
+	// MessageDetails describes the messages marked as unread, by message
+	// ID.
+	MessageDetails map[int]MessageDetails `json:"message_details"`
+}
+
+type MessageDetails struct {
+	Type             string `json:"type"`
+	Mentioned        bool   `json:"mentioned"`
+	UserIDs          []int  `json:"user_ids"`
+	StreamID         int    `json:"stream_id"`
+	Topic            string `json:"topic"`
+	UnmutedStreamMsg bool   `json:"unmuted_stream_msg"`
+}
+
+func (e *UpdateMessageFlags) EventID() int {
+	return e.ID
+}
+
+func (e *UpdateMessageFlags) EventType() EventType {
+	return e.Type
+}
+
+func (e *UpdateMessageFlags) EventOp() string {
+	return e.Op
+}
@@ -0,0 +1,82 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func TestUpdateMessageFlags(t *testing.T) {
+	eventExample := `{
+    "all": false,
+    "flag": "starred",
+    "id": 0,
+    "messages": [
+        63
+    ],
+    "op": "add",
+    "operation": "add",
+    "type": "update_message_flags"
+}`
+
+	v := events.UpdateMessageFlags{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, v.EventID())
+	assert.Equal(t, events.UpdateMessageFlagsType, v.EventType())
+	assert.Equal(t, "add", v.EventOp())
+
+	assert.Equal(t, "starred", v.Flag)
+	assert.Equal(t, []int{63}, v.Messages)
+	assert.False(t, v.All)
+}
+
+func TestUpdateMessageFlagsRemoveRead(t *testing.T) {
+	eventExample := `{
+    "all": false,
+    "flag": "read",
+    "id": 0,
+    "message_details": {
+        "60": {
+            "mentioned": true,
+            "type": "stream",
+            "stream_id": 1,
+            "topic": "test",
+            "unmuted_stream_msg": true
+        },
+        "61": {
+            "type": "private",
+            "user_ids": [8, 10]
+        }
+    },
+    "messages": [
+        60,
+        61
+    ],
+    "op": "remove",
+    "operation": "remove",
+    "type": "update_message_flags"
+}`
+
+	v := events.UpdateMessageFlags{}
+	err := json.Unmarshal([]byte(eventExample), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "remove", v.EventOp())
+	assert.Equal(t, "read", v.Flag)
+	assert.Equal(t, []int{60, 61}, v.Messages)
+
+	require.Len(t, v.MessageDetails, 2)
+	assert.Equal(t, events.MessageDetails{
+		Type:             "stream",
+		Mentioned:        true,
+		StreamID:         1,
+		Topic:            "test",
+		UnmutedStreamMsg: true,
+	}, v.MessageDetails[60])
+	assert.Equal(t, []int{8, 10}, v.MessageDetails[61].UserIDs)
+}
@@ -3,7 +3,6 @@ package realtime
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -19,69 +18,28 @@ type getEventsEventQueueData struct {
 	Events []events.Event
 }
 
+// UnmarshalJSON decodes the events in a single pass each: the type of every
+// event is peeked from its raw JSON before decoding it into the type
+// registered for it, see events.Register. The events that can not be decoded
+// are kept as *events.Unknown holding the error.
 func (g *GetEventsEventQueueResponse) UnmarshalJSON(data []byte) error {
-	if err := json.Unmarshal(data, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	eventsMap := struct {
-		Events []map[string]any `json:"events"`
+	rawEvents := struct {
+		Events []json.RawMessage `json:"events"`
 	}{}
 
-	if err := json.Unmarshal(data, &eventsMap); err != nil {
+	if err := zulip.UnmarshalResponse(data, &g.APIResponseBase, &rawEvents); err != nil {
 		return err
 	}
 
-	for _, e := range eventsMap.Events {
-		var itemType events.EventType
-
-		etype, ok := e["type"]
-		if !ok {
-			return errors.New("type field not found")
-		}
-
-		it, ok := etype.(string)
-		if !ok {
-			return errors.New("type is not a string")
-		}
+	g.Events = make([]events.Event, 0, len(rawEvents.Events))
 
-		itemType = events.EventType(it)
-
-		var ev events.Event
-		switch itemType {
-		case events.AlertWordsType:
-			ev = &events.AlertWords{}
-		case events.HeartbeatType:
-			ev = &events.Heartbeat{}
-		case events.MessageType:
-			ev = &events.Message{}
-		case events.AttachmentType:
-			ev = &events.Attachment{}
-		case events.PresenceType:
-			ev = &events.Presence{}
-		case events.RealmEmojiType:
-			ev = &events.RealmEmoji{}
-		case events.RealmUserType:
-			ev = &events.RealmUser{}
-		case events.SubmessageType:
-			ev = &events.Submessage{}
-		case events.TypingType:
-			ev = &events.Typing{}
-		case events.UpdateMessageType:
-			ev = &events.UpdateMessage{}
-		case events.DeleteMessageType:
-			ev = &events.DeleteMessage{}
-		default:
-			ev = &events.Unknown{}
-		}
-
-		itemData, err := json.Marshal(e)
+	for _, raw := range rawEvents.Events {
+		ev, err := events.Decode(raw)
 		if err != nil {
-			return err
-		}
-
-		if err := json.Unmarshal(itemData, ev); err != nil {
-			return err
+			unknown := &events.Unknown{Raw: raw}
+			_ = json.Unmarshal(raw, unknown)
+			unknown.Err = err
+			ev = unknown
 		}
 
 		g.Events = append(g.Events, ev)
@@ -90,6 +48,11 @@ func (g *GetEventsEventQueueResponse) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// EventCount returns the number of events received.
+func (g *GetEventsEventQueueResponse) EventCount() int {
+	return len(g.Events)
+}
+
 type getEventsEventQueueOptions struct {
 	lastEventID int
 	dontBlock   bool
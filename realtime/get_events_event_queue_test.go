@@ -1,6 +1,7 @@
 package realtime
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
 
@@ -55,4 +56,105 @@ func TestGetEventsEventQueueResponse(t *testing.T) {
 	assert.Equal(t, "update", realmEmoji.Op)
 	assert.Equal(t, "green_tick", realmEmoji.RealmEmoji["1"].Name)
 	assert.Equal(t, "/user_avatars/2/emoji/images/2.png", realmEmoji.RealmEmoji["2"].SourceURL)
+
+	unknown := g.Events[12].(*events.Unknown)
+	assert.Equal(t, events.UnknownType, unknown.EventType())
+	assert.Equal(t, "unknown_event_nobody_knows_about", unknown.Fields["type"])
+	assert.JSONEq(t, `{"id":0,"type":"unknown_event_nobody_knows_about"}`, string(unknown.Raw))
+}
+
+func TestGetEventsEventQueueResponseInvalidType(t *testing.T) {
+	g := GetEventsEventQueueResponse{}
+	require.NoError(t, g.UnmarshalJSON([]byte(`{"result":"success","events":[{"id":1},{"id":2,"type":3},{"id":3,"type":"heartbeat"}]}`)))
+	require.Len(t, g.Events, 3)
+
+	// the events that can not be decoded do not reject the others
+	unknown := g.Events[0].(*events.Unknown)
+	require.EqualError(t, unknown.Err, "type field not found")
+	assert.JSONEq(t, `{"id":1}`, string(unknown.Raw))
+	assert.Equal(t, 1, unknown.EventID())
+
+	unknown = g.Events[1].(*events.Unknown)
+	require.EqualError(t, unknown.Err, "type is not a string")
+
+	assert.Equal(t, events.HeartbeatType, g.Events[2].EventType())
+}
+
+// legacyDecodeEvents is the former decoding of the events: each one decoded
+// into a map, encoded again and decoded into its type. Kept to compare.
+func legacyDecodeEvents(data []byte) ([]events.Event, error) {
+	eventsMap := struct {
+		Events []map[string]any `json:"events"`
+	}{}
+
+	if err := json.Unmarshal(data, &eventsMap); err != nil {
+		return nil, err
+	}
+
+	var decoded []events.Event
+
+	for _, e := range eventsMap.Events {
+		it, _ := e["type"].(string)
+		ev := events.New(events.EventType(it))
+
+		itemData, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(itemData, ev); err != nil {
+			return nil, err
+		}
+
+		decoded = append(decoded, ev)
+	}
+
+	return decoded, nil
+}
+
+// BenchmarkGetEventsEventQueueResponse compares the decoding of a batch of
+// events with the former one, e.g.
+//
+//	go test ./realtime -run '^$' -bench GetEventsEventQueueResponse -benchmem
+func BenchmarkGetEventsEventQueueResponse(b *testing.B) {
+	data, err := os.ReadFile("testdata/events.json")
+	require.NoError(b, err)
+
+	b.Run("single-pass", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+
+		for b.Loop() {
+			g := GetEventsEventQueueResponse{}
+			if err := json.Unmarshal(data, &g); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+
+		for b.Loop() {
+			var base legacyAPIResponseBase
+			if err := json.Unmarshal(data, &base); err != nil {
+				b.Fatal(err)
+			}
+
+			if _, err := legacyDecodeEvents(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// legacyAPIResponseBase decodes every field of a response, as
+// zulip.APIResponseBase formerly did.
+type legacyAPIResponseBase struct {
+	fields map[string]any
+}
+
+func (l *legacyAPIResponseBase) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &l.fields)
 }
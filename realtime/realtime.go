@@ -5,6 +5,8 @@
 //   - Get events from event queue (long polling)
 //   - Delete event queue
 //   - Support for various event types (messages, presence, typing, etc.)
+//   - Consumer, keeping an event queue registered and polled
+//   - Router, dispatching the events to typed handlers
 //
 // See https://zulip.com/api/ for the complete API documentation.
 package realtime
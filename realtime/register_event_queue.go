@@ -2,7 +2,6 @@ package realtime
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -26,15 +25,7 @@ type registerEventQueueData struct {
 }
 
 func (r *RegisterEventQueueResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &r.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &r.registerEventQueueData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &r.APIResponseBase, &r.registerEventQueueData)
 }
 
 type ClientCapability string
@@ -126,6 +117,12 @@ func NarrowEvents(narrow narrow.Filter) RegisterEventQueueOption {
 	}
 }
 
+// featureLevelSetter is implemented by the clients caching the feature level
+// of the server, like zulip.Client.
+type featureLevelSetter interface {
+	SetFeatureLevel(level int)
+}
+
 func (svc *Service) RegisterEvetQueue(ctx context.Context, options ...RegisterEventQueueOption) (*RegisterEventQueueResponse, error) {
 	const (
 		method = http.MethodPost
@@ -173,12 +170,7 @@ func (svc *Service) RegisterEvetQueue(ctx context.Context, options ...RegisterEv
 	}
 
 	if len(opts.eventTypes) > 0 {
-		eventTypes, err := json.Marshal(opts.eventTypes)
-		if err != nil {
-			return nil, fmt.Errorf("marshaling event types: %w", err)
-		}
-
-		msg["event_types"] = string(eventTypes)
+		msg["event_types"] = opts.eventTypes
 	}
 
 	if opts.allPublicStreams {
@@ -186,25 +178,20 @@ func (svc *Service) RegisterEvetQueue(ctx context.Context, options ...RegisterEv
 	}
 
 	if len(opts.clientCapabilities) > 0 {
-		clientCapabilities, err := json.Marshal(opts.clientCapabilities)
-		if err != nil {
-			return nil, fmt.Errorf("marshaling client capabilities: %w", err)
-		}
-
-		msg["client_capabilities"] = string(clientCapabilities)
+		msg["client_capabilities"] = opts.clientCapabilities
 	}
 
 	if len(opts.fetchEventTypes) > 0 {
-		fetchEventTypes, err := json.Marshal(opts.fetchEventTypes)
-		if err != nil {
-			return nil, fmt.Errorf("marshaling fetch event types: %w", err)
-		}
-
-		msg["fetch_event_types"] = string(fetchEventTypes)
+		msg["fetch_event_types"] = opts.fetchEventTypes
 	}
 
 	if len(opts.narrow) > 0 {
-		narrowJSON, err := opts.narrow.MarshalEvent()
+		filter := opts.narrow
+		if filter.DependsOnFeatureLevel() {
+			filter = filter.ForFeatureLevel(zulip.AssumedFeatureLevel(ctx, svc.client))
+		}
+
+		narrowJSON, err := filter.MarshalEvent()
 		if err != nil {
 			return nil, fmt.Errorf("marshaling narrow: %w", err)
 		}
@@ -217,5 +204,10 @@ func (svc *Service) RegisterEvetQueue(ctx context.Context, options ...RegisterEv
 		return nil, err
 	}
 
+	// saves the /server_settings request to the services adapting to it
+	if setter, ok := svc.client.(featureLevelSetter); ok && resp.IsSuccess() {
+		setter.SetFeatureLevel(resp.ZulipFeatureLevel)
+	}
+
 	return &resp, nil
 }
@@ -0,0 +1,448 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+// Middleware wraps an EventHandler of a Router to add behaviour before and
+// after an event is handled.
+type Middleware func(next EventHandler) EventHandler
+
+type routerOptions struct {
+	concurrency     int
+	maxPending      int
+	conversationKey func(events.Event) string
+}
+
+type RouterOption func(*routerOptions)
+
+// RouterConcurrency sets the number of conversations whose events are handled
+// in parallel by Dispatch and Run, 1 by default: every event is handled in
+// order.
+func RouterConcurrency(n int) RouterOption {
+	return func(ro *routerOptions) {
+		ro.concurrency = max(1, n)
+	}
+}
+
+// RouterMaxPending sets the number of events submitted and not handled yet,
+// 100 by default. Dispatch and Run wait for room beyond it: the consumer
+// acknowledges the events it passes to the router, the ones pending are lost
+// when the program stops.
+func RouterMaxPending(n int) RouterOption {
+	return func(ro *routerOptions) {
+		ro.maxPending = max(1, n)
+	}
+}
+
+// RouterConversationKey sets the function telling the conversation of an
+// event, ConversationKey by default. The events of a conversation are
+// handled in order.
+func RouterConversationKey(key func(events.Event) string) RouterOption {
+	return func(ro *routerOptions) {
+		ro.conversationKey = key
+	}
+}
+
+// route is a handler registered for an event type.
+type route struct {
+	// ops holds the operations handled, every one when empty.
+	ops    []string
+	handle EventHandler
+}
+
+// Router dispatches the events to the handlers registered for their type:
+//
+//	router := realtime.NewRouter(realtime.RouterConcurrency(8))
+//	router.Use(realtime.MiddlewareRecover())
+//	router.OnMessage(func(ctx context.Context, e *events.Message) error {
+//		...
+//	})
+//	router.OnTyping(func(ctx context.Context, e *events.Typing) error {
+//		...
+//	}, "start")
+//
+//	err := router.Run(ctx, realtime.NewConsumer(svc))
+//
+// The handlers and middlewares are registered before the router is used.
+type Router struct {
+	opts        routerOptions
+	routes      map[events.EventType][]route
+	fallback    EventHandler
+	middlewares []Middleware
+}
+
+func NewRouter(options ...RouterOption) *Router {
+	opts := routerOptions{
+		concurrency:     1,
+		maxPending:      100,
+		conversationKey: ConversationKey,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return &Router{opts: opts, routes: map[events.EventType][]route{}}
+}
+
+// Use adds middlewares to the router, applied in the given order, the first
+// one being the outermost. They see every event, with or without handler.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// On registers a handler for the events of the given type and operations, or
+// every operation when none is given. The handlers of an event are called in
+// the order they are registered.
+func (r *Router) On(eventType events.EventType, handle EventHandler, ops ...string) {
+	r.routes[eventType] = append(r.routes[eventType], route{ops: ops, handle: handle})
+}
+
+// OnDefault registers the handler of the events without any other handler.
+func (r *Router) OnDefault(handle EventHandler) {
+	r.fallback = handle
+}
+
+func (r *Router) OnMessage(handle func(ctx context.Context, event *events.Message) error) {
+	r.On(events.MessageType, typed(handle))
+}
+
+func (r *Router) OnUpdateMessage(handle func(ctx context.Context, event *events.UpdateMessage) error) {
+	r.On(events.UpdateMessageType, typed(handle))
+}
+
+func (r *Router) OnDeleteMessage(handle func(ctx context.Context, event *events.DeleteMessage) error) {
+	r.On(events.DeleteMessageType, typed(handle))
+}
+
+// OnReaction registers a handler for the reaction events of the given
+// operations, "add" and "remove", or both when none is given.
+func (r *Router) OnReaction(handle func(ctx context.Context, event *events.Reaction) error, ops ...string) {
+	r.On(events.ReactionType, typed(handle), ops...)
+}
+
+// OnUpdateMessageFlags registers a handler for the message flag events of
+// the given operations, "add" and "remove", or both when none is given.
+func (r *Router) OnUpdateMessageFlags(handle func(ctx context.Context, event *events.UpdateMessageFlags) error, ops ...string) {
+	r.On(events.UpdateMessageFlagsType, typed(handle), ops...)
+}
+
+// OnSubscription registers a handler for the subscription events of the
+// given operations, "add", "remove", "update", "peer_add" and "peer_remove",
+// or every one when none is given.
+func (r *Router) OnSubscription(handle func(ctx context.Context, event *events.Subscription) error, ops ...string) {
+	r.On(events.SubscriptionType, typed(handle), ops...)
+}
+
+// OnStream registers a handler for the channel events of the given
+// operations, "create", "delete" and "update", or every one when none is
+// given.
+func (r *Router) OnStream(handle func(ctx context.Context, event *events.Stream) error, ops ...string) {
+	r.On(events.StreamType, typed(handle), ops...)
+}
+
+// OnTyping registers a handler for the typing events of the given
+// operations, "start" and "stop", or both when none is given.
+func (r *Router) OnTyping(handle func(ctx context.Context, event *events.Typing) error, ops ...string) {
+	r.On(events.TypingType, typed(handle), ops...)
+}
+
+// OnUnknown registers a handler for the events of the types the library does
+// not decode, holding their raw fields, and the ones that failed to decode,
+// see events.Unknown.
+func (r *Router) OnUnknown(handle func(ctx context.Context, event *events.Unknown) error) {
+	r.On(events.UnknownType, typed(handle))
+}
+
+// Handle passes an event through the middlewares to its handlers, stopping
+// at the first error. It is an EventHandler, handling the events of a
+// Consumer one at a time.
+func (r *Router) Handle(ctx context.Context, event events.Event) error {
+	handle := EventHandler(r.route)
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handle = r.middlewares[i](handle)
+	}
+
+	return handle(ctx, event)
+}
+
+// Dispatch handles a list of events, like the ones of a
+// GetEventsEventQueueResponse or recorded ones, see RouterConcurrency. It
+// returns after every event is handled or at the first error.
+func (r *Router) Dispatch(ctx context.Context, list []events.Event) error {
+	d := r.newDispatcher(ctx)
+	for _, event := range list {
+		if d.submit(event) != nil {
+			break
+		}
+	}
+
+	return d.wait()
+}
+
+// Run handles the events of consumer until ctx is done or an error occurs,
+// see Consumer.Run and RouterConcurrency. The consumer keeps receiving the
+// events while they are handled.
+func (r *Router) Run(ctx context.Context, consumer *Consumer) error {
+	d := r.newDispatcher(ctx)
+
+	err := consumer.Run(d.ctx, func(_ context.Context, event events.Event) error {
+		return d.submit(event)
+	})
+
+	if handleErr := d.wait(); handleErr != nil {
+		return handleErr
+	}
+
+	return err
+}
+
+// route calls the handlers of an event.
+func (r *Router) route(ctx context.Context, event events.Event) error {
+	handled := false
+
+	for _, rt := range r.routes[event.EventType()] {
+		if len(rt.ops) > 0 && !slices.Contains(rt.ops, event.EventOp()) {
+			continue
+		}
+
+		handled = true
+
+		if err := rt.handle(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	if !handled && r.fallback != nil {
+		return r.fallback(ctx, event)
+	}
+
+	return nil
+}
+
+// typed adapts the handler of an event type, ignoring the events of other
+// types.
+func typed[E events.Event](handle func(context.Context, E) error) EventHandler {
+	return func(ctx context.Context, event events.Event) error {
+		if e, ok := event.(E); ok {
+			return handle(ctx, e)
+		}
+
+		return nil
+	}
+}
+
+// dispatcher handles the events of a router in lanes, one per conversation,
+// running in parallel up to the concurrency of the router.
+type dispatcher struct {
+	router *Router
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// slots limits the events handled at the same time.
+	slots chan struct{}
+	// pending limits the events submitted and not handled yet.
+	pending chan struct{}
+	wg      sync.WaitGroup
+
+	mu sync.Mutex
+	// lanes holds the events waiting in each lane, a lane exists while its
+	// goroutine runs.
+	lanes map[string][]events.Event
+	err   error
+}
+
+func (r *Router) newDispatcher(ctx context.Context) *dispatcher {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	return &dispatcher{
+		router:  r,
+		ctx:     ctx,
+		cancel:  cancel,
+		slots:   make(chan struct{}, r.opts.concurrency),
+		pending: make(chan struct{}, r.opts.maxPending),
+		lanes:   map[string][]events.Event{},
+	}
+}
+
+// submit queues an event in the lane of its conversation, waiting for room
+// when too many events are pending. It returns the error stopping the
+// dispatcher, if any.
+func (d *dispatcher) submit(event events.Event) error {
+	if d.ctx.Err() != nil {
+		return context.Cause(d.ctx)
+	}
+
+	select {
+	case d.pending <- struct{}{}:
+	case <-d.ctx.Done():
+		return context.Cause(d.ctx)
+	}
+
+	key := ""
+	if d.router.opts.concurrency > 1 {
+		key = d.router.opts.conversationKey(event)
+	}
+
+	d.mu.Lock()
+	pending, running := d.lanes[key]
+	d.lanes[key] = append(pending, event)
+	d.mu.Unlock()
+
+	if !running {
+		d.wg.Add(1)
+
+		go d.run(key)
+	}
+
+	return nil
+}
+
+// run handles the events of a lane until it is empty.
+func (d *dispatcher) run(key string) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+
+		pending := d.lanes[key]
+		if len(pending) == 0 || d.ctx.Err() != nil {
+			delete(d.lanes, key)
+			d.mu.Unlock()
+
+			// the events left are dropped
+			for range pending {
+				<-d.pending
+			}
+
+			return
+		}
+
+		event := pending[0]
+		d.lanes[key] = pending[1:]
+		d.mu.Unlock()
+
+		select {
+		case d.slots <- struct{}{}:
+		case <-d.ctx.Done():
+			<-d.pending
+			continue
+		}
+
+		err := d.router.Handle(d.ctx, event)
+
+		<-d.slots
+		<-d.pending
+
+		if err != nil {
+			d.fail(err)
+		}
+	}
+}
+
+// fail stops the dispatcher at the first error.
+func (d *dispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil {
+		d.err = err
+		d.cancel(err)
+	}
+}
+
+// wait waits for the events submitted and returns the first error, or the
+// error of the context when it is done.
+func (d *dispatcher) wait() error {
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.err
+	if err == nil && d.ctx.Err() != nil {
+		err = context.Cause(d.ctx)
+	}
+
+	d.cancel(nil)
+
+	return err
+}
+
+// ConversationKey identifies the conversation of an event: the channel and
+// topic, or the participants of a direct message. It is empty for the events
+// without conversation, or whose conversation can not be told like the edits
+// of direct messages.
+func ConversationKey(event events.Event) string {
+	switch e := event.(type) {
+	case *events.Message:
+		if e.Message.DisplayRecipient.IsChannel {
+			return topicKey(e.Message.StreamID, e.Message.Subject)
+		}
+
+		ids := []int{e.Message.SenderID}
+		for _, u := range e.Message.DisplayRecipient.Users {
+			ids = append(ids, u.ID)
+		}
+
+		return directKey(ids)
+	case *events.UpdateMessage:
+		if e.StreamID == nil {
+			return ""
+		}
+
+		topic := e.OrigSubject
+		if topic == nil {
+			topic = e.Subject
+		}
+
+		if topic == nil {
+			return ""
+		}
+
+		return topicKey(*e.StreamID, *topic)
+	case *events.DeleteMessage:
+		if e.StreamID == nil || e.Topic == nil {
+			return ""
+		}
+
+		return topicKey(*e.StreamID, *e.Topic)
+	case *events.Typing:
+		if e.StreamID != 0 {
+			return topicKey(e.StreamID, e.Topic)
+		}
+
+		ids := []int{e.Sender.UserID}
+		for _, r := range e.Recipients {
+			ids = append(ids, r.UserID)
+		}
+
+		return directKey(ids)
+	}
+
+	return ""
+}
+
+// topicKey is the conversation key of a channel topic, topics are case
+// insensitive.
+func topicKey(streamID int, topic string) string {
+	return fmt.Sprintf("stream:%d:%s", streamID, strings.ToLower(topic))
+}
+
+// directKey is the conversation key of the direct messages between users.
+func directKey(userIDs []int) string {
+	slices.Sort(userIDs)
+
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range slices.Compact(userIDs) {
+		ids = append(ids, strconv.Itoa(id))
+	}
+
+	return "direct:" + strings.Join(ids, ",")
+}
@@ -0,0 +1,81 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+// PanicError is the error of a handler that panicked, see MiddlewareRecover.
+type PanicError struct {
+	Event events.Event
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine when it panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic handling %s event %d: %v", e.Event.EventType(), e.Event.EventID(), e.Value)
+}
+
+// MiddlewareRecover recovers the panics of the handlers, returning them as a
+// *PanicError: the router stops as with any other error, deleting its event
+// queue, instead of crashing the program.
+func MiddlewareRecover() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event events.Event) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = &PanicError{Event: event, Value: v, Stack: debug.Stack()}
+				}
+			}()
+
+			return next(ctx, event)
+		}
+	}
+}
+
+// MiddlewareLog logs the events handled at debug level, and the errors of
+// their handlers.
+func MiddlewareLog(logger *slog.Logger) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event events.Event) error {
+			start := time.Now()
+			err := next(ctx, event)
+
+			attrs := []any{
+				slog.Int("id", event.EventID()),
+				slog.String("type", string(event.EventType())),
+				slog.String("op", event.EventOp()),
+				slog.Duration("duration", time.Since(start)),
+			}
+
+			if err != nil {
+				logger.ErrorContext(ctx, "Handling event failed", append(attrs, slog.Any("error", err))...)
+			} else {
+				logger.DebugContext(ctx, "Event handled", attrs...)
+			}
+
+			return err
+		}
+	}
+}
+
+// MiddlewareFilter skips the events for which keep returns false, like the
+// messages sent by the bot itself.
+func MiddlewareFilter(keep func(event events.Event) bool) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, event events.Event) error {
+			if !keep(event) {
+				return nil
+			}
+
+			return next(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package realtime_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/channels"
+	"github.com/wakumaku/go-zulip/messages"
+	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/realtime"
+	"github.com/wakumaku/go-zulip/realtime/events"
+)
+
+func channelMessage(id, streamID int, topic, content string) *events.Message {
+	return &events.Message{
+		ID:   id,
+		Type: events.MessageType,
+		Message: events.MessageData{
+			ID:               id,
+			Content:          content,
+			DisplayRecipient: events.DisplayRecipient{IsChannel: true, Channel: "general"},
+			StreamID:         streamID,
+			Subject:          topic,
+		},
+	}
+}
+
+func typing(id int, op string) *events.Typing {
+	return &events.Typing{ID: id, Type: events.TypingType, Op: op, MessageType: "direct"}
+}
+
+func TestRouter(t *testing.T) {
+	router := realtime.NewRouter()
+
+	var handled []string
+
+	router.OnMessage(func(_ context.Context, e *events.Message) error {
+		handled = append(handled, "message:"+e.Message.Content)
+		return nil
+	})
+	router.OnTyping(func(_ context.Context, e *events.Typing) error {
+		handled = append(handled, "typing:"+e.Op)
+		return nil
+	}, "start")
+	router.OnUnknown(func(_ context.Context, e *events.Unknown) error {
+		handled = append(handled, "unknown:"+e.Fields["type"].(string))
+		return nil
+	})
+	router.OnDefault(func(_ context.Context, e events.Event) error {
+		handled = append(handled, "default:"+string(e.EventType()))
+		return nil
+	})
+
+	err := router.Dispatch(context.Background(), []events.Event{
+		channelMessage(1, 10, "greetings", "hello"),
+		typing(2, "start"),
+		typing(3, "stop"),
+		&events.Unknown{Fields: map[string]any{"id": 4, "type": "reaction"}},
+		&events.Heartbeat{ID: 5, Type: events.HeartbeatType},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"message:hello",
+		"typing:start",
+		"default:typing",
+		"unknown:reaction",
+		"default:heartbeat",
+	}, handled)
+}
+
+func TestRouterMiddlewares(t *testing.T) {
+	router := realtime.NewRouter()
+
+	var (
+		calls []string
+		logs  bytes.Buffer
+	)
+
+	trace := func(name string) realtime.Middleware {
+		return func(next realtime.EventHandler) realtime.EventHandler {
+			return func(ctx context.Context, e events.Event) error {
+				calls = append(calls, name)
+				return next(ctx, e)
+			}
+		}
+	}
+
+	router.Use(
+		trace("outer"),
+		realtime.MiddlewareLog(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		realtime.MiddlewareRecover(),
+		realtime.MiddlewareFilter(func(e events.Event) bool { return e.EventType() != events.TypingType }),
+		trace("inner"),
+	)
+
+	router.OnMessage(func(_ context.Context, e *events.Message) error {
+		if e.Message.Content == "boom" {
+			panic("boom")
+		}
+
+		return nil
+	})
+
+	require.NoError(t, router.Handle(context.Background(), channelMessage(1, 10, "greetings", "hello")))
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Contains(t, logs.String(), `msg="Event handled" id=1 type=message`)
+
+	// filtered events do not reach the inner middlewares
+	calls = nil
+
+	require.NoError(t, router.Handle(context.Background(), typing(2, "start")))
+	assert.Equal(t, []string{"outer"}, calls)
+
+	// panics are returned as errors
+	err := router.Handle(context.Background(), channelMessage(3, 10, "greetings", "boom"))
+
+	var panicErr *realtime.PanicError
+	require.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+	assert.EqualError(t, err, "panic handling message event 3: boom")
+	assert.Contains(t, logs.String(), `msg="Handling event failed" id=3`)
+}
+
+func TestRouterConcurrency(t *testing.T) {
+	router := realtime.NewRouter(realtime.RouterConcurrency(2))
+
+	var (
+		mu      sync.Mutex
+		handled = map[int][]string{}
+	)
+
+	// the first topic waits for the second one: they are handled in parallel
+	otherTopic := make(chan struct{})
+
+	router.OnMessage(func(_ context.Context, e *events.Message) error {
+		switch e.Message.StreamID {
+		case 1:
+			if e.Message.Content == "a1" {
+				select {
+				case <-otherTopic:
+				case <-time.After(consumerTimeout):
+					return errors.New("not handled in parallel")
+				}
+			}
+		case 2:
+			if e.Message.Content == "b2" {
+				close(otherTopic)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled[e.Message.StreamID] = append(handled[e.Message.StreamID], e.Message.Content)
+
+		return nil
+	})
+
+	err := router.Dispatch(context.Background(), []events.Event{
+		channelMessage(1, 1, "topic", "a1"),
+		channelMessage(2, 2, "topic", "b1"),
+		channelMessage(3, 1, "TOPIC", "a2"),
+		channelMessage(4, 2, "topic", "b2"),
+		channelMessage(5, 1, "topic", "a3"),
+	})
+	require.NoError(t, err)
+
+	// the events of a conversation are handled in order
+	assert.Equal(t, []string{"a1", "a2", "a3"}, handled[1])
+	assert.Equal(t, []string{"b1", "b2"}, handled[2])
+}
+
+func TestRouterMaxPending(t *testing.T) {
+	router := realtime.NewRouter(realtime.RouterConcurrency(4), realtime.RouterMaxPending(2))
+
+	var (
+		mu      sync.Mutex
+		started []int
+	)
+
+	release := make(chan struct{})
+
+	router.OnMessage(func(_ context.Context, e *events.Message) error {
+		mu.Lock()
+		started = append(started, e.ID)
+		mu.Unlock()
+
+		<-release
+
+		return nil
+	})
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- router.Dispatch(context.Background(), []events.Event{
+			channelMessage(1, 1, "topic", "a"),
+			channelMessage(2, 2, "topic", "b"),
+			channelMessage(3, 3, "topic", "c"),
+			channelMessage(4, 4, "topic", "d"),
+		})
+	}()
+
+	// the other events wait for room, even with free slots
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(started) == 2
+	}, consumerTimeout, 10*time.Millisecond)
+	assert.Never(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(started) > 2
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	close(release)
+	require.NoError(t, receive(t, done))
+	assert.ElementsMatch(t, []int{1, 2, 3, 4}, started)
+}
+
+func TestRouterDispatchError(t *testing.T) {
+	router := realtime.NewRouter(realtime.RouterConcurrency(4))
+
+	errHandler := errors.New("handler failed")
+
+	var (
+		mu      sync.Mutex
+		handled []int
+	)
+
+	router.OnMessage(func(ctx context.Context, e *events.Message) error {
+		if e.ID == 1 {
+			return errHandler
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled = append(handled, e.ID)
+
+		return nil
+	})
+
+	err := router.Dispatch(context.Background(), []events.Event{
+		channelMessage(1, 1, "topic", "fails"),
+		channelMessage(2, 1, "topic", "skipped"),
+	})
+	require.ErrorIs(t, err, errHandler)
+	assert.Empty(t, handled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = router.Dispatch(ctx, []events.Event{channelMessage(3, 1, "topic", "skipped")})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, handled)
+}
+
+func TestRouterRun(t *testing.T) {
+	srv, svc, msgSvc := consumerServer(t)
+
+	router := realtime.NewRouter(realtime.RouterConcurrency(4))
+	registered := make(chan struct{}, 1)
+	errStop := errors.New("stop")
+
+	router.OnMessage(func(_ context.Context, e *events.Message) error {
+		if e.Message.Content == "stop" {
+			return errStop
+		}
+
+		return nil
+	})
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerRegisterOptions(realtime.EventTypes(events.MessageType)),
+		realtime.ConsumerOnRegister(func(context.Context, *realtime.RegisterEventQueueResponse) error {
+			registered <- struct{}{}
+			return nil
+		}),
+	)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- router.Run(context.Background(), consumer)
+	}()
+
+	receive(t, registered)
+
+	_, err := msgSvc.SendMessageToChannelTopic(context.Background(), recipient.ToChannel("general"), "greetings", "stop")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, receive(t, done), errStop)
+	assert.Empty(t, srv.EventQueues())
+}
+
+func TestRouterReactionsAndFlags(t *testing.T) {
+	_, svc, msgSvc := consumerServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sent, err := msgSvc.SendMessageToChannelTopic(ctx, recipient.ToChannel("general"), "poll", "Lunch?")
+	require.NoError(t, err)
+
+	router := realtime.NewRouter()
+	registered := make(chan struct{}, 1)
+	received := make(chan events.Event, 2)
+
+	router.OnReaction(func(_ context.Context, e *events.Reaction) error {
+		received <- e
+		return nil
+	}, "add")
+	router.OnUpdateMessageFlags(func(_ context.Context, e *events.UpdateMessageFlags) error {
+		received <- e
+		return nil
+	})
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerRegisterOptions(realtime.EventTypes(events.ReactionType, events.UpdateMessageFlagsType)),
+		realtime.ConsumerOnRegister(func(context.Context, *realtime.RegisterEventQueueResponse) error {
+			registered <- struct{}{}
+			return nil
+		}),
+	)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- router.Run(ctx, consumer)
+	}()
+
+	receive(t, registered)
+
+	_, err = msgSvc.AddEmojiReaction(ctx, sent.ID, "tada")
+	require.NoError(t, err)
+
+	reaction, ok := receive(t, received).(*events.Reaction)
+	require.True(t, ok)
+	assert.Equal(t, sent.ID, reaction.MessageID)
+	assert.Equal(t, "tada", reaction.EmojiName)
+
+	_, err = msgSvc.UpdatePersonalMessageFlags(ctx, []int{sent.ID}, messages.OperationAdd, messages.FlagStarred)
+	require.NoError(t, err)
+
+	flags, ok := receive(t, received).(*events.UpdateMessageFlags)
+	require.True(t, ok)
+	assert.Equal(t, "add", flags.EventOp())
+	assert.Equal(t, "starred", flags.Flag)
+	assert.Equal(t, []int{sent.ID}, flags.Messages)
+
+	cancel()
+	require.ErrorIs(t, receive(t, done), context.Canceled)
+}
+
+func TestRouterChannelEvents(t *testing.T) {
+	srv, svc, _ := consumerServer(t)
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	channelsSvc := channels.NewService(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	router := realtime.NewRouter()
+	registered := make(chan struct{}, 1)
+	received := make(chan events.Event, 4)
+
+	router.OnStream(func(_ context.Context, e *events.Stream) error {
+		received <- e
+		return nil
+	}, "create")
+	router.OnSubscription(func(_ context.Context, e *events.Subscription) error {
+		received <- e
+		return nil
+	})
+
+	consumer := realtime.NewConsumer(svc,
+		realtime.ConsumerRegisterOptions(realtime.EventTypes(events.StreamType, events.SubscriptionType)),
+		realtime.ConsumerOnRegister(func(context.Context, *realtime.RegisterEventQueueResponse) error {
+			registered <- struct{}{}
+			return nil
+		}),
+	)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- router.Run(ctx, consumer)
+	}()
+
+	receive(t, registered)
+
+	_, err = channelsSvc.SubscribeToChannel(ctx, []channels.SubscribeTo{{Name: "announcements"}})
+	require.NoError(t, err)
+
+	created, ok := receive(t, received).(*events.Stream)
+	require.True(t, ok)
+	require.Len(t, created.Streams, 1)
+	assert.Equal(t, "announcements", created.Streams[0].Name)
+
+	added, ok := receive(t, received).(*events.Subscription)
+	require.True(t, ok)
+	assert.Equal(t, "add", added.EventOp())
+	require.Len(t, added.Subscriptions, 1)
+	assert.Equal(t, created.Streams[0].StreamID, added.Subscriptions[0].StreamID)
+	assert.NotEmpty(t, added.Subscriptions[0].Subscribers)
+
+	_, err = channelsSvc.UnsubscribeFromChannel(ctx, []string{"announcements"})
+	require.NoError(t, err)
+
+	removed, ok := receive(t, received).(*events.Subscription)
+	require.True(t, ok)
+	assert.Equal(t, "remove", removed.EventOp())
+	require.Len(t, removed.Subscriptions, 1)
+	assert.Equal(t, "announcements", removed.Subscriptions[0].Name)
+
+	cancel()
+	require.ErrorIs(t, receive(t, done), context.Canceled)
+}
+
+func TestConversationKey(t *testing.T) {
+	streamID, topic, origTopic := 10, "Greetings", "greetings"
+
+	direct := &events.Message{
+		Type: events.MessageType,
+		Message: events.MessageData{
+			SenderID: 8,
+			DisplayRecipient: events.DisplayRecipient{Users: []events.DisplayRecipientObject{
+				{ID: 10}, {ID: 8},
+			}},
+		},
+	}
+
+	assert.Equal(t, "stream:10:greetings", realtime.ConversationKey(channelMessage(1, 10, "Greetings", "")))
+	assert.Equal(t, "direct:8,10", realtime.ConversationKey(direct))
+	assert.Equal(t, "direct:8,10", realtime.ConversationKey(&events.Typing{
+		Sender:     events.Sender{UserID: 10},
+		Recipients: []events.Recipient{{UserID: 8}, {UserID: 10}},
+	}))
+	assert.Equal(t, "stream:10:greetings", realtime.ConversationKey(&events.Typing{StreamID: 10, Topic: "greetings"}))
+	assert.Equal(t, "stream:10:greetings", realtime.ConversationKey(&events.UpdateMessage{StreamID: &streamID, Subject: &topic}))
+	assert.Equal(t, "stream:10:greetings", realtime.ConversationKey(&events.UpdateMessage{StreamID: &streamID, OrigSubject: &origTopic, Subject: &topic}))
+	assert.Equal(t, "stream:10:greetings", realtime.ConversationKey(&events.DeleteMessage{StreamID: &streamID, Topic: &topic}))
+	assert.Empty(t, realtime.ConversationKey(&events.UpdateMessage{}))
+	assert.Empty(t, realtime.ConversationKey(&events.Heartbeat{}))
+}
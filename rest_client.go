@@ -12,12 +12,14 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
-	"net/url"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 )
 
 type RESTClient interface {
@@ -29,10 +31,27 @@ type RESTClient interface {
 type Client struct {
 	baseURL    string
 	userAgent  string
-	userEmail  string
-	userAPIKey string
 	httpClient *http.Client
 	logger     *slog.Logger
+	logPolicy  *logPolicy
+	// credentialsSource is the Source of the credentials.
+	credentialsSource string
+
+	// auth holds the email and API key of the requests, swapped when the
+	// credentials are refreshed, see WithCredentialsRefresh.
+	auth          atomic.Pointer[clientAuth]
+	credentials   CredentialsProvider
+	refreshPolicy *refreshPolicy
+	refreshMu     sync.Mutex
+
+	retryPolicy *retryPolicy
+	rateLimiter *RateLimiter
+	apiErrors   bool
+	handler     Handler
+
+	featureLevelMu    sync.Mutex
+	featureLevel      *int
+	featureLevelGroup singleflight.Group
 }
 
 const (
@@ -41,9 +60,17 @@ const (
 )
 
 type clientOptions struct {
-	httpClient *http.Client
-	userAgent  string
-	logger     *slog.Logger
+	httpClient   *http.Client
+	userAgent    string
+	logger       *slog.Logger
+	retryPolicy  *retryPolicy
+	rateLimiter  *RateLimiter
+	apiErrors    bool
+	middlewares  []Middleware
+	featureLevel *int
+
+	refreshPolicy *refreshPolicy
+	logPolicy     *logPolicy
 }
 
 type ClientOption func(*clientOptions) error
@@ -86,9 +113,8 @@ func NewClient(credentials CredentialsProvider, options ...ClientOption) (*Clien
 	}
 
 	opts := clientOptions{
-		httpClient: &http.Client{},
-		userAgent:  DefaultUserAgentName + "/" + Version,
-		logger:     slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError})),
+		userAgent: DefaultUserAgentName + "/" + Version,
+		logPolicy: newLogPolicy(),
 	}
 	for _, opt := range options {
 		if err := opt(&opts); err != nil {
@@ -96,22 +122,83 @@ func NewClient(credentials CredentialsProvider, options ...ClientOption) (*Clien
 		}
 	}
 
-	return &Client{
+	// warnings about the TLS settings must not be lost with the default
+	// logger discarding everything
+	warnLogger := opts.logger
+	if opts.logger == nil {
+		opts.logger = slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+		warnLogger = slog.Default()
+	}
+
+	switch {
+	case creds.TLS.IsZero():
+		if opts.httpClient == nil {
+			opts.httpClient = &http.Client{}
+		}
+	case opts.httpClient != nil:
+		warnLogger.Warn("Ignoring the TLS settings of the credentials, a custom HTTP client is used",
+			slog.String("credentials_source", creds.Source))
+	default:
+		httpClient, err := creds.TLS.HTTPClient()
+		if err != nil {
+			return nil, fmt.Errorf("configuring TLS from %s: %w", creds.Source, err)
+		}
+
+		if creds.TLS.Insecure {
+			warnLogger.Warn("INSECURE: the server certificate is not verified, connections can be intercepted",
+				slog.String("site", creds.Site),
+				slog.String("credentials_source", creds.Source))
+		}
+
+		opts.httpClient = httpClient
+	}
+
+	c := &Client{
 		baseURL:    creds.Site,
-		userEmail:  creds.Email,
-		userAPIKey: creds.APIKey,
 		userAgent:  opts.userAgent,
 		httpClient: opts.httpClient,
 		logger:     opts.logger,
-	}, nil
+		logPolicy:  opts.logPolicy,
+
+		credentialsSource: creds.Source,
+
+		credentials:   credentials,
+		refreshPolicy: opts.refreshPolicy,
+
+		retryPolicy: opts.retryPolicy,
+		rateLimiter: opts.rateLimiter,
+		apiErrors:   opts.apiErrors,
+
+		featureLevel: opts.featureLevel,
+	}
+
+	c.auth.Store(&clientAuth{email: creds.Email, apiKey: creds.APIKey, refreshedAt: time.Now()})
+	c.handler = chainMiddlewares(c.handle, opts.middlewares)
+
+	c.logger.Debug("Client created",
+		slog.String("site", c.baseURL),
+		slog.String("email", creds.Email),
+		slog.String("credentials_source", c.credentialsSource))
+
+	return c, nil
+}
+
+// CredentialsSource returns where the credentials of the client were found,
+// like "env" or "zuliprc:/home/bot/.zuliprc", see ChainCredentials.
+func (c *Client) CredentialsSource() string {
+	return c.credentialsSource
 }
 
 type clientSendRequestOptions struct {
-	timeout time.Duration
+	timeout  time.Duration
+	progress ProgressFunc
 }
 
 type DoRequestOption func(*clientSendRequestOptions)
 
+// WithTimeout sets the timeout of every attempt of a request,
+// RESTClientDefaultTimeout by default and none for file requests. 0 disables
+// it, leaving the request bounded by its context only.
 func WithTimeout(duration time.Duration) DoRequestOption {
 	return func(o *clientSendRequestOptions) {
 		o.timeout = duration
@@ -119,6 +206,10 @@ func WithTimeout(duration time.Duration) DoRequestOption {
 }
 
 // DoRequest is the main function to send requests to Zulip's API.
+// The data values are encoded following Zulip's conventions: slices, maps
+// and structs as JSON, booleans as true or false. Values implementing
+// ParamEncoder encode themselves and RepeatedParam values are sent as
+// repeated keys.
 func (c *Client) DoRequest(ctx context.Context, method, path string, data map[string]any, response APIResponse, opts ...DoRequestOption) error {
 	options := clientSendRequestOptions{
 		timeout: RESTClientDefaultTimeout,
@@ -127,160 +218,345 @@ func (c *Client) DoRequest(ctx context.Context, method, path string, data map[st
 		opt(&options)
 	}
 
-	formData := url.Values{}
-	for k, v := range data {
-		formData.Set(k, fmt.Sprintf("%v", v))
+	req := &Request{
+		ID:      uuid.New().String(),
+		Method:  method,
+		Path:    path,
+		Data:    data,
+		Header:  http.Header{},
+		Timeout: options.timeout,
 	}
 
-	formDataEncoded := formData.Encode()
+	return c.handler(ctx, req, &Response{APIResponse: response})
+}
 
-	var body io.Reader
-	if method != http.MethodGet {
-		body = strings.NewReader(formDataEncoded)
+// DoFileRequest is the main function to send requests to Zulip's API with a file. For file and emoji uploads.
+// The file content is streamed to the server. When it is seekable its size is
+// sent as content length and the request can be retried.
+//
+// Large files take longer than any default timeout to be sent, so file
+// requests have none unless WithTimeout is used: they are bounded by ctx.
+func (c *Client) DoFileRequest(ctx context.Context, method, path string, fileName string, file io.Reader, response APIResponse, opts ...DoRequestOption) error {
+	options := clientSendRequestOptions{}
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	fullURLPath := c.baseURL + path
+	req := &Request{
+		ID:       uuid.New().String(),
+		Method:   method,
+		Path:     path,
+		FileName: fileName,
+		File:     file,
+		Header:   http.Header{},
+		Timeout:  options.timeout,
+		Progress: options.progress,
+	}
 
-	requestID := uuid.New().String()
-	reqLog := c.logger.With(slog.String("request_id", requestID))
+	return c.handler(ctx, req, &Response{APIResponse: response})
+}
 
-	reqLog.DebugContext(ctx, "Sending request",
-		slog.String("method", method),
-		slog.String("url", fullURLPath),
-		slog.String("data", formDataEncoded))
+// handle is the innermost Handler of the middleware chain, it encodes the
+// request, sends it and decodes the response.
+func (c *Client) handle(ctx context.Context, req *Request, resp *Response) error {
+	start := time.Now()
+	defer func() { resp.Duration = time.Since(start) }()
 
-	if method == http.MethodGet && len(data) > 0 {
-		fullURLPath += "?" + formDataEncoded
-	}
+	reqLog := c.logger.With(slog.String("request_id", req.ID))
 
-	reqCtx, reqCancel := context.WithTimeout(ctx, options.timeout)
-	defer reqCancel()
+	var (
+		newRequest  requestBuilder
+		replayable  = true
+		retryPolicy = c.retryPolicy
+		err         error
+	)
 
-	req, err := http.NewRequestWithContext(reqCtx, method, fullURLPath, body)
-	if err != nil {
-		return fmt.Errorf("creating send request: %w", err)
+	if req.File == nil {
+		newRequest, err = c.formRequestBuilder(ctx, reqLog, req)
+	} else {
+		newRequest, replayable, err = c.fileRequestBuilder(ctx, reqLog, req)
+		if !replayable {
+			// the file content is consumed by the first attempt
+			retryPolicy = nil
+		}
 	}
 
-	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Accept", "application/json")
-	req.SetBasicAuth(c.userEmail, c.userAPIKey)
-
-	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("send request: %w", err)
+		return err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	auth := c.currentAuth(ctx, reqLog)
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return fmt.Errorf("cannot read response body: %s", err)
+	err = c.send(ctx, reqLog, req, newRequest, resp, retryPolicy, auth)
+	if !replayable || !c.refreshOnUnauthorized(resp, err) {
+		return err
 	}
 
-	headersGroup := []slog.Attr{}
-	for k, v := range resp.Header {
-		headersGroup = append(headersGroup, slog.String(k, strings.Join(v, ", ")))
+	refreshed, refreshErr := c.refreshCredentials(ctx, reqLog, auth)
+	if refreshErr != nil {
+		reqLog.WarnContext(ctx, "Credentials refresh failed", slog.Any("error", refreshErr))
+		return err
 	}
 
-	reqLog.DebugContext(ctx, "Received response",
-		slog.Any("headers", slog.GroupValue(headersGroup...)),
-		slog.String("request_id", requestID),
-		slog.Int("status_code", resp.StatusCode),
-	)
-
-	response.SetHTTPCode(resp.StatusCode)
-	response.SetHTTPHeaders(resp.Header)
+	reqLog.DebugContext(ctx, "Sending request again with refreshed credentials")
 
-	return nil
+	return c.send(ctx, reqLog, req, newRequest, resp, retryPolicy, refreshed)
 }
 
-// DoFileRequest is the main function to send requests to Zulip's API with a file. For file and emoji uploads.
-func (c *Client) DoFileRequest(ctx context.Context, method, path string, fileName string, file io.Reader, response APIResponse, opts ...DoRequestOption) error {
-	options := clientSendRequestOptions{
-		timeout: RESTClientDefaultTimeout,
+// formRequestBuilder encodes the request data as a form, see encodeParams.
+func (c *Client) formRequestBuilder(ctx context.Context, reqLog *slog.Logger, r *Request) (requestBuilder, error) {
+	formData, err := encodeParams(r.Data)
+	if err != nil {
+		return nil, err
 	}
-	for _, opt := range opts {
-		opt(&options)
+
+	formDataEncoded := formData.Encode()
+
+	fullURLPath := c.baseURL + r.Path
+
+	reqLog.DebugContext(ctx, "Sending request",
+		slog.String("method", r.Method),
+		slog.String("url", fullURLPath),
+		slog.Any("data", c.logPolicy.form(formData)))
+
+	if r.Method == http.MethodGet && len(r.Data) > 0 {
+		fullURLPath += "?" + formDataEncoded
 	}
 
-	var requestBody bytes.Buffer
+	return func(ctx context.Context) (*http.Request, error) {
+		var body io.Reader
+		if r.Method != http.MethodGet {
+			body = strings.NewReader(formDataEncoded)
+		}
 
-	writer := multipart.NewWriter(&requestBody)
+		req, err := http.NewRequestWithContext(ctx, r.Method, fullURLPath, body)
+		if err != nil {
+			return nil, fmt.Errorf("creating send request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return req, nil
+	}, nil
+}
+
+// fileRequestBuilder encodes the request file as a multipart form. The file
+// content is streamed, not loaded in memory. The request can only be sent
+// again when the file is seekable, which is returned as the second value.
+func (c *Client) fileRequestBuilder(ctx context.Context, reqLog *slog.Logger, r *Request) (requestBuilder, bool, error) {
+	// The multipart headers and closing boundary are small, they are
+	// rendered in memory around the file content.
+	var envelope bytes.Buffer
+
+	writer := multipart.NewWriter(&envelope)
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition",
 		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
 			"filename",
-			filepath.Base(fileName)))
+			filepath.Base(r.FileName)))
 
-	mimeType := mime.TypeByExtension(filepath.Ext(fileName))
+	mimeType := mime.TypeByExtension(filepath.Ext(r.FileName))
 	if mimeType == "" {
 		mimeType = "application/octet-stream"
 	}
 
 	h.Set("Content-Type", mimeType)
 
-	part, err := writer.CreatePart(h)
-	if err != nil {
-		return fmt.Errorf("cannot create writer from file: %v", err)
+	if _, err := writer.CreatePart(h); err != nil {
+		return nil, false, fmt.Errorf("cannot create writer from file: %v", err)
 	}
 
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return fmt.Errorf("copying file content: %v", err)
-	}
+	head := bytes.Clone(envelope.Bytes())
+	envelope.Reset()
 
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("closing writer: %v", err)
+		return nil, false, fmt.Errorf("closing writer: %v", err)
 	}
 
-	reqCtx, reqCancel := context.WithTimeout(ctx, options.timeout)
-	defer reqCancel()
+	tail := bytes.Clone(envelope.Bytes())
+
+	fileSize := readerSize(r.File)
+
+	contentLength := int64(-1)
+	if fileSize >= 0 {
+		contentLength = int64(len(head)) + fileSize + int64(len(tail))
+	}
+
+	seeker, replayable := r.File.(io.Seeker)
 
-	fullURLPath := c.baseURL + path
+	var fileStart int64
 
-	requestID := uuid.New().String()
-	reqLog := c.logger.With(slog.String("request_id", requestID))
+	if replayable {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			replayable = false
+		}
+
+		fileStart = offset
+	}
+
+	fullURLPath := c.baseURL + r.Path
 
 	reqLog.DebugContext(ctx, "Sending file request",
-		slog.String("method", method),
+		slog.String("method", r.Method),
 		slog.String("url", fullURLPath),
-		slog.String("filename", fileName),
+		slog.String("filename", r.FileName),
 		slog.String("mimetype", mimeType),
-		slog.Int("content_length", requestBody.Len()))
+		slog.Int64("content_length", contentLength))
+
+	attempts := 0
+
+	return func(ctx context.Context) (*http.Request, error) {
+		attempts++
+		if attempts > 1 {
+			if _, err := seeker.Seek(fileStart, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("rewinding file: %w", err)
+			}
+		}
+
+		file := &progressReader{
+			reader:   &contextReader{ctx: ctx, reader: r.File},
+			total:    fileSize,
+			progress: r.Progress,
+		}
+		body := io.MultiReader(bytes.NewReader(head), file, bytes.NewReader(tail))
+
+		req, err := http.NewRequestWithContext(ctx, r.Method, fullURLPath, body)
+		if err != nil {
+			return nil, fmt.Errorf("creating send request: %w", err)
+		}
+
+		if contentLength >= 0 {
+			req.ContentLength = contentLength
+		}
+
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		return req, nil
+	}, replayable, nil
+}
+
+// requestBuilder creates a new HTTP request for every attempt made by send.
+type requestBuilder func(ctx context.Context) (*http.Request, error)
 
-	req, err := http.NewRequestWithContext(reqCtx, method, fullURLPath, &requestBody)
+// send sends the request created by newRequest, retrying it according to the
+// given retry policy, and decodes the final response.
+func (c *Client) send(ctx context.Context, reqLog *slog.Logger, r *Request, newRequest requestBuilder, resp *Response, retryPolicy *retryPolicy, auth *clientAuth) error {
+	for attempt := 1; ; attempt++ {
+		retry, delay, err := c.sendAttempt(ctx, reqLog, r, newRequest, resp, retryPolicy, auth, attempt)
+		if !retry {
+			return err
+		}
+
+		reqLog.DebugContext(ctx, "Retrying request",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendAttempt sends the request once, waiting for the rate limiter if any.
+// It returns whether the request has to be retried and how long to wait
+// before doing it.
+func (c *Client) sendAttempt(ctx context.Context, reqLog *slog.Logger, r *Request, newRequest requestBuilder, resp *Response, retryPolicy *retryPolicy, auth *clientAuth, attempt int) (bool, time.Duration, error) {
+	if err := c.rateLimiter.Wait(ctx, r.Method, r.Path); err != nil {
+		return false, 0, err
+	}
+
+	reqCtx, reqCancel := withTimeout(ctx, r.Timeout)
+	defer reqCancel()
+
+	req, err := newRequest(reqCtx)
 	if err != nil {
-		return fmt.Errorf("creating send request: %w", err)
+		return false, 0, err
+	}
+
+	for k, v := range r.Header {
+		req.Header[k] = v
 	}
 
 	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Add("Accept", "application/json")
-	req.SetBasicAuth(c.userEmail, c.userAPIKey)
+	req.SetBasicAuth(auth.email, auth.apiKey)
 
-	resp, err := c.httpClient.Do(req)
+	httpResp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("send request: %w", err)
+		retry, delay := retryPolicy.retryError(r.Method, attempt, err)
+		return retry, delay, fmt.Errorf("send request: %w", err)
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	defer func() { _ = httpResp.Body.Close() }()
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return fmt.Errorf("cannot read response body: %w", err)
+	resp.Attempts = attempt
+	resp.HTTPCode = httpResp.StatusCode
+	resp.Header = httpResp.Header
+
+	c.rateLimiter.Update(r.Method, r.Path, httpResp.Header)
+
+	if retry, delay := retryPolicy.retryResponse(r.Method, attempt, httpResp); retry {
+		// drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+
+		return true, delay, fmt.Errorf("received status code %d", httpResp.StatusCode)
 	}
 
-	headersGroup := []slog.Attr{}
-	for k, v := range resp.Header {
-		headersGroup = append(headersGroup, slog.String(k, strings.Join(v, ", ")))
+	response := resp.APIResponse
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		retry, delay := retryPolicy.retryError(r.Method, attempt, err)
+		return retry, delay, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return false, 0, fmt.Errorf("cannot read response body: %w", err)
+		}
+
+		// an HTML error page from a proxy, or nothing at all
+		response.SetHTTPCode(httpResp.StatusCode)
+		response.SetHTTPHeaders(httpResp.Header)
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			err = nil
+		}
+
+		return false, 0, newTransportError(httpResp, body, err)
 	}
 
 	reqLog.DebugContext(ctx, "Received response",
-		slog.Any("headers", slog.GroupValue(headersGroup...)),
-		slog.Int("status_code", resp.StatusCode),
+		slog.Any("headers", c.logPolicy.header(httpResp.Header)),
+		slog.Int("status_code", httpResp.StatusCode),
+		slog.Any("body", c.logPolicy.body(body)),
 	)
 
-	response.SetHTTPCode(resp.StatusCode)
-	response.SetHTTPHeaders(resp.Header)
+	response.SetHTTPCode(httpResp.StatusCode)
+	response.SetHTTPHeaders(httpResp.Header)
+
+	if c.apiErrors {
+		if apiErr := newAPIError(httpResp.StatusCode, response); apiErr != nil {
+			return false, 0, apiErr
+		}
+	}
+
+	return false, 0, nil
+}
+
+// withTimeout returns a context done after timeout, or only when ctx is done
+// if timeout is 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
 
-	return nil
+	return context.WithTimeout(ctx, timeout)
 }
@@ -0,0 +1,201 @@
+package zulip
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	RetryDefaultMaxAttempts = 4
+	RetryDefaultMinBackoff  = 500 * time.Millisecond
+	RetryDefaultMaxBackoff  = 30 * time.Second
+)
+
+// retryPolicy decides whether a failed request has to be sent again and how
+// long to wait before doing it.
+type retryPolicy struct {
+	maxAttempts        int
+	minBackoff         time.Duration
+	maxBackoff         time.Duration
+	retryNonIdempotent bool
+}
+
+type RetryOption func(*retryPolicy) error
+
+// RetryMaxAttempts sets the maximum number of attempts (including the first
+// one) made for a single request.
+func RetryMaxAttempts(attempts int) RetryOption {
+	return func(p *retryPolicy) error {
+		if attempts < 1 {
+			return errors.New("retry max attempts must be at least 1")
+		}
+
+		p.maxAttempts = attempts
+
+		return nil
+	}
+}
+
+// RetryBackoff sets the bounds of the exponential backoff used between
+// attempts when the server does not say how long to wait.
+func RetryBackoff(minBackoff, maxBackoff time.Duration) RetryOption {
+	return func(p *retryPolicy) error {
+		if minBackoff <= 0 || maxBackoff < minBackoff {
+			return errors.New("retry backoff must be positive and min <= max")
+		}
+
+		p.minBackoff = minBackoff
+		p.maxBackoff = maxBackoff
+
+		return nil
+	}
+}
+
+// RetryNonIdempotent also retries non idempotent requests (POST, PATCH) on
+// 5xx responses and connection resets. Be aware that it may lead to
+// duplicated messages if the server processed the request but the response
+// was lost.
+func RetryNonIdempotent() RetryOption {
+	return func(p *retryPolicy) error {
+		p.retryNonIdempotent = true
+		return nil
+	}
+}
+
+// WithRetry enables automatic retries for DoRequest and DoFileRequest.
+//
+// Rate limited requests (HTTP 429) are always retried, waiting as long as the
+// Retry-After or X-RateLimit-Reset headers say, within the bounds of
+// RetryBackoff. Server errors (5xx) and
+// connection resets are retried only for idempotent methods, unless
+// RetryNonIdempotent is used. Connection refused errors are always retried as
+// the request never reached the server.
+func WithRetry(options ...RetryOption) ClientOption {
+	return func(o *clientOptions) error {
+		p := retryPolicy{
+			maxAttempts: RetryDefaultMaxAttempts,
+			minBackoff:  RetryDefaultMinBackoff,
+			maxBackoff:  RetryDefaultMaxBackoff,
+		}
+
+		for _, opt := range options {
+			if err := opt(&p); err != nil {
+				return err
+			}
+		}
+
+		o.retryPolicy = &p
+
+		return nil
+	}
+}
+
+// retryResponse tells if the request has to be retried given the received
+// response and how long to wait before retrying.
+func (p *retryPolicy) retryResponse(method string, attempt int, resp *http.Response) (bool, time.Duration) {
+	if p == nil || attempt >= p.maxAttempts {
+		return false, 0
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if d, ok := retryAfter(resp.Header, time.Now()); ok {
+			return true, p.clamp(d)
+		}
+
+		return true, p.backoff(attempt)
+	case resp.StatusCode >= http.StatusInternalServerError && p.canRetryMethod(method):
+		if d, ok := retryAfter(resp.Header, time.Now()); ok {
+			return true, p.clamp(d)
+		}
+
+		return true, p.backoff(attempt)
+	}
+
+	return false, 0
+}
+
+// retryError tells if the request has to be retried given the transport error
+// and how long to wait before retrying.
+func (p *retryPolicy) retryError(method string, attempt int, err error) (bool, time.Duration) {
+	if p == nil || attempt >= p.maxAttempts {
+		return false, 0
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return true, p.backoff(attempt)
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		if p.canRetryMethod(method) {
+			return true, p.backoff(attempt)
+		}
+	}
+
+	return false, 0
+}
+
+func (p *retryPolicy) canRetryMethod(method string) bool {
+	if p.retryNonIdempotent {
+		return true
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns an exponential backoff with jitter for the given attempt:
+// a random duration between half and the full exponential value.
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	d := p.maxBackoff
+	if shift := attempt - 1; shift < 32 {
+		if exp := p.minBackoff << shift; exp > 0 && exp < p.maxBackoff {
+			d = exp
+		}
+	}
+
+	half := d / 2
+
+	return half + rand.N(half+1) //nolint:gosec // jitter does not need a secure random source
+}
+
+// clamp bounds a delay asked by the server to the backoff: a huge Retry-After
+// does not block the request for hours, and a reset already past, like with a
+// skewed clock, does not retry in a tight loop.
+func (p *retryPolicy) clamp(d time.Duration) time.Duration {
+	return min(max(d, p.minBackoff), p.maxBackoff)
+}
+
+// retryAfter reads how long the server asked to wait from the Retry-After
+// header (seconds) or, failing that, from the X-RateLimit-Reset header (unix
+// timestamp).
+func retryAfter(headers http.Header, now time.Time) (time.Duration, bool) {
+	if v := headers.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+
+	if v := headers.Get(XRateLimitReset); v != "" {
+		if ts, err := strconv.ParseFloat(v, 64); err == nil {
+			reset := time.Unix(0, int64(ts*float64(time.Second)))
+			return max(reset.Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,262 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+func TestRestClientRetry(t *testing.T) {
+	errorBody := `{"result": "error", "msg": "API usage exceeded rate limit", "code": "RATE_LIMIT_HIT", "retry-after": 0}`
+
+	cases := []struct {
+		name             string
+		method           string
+		failures         int
+		failureCode      int
+		failureHeaders   http.Header
+		retryOptions     []zulip.RetryOption
+		expectedAttempts int32
+		expectedCode     int
+	}{
+		{
+			name:             "rate limited POST is retried honouring Retry-After",
+			method:           http.MethodPost,
+			failures:         2,
+			failureCode:      http.StatusTooManyRequests,
+			failureHeaders:   http.Header{"Retry-After": []string{"0"}},
+			expectedAttempts: 3,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:        "rate limited POST is retried honouring X-RateLimit-Reset",
+			method:      http.MethodPost,
+			failures:    1,
+			failureCode: http.StatusTooManyRequests,
+			failureHeaders: http.Header{
+				zulip.XRateLimitRemaining: []string{"0"},
+				zulip.XRateLimitReset:     []string{strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)},
+			},
+			expectedAttempts: 2,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "server error GET is retried",
+			method:           http.MethodGet,
+			failures:         1,
+			failureCode:      http.StatusBadGateway,
+			expectedAttempts: 2,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "server error POST is not retried",
+			method:           http.MethodPost,
+			failures:         1,
+			failureCode:      http.StatusBadGateway,
+			expectedAttempts: 1,
+			expectedCode:     http.StatusBadGateway,
+		},
+		{
+			name:             "server error POST is retried when allowed",
+			method:           http.MethodPost,
+			failures:         1,
+			failureCode:      http.StatusBadGateway,
+			retryOptions:     []zulip.RetryOption{zulip.RetryNonIdempotent()},
+			expectedAttempts: 2,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "attempts are exhausted",
+			method:           http.MethodPost,
+			failures:         5,
+			failureCode:      http.StatusTooManyRequests,
+			failureHeaders:   http.Header{"Retry-After": []string{"0"}},
+			retryOptions:     []zulip.RetryOption{zulip.RetryMaxAttempts(3)},
+			expectedAttempts: 3,
+			expectedCode:     http.StatusTooManyRequests,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(attempts.Add(1)) <= c.failures {
+					for k, v := range c.failureHeaders {
+						w.Header()[k] = v
+					}
+
+					w.WriteHeader(c.failureCode)
+					_, _ = w.Write([]byte(errorBody))
+
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(`{"result": "success"}`))
+			}))
+			defer mockServer.Close()
+
+			retryOptions := append([]zulip.RetryOption{zulip.RetryBackoff(time.Millisecond, 5*time.Millisecond)}, c.retryOptions...)
+
+			client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+				zulip.WithRetry(retryOptions...),
+			)
+			require.NoError(t, err)
+
+			var resp zulip.APIResponseBase
+
+			err = client.DoRequest(context.TODO(), c.method, "/endpoint", map[string]any{"key": "value"}, &resp)
+			require.NoError(t, err)
+
+			assert.Equal(t, c.expectedAttempts, attempts.Load())
+			assert.Equal(t, c.expectedCode, resp.HTTPCode())
+		})
+	}
+}
+
+func TestRestClientRetryServerDelayBounds(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers http.Header
+		atLeast time.Duration
+		atMost  time.Duration
+	}{
+		{
+			name:    "a long Retry-After is capped by the max backoff",
+			headers: http.Header{"Retry-After": []string{"3600"}},
+			atMost:  time.Second,
+		},
+		{
+			name: "a past X-RateLimit-Reset waits the min backoff",
+			headers: http.Header{
+				zulip.XRateLimitRemaining: []string{"0"},
+				zulip.XRateLimitReset:     []string{strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)},
+			},
+			atLeast: 50 * time.Millisecond,
+			atMost:  time.Second,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if attempts.Add(1) == 1 {
+					for k, v := range c.headers {
+						w.Header()[k] = v
+					}
+
+					w.WriteHeader(http.StatusTooManyRequests)
+					_, _ = w.Write([]byte(`{"result": "error", "msg": "API usage exceeded rate limit", "code": "RATE_LIMIT_HIT"}`))
+
+					return
+				}
+
+				_, _ = w.Write([]byte(`{"result": "success"}`))
+			}))
+			defer mockServer.Close()
+
+			client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+				zulip.WithRetry(zulip.RetryBackoff(50*time.Millisecond, 100*time.Millisecond)),
+			)
+			require.NoError(t, err)
+
+			var resp zulip.APIResponseBase
+
+			start := time.Now()
+
+			err = client.DoRequest(context.TODO(), http.MethodGet, "/endpoint", nil, &resp)
+			require.NoError(t, err)
+
+			elapsed := time.Since(start)
+			assert.Equal(t, int32(2), attempts.Load())
+			assert.GreaterOrEqual(t, elapsed, c.atLeast)
+			assert.Less(t, elapsed, c.atMost)
+		})
+	}
+}
+
+func TestRestClientRetryFileRequest(t *testing.T) {
+	var (
+		attempts atomic.Int32
+		bodies   []int64
+	)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodies = append(bodies, r.ContentLength)
+
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"result": "error", "code": "RATE_LIMIT_HIT"}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRetry(),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoFileRequest(context.TODO(), http.MethodPost, "/endpoint", "file.txt", strings.NewReader("file content"), &resp)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	// the same body is sent on every attempt
+	require.Len(t, bodies, 2)
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Positive(t, bodies[0])
+}
+
+func TestRestClientRetryContextCanceled(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"result": "error", "code": "RATE_LIMIT_HIT"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRetry(),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(ctx, http.MethodPost, "/endpoint", nil, &resp)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRestClientRetryInvalidOptions(t *testing.T) {
+	_, err := zulip.NewClient(zulip.Credentials("http://localhost", "email@test", "apikey"),
+		zulip.WithRetry(zulip.RetryMaxAttempts(0)),
+	)
+	require.Error(t, err)
+
+	_, err = zulip.NewClient(zulip.Credentials("http://localhost", "email@test", "apikey"),
+		zulip.WithRetry(zulip.RetryBackoff(time.Second, time.Millisecond)),
+	)
+	require.Error(t, err)
+}
@@ -2,7 +2,6 @@ package specialty
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -20,15 +19,7 @@ type fetchAPIKeyData struct {
 }
 
 func (f *FetchAPIKeyResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &f.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &f.fetchAPIKeyData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &f.APIResponseBase, &f.fetchAPIKeyData)
 }
 
 func (svc *Service) FetchAPIKeyProduction(ctx context.Context, username, password string) (*FetchAPIKeyResponse, error) {
@@ -0,0 +1,109 @@
+package zulip
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TLSSettings are the TLS settings of a zuliprc file.
+type TLSSettings struct {
+	// Insecure disables the verification of the server certificate.
+	Insecure bool
+	// CertBundle is the path of a PEM file with the certificate authorities
+	// trusted to verify the server certificate, instead of the system ones.
+	CertBundle string
+	// ClientCert and ClientCertKey are the paths of the PEM encoded client
+	// certificate and key for mutual TLS. ClientCert may hold both when
+	// ClientCertKey is empty.
+	ClientCert    string
+	ClientCertKey string
+}
+
+// IsZero reports whether no setting is set, so the default HTTP client can
+// be used.
+func (s TLSSettings) IsZero() bool {
+	return s == TLSSettings{}
+}
+
+// TLSConfig builds the TLS configuration of the settings.
+func (s TLSSettings) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.Insecure, //nolint:gosec // explicitly requested by the zuliprc file
+	}
+
+	if s.CertBundle != "" {
+		pem, err := os.ReadFile(expandHome(s.CertBundle))
+		if err != nil {
+			return nil, fmt.Errorf("reading cert_bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("reading cert_bundle: no certificate found in %s", s.CertBundle)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if s.ClientCertKey != "" && s.ClientCert == "" {
+		return nil, errors.New("client_cert_key is set without client_cert")
+	}
+
+	if s.ClientCert != "" {
+		keyFile := s.ClientCertKey
+		if keyFile == "" {
+			keyFile = s.ClientCert
+		}
+
+		cert, err := tls.LoadX509KeyPair(expandHome(s.ClientCert), expandHome(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("reading client_cert: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// HTTPClient builds an HTTP client using the settings. It keeps the other
+// settings of http.DefaultTransport, like the proxy from the environment.
+func (s TLSSettings) HTTPClient() (*http.Client, error) {
+	config, err := s.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http.DefaultTransport is not an *http.Transport")
+	}
+
+	transport = transport.Clone()
+	transport.TLSClientConfig = config
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// expandHome replaces a leading ~ by the home directory, as zuliprc paths
+// may use it.
+func expandHome(path string) string {
+	rest, found := strings.CutPrefix(path, "~")
+	if !found || (rest != "" && rest[0] != '/' && rest[0] != filepath.Separator) {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, rest)
+}
@@ -0,0 +1,196 @@
+package zulip_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+// tlsServer starts a TLS server answering every request successfully.
+func tlsServer(t *testing.T, configure func(*tls.Config)) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":"success","msg":""}`))
+	}))
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	// the refused handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+	if configure != nil {
+		configure(srv.TLS)
+	}
+
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// tlsZuliprc writes a zuliprc file with the given TLS settings.
+func tlsZuliprc(t *testing.T, site, settings string) string {
+	t.Helper()
+
+	return writeZuliprc(t, t.TempDir(), "[api]\nemail=bot@localhost\nkey=apikey\nsite="+site+"\n"+settings)
+}
+
+// writePEM writes PEM blocks to a file in dir.
+func writePEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		require.NoError(t, pem.Encode(&buf, b))
+	}
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	return path
+}
+
+func ping(client *zulip.Client) error {
+	var resp zulip.APIResponseBase
+	return client.DoRequest(context.Background(), http.MethodGet, "/api/v1/users/me", nil, &resp)
+}
+
+func TestZuliprcCertBundle(t *testing.T) {
+	srv := tlsServer(t, nil)
+
+	// without the bundle, the certificate of the test server is unknown
+	client, err := zulip.NewClient(zulip.CredentialsFromZuliprc(tlsZuliprc(t, srv.URL, ""), "api"))
+	require.NoError(t, err)
+	require.Error(t, ping(client))
+
+	bundle := writePEM(t, t.TempDir(), "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	client, err = zulip.NewClient(zulip.CredentialsFromZuliprc(tlsZuliprc(t, srv.URL, "cert_bundle="+bundle+"\n"), "api"))
+	require.NoError(t, err)
+	require.NoError(t, ping(client))
+}
+
+func TestZuliprcInsecure(t *testing.T) {
+	srv := tlsServer(t, nil)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	client, err := zulip.NewClient(zulip.CredentialsFromZuliprc(tlsZuliprc(t, srv.URL, "insecure=true\n"), "api"),
+		zulip.WithLogger(logger))
+	require.NoError(t, err)
+	require.NoError(t, ping(client))
+
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), "INSECURE")
+}
+
+func TestZuliprcClientCert(t *testing.T) {
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	botKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	botDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "bot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &botKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	botKeyDER, err := x509.MarshalECPrivateKey(botKey)
+	require.NoError(t, err)
+
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: botDER}
+	keyBlock := &pem.Block{Type: "EC PRIVATE KEY", Bytes: botKeyDER}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	srv := tlsServer(t, func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = clientCAs
+	})
+	bundle := writePEM(t, dir, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	tests := map[string]string{
+		"separate key": "client_cert=" + writePEM(t, dir, "bot.crt", certBlock) + "\n" +
+			"client_cert_key=" + writePEM(t, dir, "bot.key", keyBlock) + "\n",
+		"combined": "client_cert=" + writePEM(t, dir, "bot.pem", certBlock, keyBlock) + "\n",
+	}
+
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, err := zulip.NewClient(zulip.CredentialsFromZuliprc(
+				tlsZuliprc(t, srv.URL, "cert_bundle="+bundle+"\n"+settings), "api"))
+			require.NoError(t, err)
+			require.NoError(t, ping(client))
+		})
+	}
+
+	// the server refuses the clients without certificate
+	client, err := zulip.NewClient(zulip.CredentialsFromZuliprc(tlsZuliprc(t, srv.URL, "cert_bundle="+bundle+"\n"), "api"))
+	require.NoError(t, err)
+	require.Error(t, ping(client))
+}
+
+func TestZuliprcTLSErrors(t *testing.T) {
+	_, err := zulip.NewClient(zulip.CredentialsFromZuliprc(
+		tlsZuliprc(t, "https://localhost", "cert_bundle=/does/not/exist.pem\n"), "api"))
+	require.ErrorContains(t, err, "cert_bundle")
+
+	_, err = zulip.NewClient(zulip.CredentialsFromZuliprc(
+		tlsZuliprc(t, "https://localhost", "client_cert_key=/some/key.pem\n"), "api"))
+	require.ErrorContains(t, err, "client_cert")
+}
+
+func TestZuliprcTLSWithCustomHTTPClient(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	_, err := zulip.NewClient(zulip.CredentialsFromZuliprc(tlsZuliprc(t, "https://localhost", "insecure=true\n"), "api"),
+		zulip.WithHTTPClient(&http.Client{}), zulip.WithLogger(logger))
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Ignoring the TLS settings")
+}
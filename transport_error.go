@@ -0,0 +1,114 @@
+package zulip
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// TransportErrorBodyLimit is the maximum number of bytes of the response body
+// kept in a TransportError.
+const TransportErrorBodyLimit = 512
+
+var (
+	// ErrUnexpectedResponse matches every *TransportError.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+	// ErrServerUnavailable matches a *TransportError with a 502, 503 or 504
+	// status code, usually sent by a proxy while the Zulip server restarts.
+	ErrServerUnavailable = errors.New("server unavailable")
+)
+
+// TransportError is returned by DoRequest and DoFileRequest when the server,
+// or a proxy in front of it, answers with an empty body or a body that is
+// not JSON, such as an HTML error page.
+type TransportError struct {
+	// HTTPCode is the HTTP status code of the response.
+	HTTPCode int
+	// ContentType is the content type of the response.
+	ContentType string
+	// Body holds the first TransportErrorBodyLimit bytes of the response
+	// body.
+	Body string
+	// Truncated reports whether Body has been cut.
+	Truncated bool
+	// Header holds the HTTP headers of the response.
+	Header http.Header
+	// Err is the error got decoding the body, nil if the body is empty.
+	Err error
+}
+
+func newTransportError(httpResp *http.Response, body []byte, err error) *TransportError {
+	e := &TransportError{
+		HTTPCode:    httpResp.StatusCode,
+		ContentType: httpResp.Header.Get("Content-Type"),
+		Header:      httpResp.Header.Clone(),
+		Err:         err,
+	}
+
+	if len(body) > TransportErrorBodyLimit {
+		body = body[:TransportErrorBodyLimit]
+		// do not cut a multi-byte character in half
+		for len(body) > 0 && !utf8.Valid(body) {
+			body = body[:len(body)-1]
+		}
+
+		e.Truncated = true
+	}
+
+	e.Body = string(body)
+
+	return e
+}
+
+func (e *TransportError) Error() string {
+	body := "empty body"
+	if e.Body != "" {
+		body = fmt.Sprintf("body %q", e.Body)
+		if e.Truncated {
+			body += " (truncated)"
+		}
+	}
+
+	return fmt.Sprintf("zulip unexpected response (http %d, content type %q): %s", e.HTTPCode, e.ContentType, body)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the error match ErrUnexpectedResponse, and ErrServerUnavailable,
+// ErrRateLimited or ErrUnauthorized depending on its status code.
+func (e *TransportError) Is(target error) bool {
+	switch target {
+	case ErrUnexpectedResponse:
+		return true
+	case ErrServerUnavailable:
+		return e.HTTPCode == http.StatusBadGateway ||
+			e.HTTPCode == http.StatusServiceUnavailable ||
+			e.HTTPCode == http.StatusGatewayTimeout
+	case ErrRateLimited:
+		return e.HTTPCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.HTTPCode == http.StatusUnauthorized
+	}
+
+	return false
+}
+
+// Retryable reports whether the request may succeed if sent again later: the
+// server was unavailable, overloaded or timed out. Whether it is safe to send
+// it again also depends on the request being idempotent.
+func (e *TransportError) Retryable() bool {
+	switch e.HTTPCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
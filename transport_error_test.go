@@ -0,0 +1,149 @@
+package zulip_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+const badGatewayPage = `<html>
+<head><title>502 Bad Gateway</title></head>
+<body><center><h1>502 Bad Gateway</h1></center></body>
+</html>`
+
+func TestTransportErrorHTMLPage(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Server", "nginx")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(badGatewayPage))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodPost, "/api/v1/messages", nil, &resp)
+	require.Error(t, err)
+
+	var transportErr *zulip.TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, http.StatusBadGateway, transportErr.HTTPCode)
+	assert.Equal(t, "text/html", transportErr.ContentType)
+	assert.Equal(t, badGatewayPage, transportErr.Body)
+	assert.False(t, transportErr.Truncated)
+	assert.Equal(t, "nginx", transportErr.Header.Get("Server"))
+	assert.True(t, transportErr.Retryable())
+	require.Error(t, transportErr.Err)
+
+	require.ErrorIs(t, err, zulip.ErrUnexpectedResponse)
+	require.ErrorIs(t, err, zulip.ErrServerUnavailable)
+	require.NotErrorIs(t, err, zulip.ErrUnauthorized)
+	assert.Contains(t, err.Error(), "http 502")
+
+	// the status code is not lost
+	assert.Equal(t, http.StatusBadGateway, resp.HTTPCode())
+}
+
+func TestTransportErrorEmptyBody(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/users/me", nil, &resp)
+
+	var transportErr *zulip.TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, http.StatusOK, transportErr.HTTPCode)
+	assert.Empty(t, transportErr.Body)
+	require.NoError(t, transportErr.Err)
+	assert.False(t, transportErr.Retryable())
+	assert.Contains(t, err.Error(), "empty body")
+}
+
+func TestTransportErrorTruncatedBody(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(strings.Repeat("é", zulip.TransportErrorBodyLimit)))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/users/me", nil, &resp)
+
+	var transportErr *zulip.TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.True(t, transportErr.Truncated)
+	assert.Equal(t, strings.Repeat("é", zulip.TransportErrorBodyLimit/2), transportErr.Body)
+	assert.Contains(t, err.Error(), "(truncated)")
+}
+
+func TestTransportErrorRetried(t *testing.T) {
+	var attempts atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(badGatewayPage))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success", "msg": ""}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRetry(zulip.RetryBackoff(time.Millisecond, time.Millisecond)),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	require.NoError(t, client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/users/me", nil, &resp))
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestTransportErrorWrongJSONIsNotTransportError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`["not", "an", "object"]`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoRequest(context.TODO(), http.MethodGet, "/api/v1/users/me", nil, &resp)
+	require.Error(t, err)
+
+	var transportErr *zulip.TransportError
+	assert.False(t, errors.As(err, &transportErr))
+}
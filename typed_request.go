@@ -0,0 +1,63 @@
+package zulip
+
+import (
+	"context"
+	"io"
+)
+
+// TypedResponse is the response of Do and DoFile: the fields common to every
+// Zulip response, with their HTTP status code and headers, and the fields
+// specific to the endpoint decoded into Data.
+type TypedResponse[T any] struct {
+	APIResponseBase
+	Data T
+}
+
+var _ APIResponse = (*TypedResponse[struct{}])(nil)
+
+// UnmarshalJSON decodes the response in a single pass when T is a struct
+// without methods, see UnmarshalResponse.
+func (r *TypedResponse[T]) UnmarshalJSON(b []byte) error {
+	var data T
+	if err := UnmarshalResponse(b, &r.APIResponseBase, &data); err != nil {
+		return err
+	}
+
+	r.Data = data
+
+	return nil
+}
+
+// Do sends a request with DoRequest and decodes the response into a
+// TypedResponse, to call the endpoints without a dedicated service method:
+//
+//	type linkifiers struct {
+//		Linkifiers []struct {
+//			ID      int    `json:"id"`
+//			Pattern string `json:"pattern"`
+//		} `json:"linkifiers"`
+//	}
+//
+//	resp, err := zulip.Do[linkifiers](ctx, client, http.MethodGet, "/api/v1/realm/linkifiers", nil)
+//
+// Like the service methods, error responses are returned without error
+// unless the client is created with WithAPIErrors.
+func Do[T any](ctx context.Context, client RESTClient, method, path string, params map[string]any, opts ...DoRequestOption) (*TypedResponse[T], error) {
+	resp := TypedResponse[T]{}
+	if err := client.DoRequest(ctx, method, path, params, &resp, opts...); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// DoFile sends a file with DoFileRequest and decodes the response into a
+// TypedResponse, see Do.
+func DoFile[T any](ctx context.Context, client RESTClient, method, path, fileName string, file io.Reader, opts ...DoRequestOption) (*TypedResponse[T], error) {
+	resp := TypedResponse[T]{}
+	if err := client.DoFileRequest(ctx, method, path, fileName, file, &resp, opts...); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,111 @@
+package zulip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/zuliptest"
+)
+
+func TestDo(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	type me struct {
+		UserID   int    `json:"user_id"`
+		Email    string `json:"email"`
+		FullName string `json:"full_name"`
+	}
+
+	resp, err := zulip.Do[me](context.Background(), client, http.MethodGet, "/api/v1/users/me", nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, http.StatusOK, resp.HTTPCode())
+	assert.Equal(t, zuliptest.DefaultUserEmail, resp.Data.Email)
+	assert.NotZero(t, resp.Data.UserID)
+
+	// the fields not in the data are still available
+	isAdmin, err := resp.FieldValue("is_admin")
+	require.NoError(t, err)
+	assert.Equal(t, true, isAdmin)
+
+	// error responses
+	user, err := zulip.Do[map[string]any](context.Background(), client, http.MethodGet, "/api/v1/users/unknown@localhost", nil)
+	require.NoError(t, err)
+	assert.True(t, user.IsError())
+	assert.Equal(t, zulip.CodeBadRequest, user.Code())
+	assert.Equal(t, user.Msg(), user.Data["msg"])
+
+	client, err = zulip.NewClient(srv.Credentials(), zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	_, err = zulip.Do[map[string]any](context.Background(), client, http.MethodGet, "/api/v1/users/unknown@localhost", nil)
+	require.ErrorIs(t, err, zulip.ErrBadRequest)
+}
+
+func TestDoFile(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	client, err := zulip.NewClient(srv.Credentials())
+	require.NoError(t, err)
+
+	type upload struct {
+		URL      string `json:"url"`
+		Filename string `json:"filename"`
+	}
+
+	resp, err := zulip.DoFile[upload](context.Background(), client, http.MethodPost, "/api/v1/user_uploads",
+		"notes.txt", strings.NewReader("some notes"))
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "notes.txt", resp.Data.Filename)
+	assert.True(t, strings.HasPrefix(resp.Data.URL, "/user_uploads/"))
+}
+
+func TestDoHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(zulip.XRateLimitRemaining, "42")
+		w.Header().Set(zulip.XRateLimitLimit, "200")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":"success","msg":"","alert_words":["urgent","outage"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(srv.URL, "bot@localhost", "key"))
+	require.NoError(t, err)
+
+	resp, err := zulip.Do[struct {
+		AlertWords []string `json:"alert_words"`
+	}](context.Background(), client, http.MethodGet, "/api/v1/users/me/alert_words", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"urgent", "outage"}, resp.Data.AlertWords)
+	assert.Equal(t, "42", resp.XRateLimitRemaining())
+	assert.Equal(t, "200", resp.XRateLimitLimit())
+	assert.Equal(t, "application/json", resp.HTTPHeaders().Get("Content-Type"))
+}
+
+func TestDoTransportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("<html>Bad Gateway</html>"))
+	}))
+	defer srv.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(srv.URL, "bot@localhost", "key"))
+	require.NoError(t, err)
+
+	_, err = zulip.Do[struct{}](context.Background(), client, http.MethodGet, "/api/v1/users/me", nil)
+
+	var transportErr *zulip.TransportError
+	require.ErrorAs(t, err, &transportErr)
+}
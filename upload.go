@@ -0,0 +1,93 @@
+package zulip
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// ProgressFunc is called while a file is uploaded with the number of bytes
+// of the file sent so far and its total size, -1 if it is unknown.
+type ProgressFunc func(sent, total int64)
+
+// WithProgress sets a function to be called while the file of a file request
+// is uploaded. When a request is retried, the progress starts again from zero.
+func WithProgress(progress ProgressFunc) DoRequestOption {
+	return func(o *clientSendRequestOptions) {
+		o.progress = progress
+	}
+}
+
+// progressReader reports the bytes read from the underlying reader.
+type progressReader struct {
+	reader   io.Reader
+	total    int64
+	sent     int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+
+		if p.progress != nil {
+			p.progress(p.sent, p.total)
+		}
+	}
+
+	return n, err
+}
+
+// readerSize returns the number of bytes left to read from the reader, or -1
+// if it cannot be known without reading it.
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }: // bytes.Reader, bytes.Buffer, strings.Reader
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	case io.Seeker:
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+
+		if _, err := v.Seek(offset, io.SeekStart); err != nil {
+			return -1
+		}
+
+		return end - offset
+	}
+
+	return -1
+}
+
+// contextReader stops reading as soon as the context is done.
+type contextReader struct {
+	ctx    context.Context //nolint:containedctx // bound to a single request
+	reader io.Reader
+}
+
+func (c *contextReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.reader.Read(b)
+}
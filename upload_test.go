@@ -0,0 +1,226 @@
+package zulip_test
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+type uploadRecorder struct {
+	contentLength    int64
+	transferEncoding []string
+	fileName         string
+	content          string
+}
+
+func newUploadServer(t *testing.T, rec *uploadRecorder) *httptest.Server {
+	t.Helper()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.contentLength = r.ContentLength
+		rec.transferEncoding = r.TransferEncoding
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		content, _ := io.ReadAll(part)
+		rec.fileName = part.FileName()
+		rec.content = string(content)
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	t.Cleanup(mockServer.Close)
+
+	return mockServer
+}
+
+func TestUploadStreamingKnownSize(t *testing.T) {
+	rec := uploadRecorder{}
+	mockServer := newUploadServer(t, &rec)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	content := strings.Repeat("log line\n", 10_000)
+
+	filePath := filepath.Join(t.TempDir(), "archive.log")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o600))
+
+	file, err := os.Open(filePath)
+	require.NoError(t, err)
+
+	defer func() { _ = file.Close() }()
+
+	var lastSent, lastTotal int64
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoFileRequest(context.TODO(), http.MethodPost, "/api/v1/user_uploads", file.Name(), file, &resp,
+		zulip.WithProgress(func(sent, total int64) {
+			assert.GreaterOrEqual(t, sent, lastSent)
+			lastSent, lastTotal = sent, total
+		}),
+	)
+	require.NoError(t, err)
+	assert.True(t, resp.IsSuccess())
+
+	assert.Equal(t, "archive.log", rec.fileName)
+	assert.Equal(t, content, rec.content)
+	assert.Greater(t, rec.contentLength, int64(len(content)))
+	assert.Empty(t, rec.transferEncoding)
+
+	assert.Equal(t, int64(len(content)), lastSent)
+	assert.Equal(t, int64(len(content)), lastTotal)
+}
+
+func TestUploadStreamingUnknownSize(t *testing.T) {
+	rec := uploadRecorder{}
+	mockServer := newUploadServer(t, &rec)
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		for range 100 {
+			_, _ = pw.Write([]byte("chunk "))
+		}
+
+		_ = pw.Close()
+	}()
+
+	var lastSent, lastTotal int64
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoFileRequest(context.TODO(), http.MethodPost, "/api/v1/user_uploads", "stream.txt", pr, &resp,
+		zulip.WithProgress(func(sent, total int64) {
+			lastSent, lastTotal = sent, total
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Repeat("chunk ", 100), rec.content)
+	assert.Equal(t, []string{"chunked"}, rec.transferEncoding)
+	assert.Equal(t, int64(600), lastSent)
+	assert.Equal(t, int64(-1), lastTotal)
+}
+
+func TestUploadStreamingNotSeekableIsNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"result": "error", "code": "RATE_LIMIT_HIT"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithRetry(),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoFileRequest(context.TODO(), http.MethodPost, "/api/v1/user_uploads", "file.txt", io.MultiReader(strings.NewReader("content")), &resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), attempts.Load())
+	assert.Equal(t, http.StatusTooManyRequests, resp.HTTPCode())
+}
+
+func TestUploadWithoutTimeout(t *testing.T) {
+	mockServer := newUploadServer(t, &uploadRecorder{})
+
+	var timeouts []time.Duration
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"),
+		zulip.WithMiddleware(func(next zulip.Handler) zulip.Handler {
+			return func(ctx context.Context, req *zulip.Request, resp *zulip.Response) error {
+				timeouts = append(timeouts, req.Timeout)
+				return next(ctx, req, resp)
+			}
+		}),
+	)
+	require.NoError(t, err)
+
+	var resp zulip.APIResponseBase
+
+	// the uploads are bounded by their context only, unless told otherwise
+	err = client.DoFileRequest(context.Background(), http.MethodPost, "/api/v1/user_uploads", "file.txt", strings.NewReader("content"), &resp)
+	require.NoError(t, err)
+
+	err = client.DoFileRequest(context.Background(), http.MethodPost, "/api/v1/user_uploads", "file.txt", strings.NewReader("content"), &resp,
+		zulip.WithTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Duration{0, time.Minute}, timeouts)
+}
+
+func TestUploadStreamingCanceled(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"result": "success"}`))
+	}))
+	defer mockServer.Close()
+
+	client, err := zulip.NewClient(zulip.Credentials(mockServer.URL, "email@test", "apikey"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// a reader that never ends
+	pr, pw := io.Pipe()
+
+	go func() {
+		for {
+			if _, err := pw.Write([]byte("data")); err != nil {
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	defer func() { _ = pr.Close() }()
+
+	var resp zulip.APIResponseBase
+
+	err = client.DoFileRequest(ctx, http.MethodPost, "/api/v1/user_uploads", "endless.txt", pr, &resp,
+		zulip.WithProgress(func(sent, total int64) {
+			if sent > 100 {
+				cancel()
+			}
+		}),
+	)
+	require.ErrorIs(t, err, context.Canceled)
+}
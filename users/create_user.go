@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -18,15 +17,7 @@ type createUserResponseData struct {
 }
 
 func (c *CreateUserResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &c.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &c.createUserResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &c.APIResponseBase, &c.createUserResponseData)
 }
 
 func (svc *Service) CreateUser(ctx context.Context, email, password, fullName string) (*CreateUserResponse, error) {
@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -36,15 +35,7 @@ type getUserMeResponseData struct {
 }
 
 func (g *GetUserMeResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getUserMeResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getUserMeResponseData)
 }
 
 func (svc *Service) GetUserMe(ctx context.Context) (*GetUserMeResponse, error) {
@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -28,15 +27,7 @@ type getUserPresenceResponseData struct {
 }
 
 func (g *GetUserPresenceResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getUserPresenceResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getUserPresenceResponseData)
 }
 
 func (svc *Service) GetUserPresence(ctx context.Context, userIDorEmail string) (*GetUserPresenceResponse, error) {
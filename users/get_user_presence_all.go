@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/wakumaku/go-zulip"
@@ -28,15 +27,7 @@ type getUserPresenceAllResponseData struct {
 }
 
 func (g *GetUserPresenceAllResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getUserPresenceAllResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getUserPresenceAllResponseData)
 }
 
 func (svc *Service) GetUserPresenceAll(ctx context.Context) (*GetUserPresenceAllResponse, error) {
@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -24,15 +23,7 @@ type getUserStatusResponseData struct {
 }
 
 func (g *GetUserStatusResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &g.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &g.getUserStatusResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &g.APIResponseBase, &g.getUserStatusResponseData)
 }
 
 func (svc *Service) GetUserStatus(ctx context.Context, id int) (*GetUserStatusResponse, error) {
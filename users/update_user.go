@@ -2,7 +2,6 @@ package users
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -17,15 +16,7 @@ type UpdateUserResponse struct {
 type updateUserResponseData struct{}
 
 func (u *UpdateUserResponse) UnmarshalJSON(b []byte) error {
-	if err := json.Unmarshal(b, &u.APIResponseBase); err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(b, &u.updateUserResponseData); err != nil {
-		return err
-	}
-
-	return nil
+	return zulip.UnmarshalResponse(b, &u.APIResponseBase, &u.updateUserResponseData)
 }
 
 type updateUserOptions struct {
@@ -125,12 +116,7 @@ func (svc *Service) updateUser(ctx context.Context, patchPath string, options ..
 	}
 
 	if opts.profileData.value != nil {
-		jsonData, err := json.Marshal(opts.profileData.value)
-		if err != nil {
-			return nil, err
-		}
-
-		msg[opts.profileData.fieldName] = string(jsonData)
+		msg[opts.profileData.fieldName] = *opts.profileData.value
 	}
 
 	if opts.newEmail.value != nil {
@@ -64,7 +64,7 @@ func TestUpdateUser(t *testing.T) {
 			expectedMsg := map[string]interface{}{
 				"full_name":    "King Hamlet",
 				"role":         zulip.MemberRole,
-				"profile_data": `[{"id":4,"value":"0"},{"id":5,"value":"1909-04-05"}]`,
+				"profile_data": profileData,
 				"new_email":    "newemail@xxx.com",
 			}
 
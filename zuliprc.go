@@ -3,9 +3,9 @@ package zulip
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
-	"regexp"
 	"strings"
 )
 
@@ -18,6 +18,15 @@ type (
 		Email  string
 		APIKey string
 		Site   string
+
+		// Insecure disables the verification of the server certificate
+		Insecure bool
+		// CertBundle is the path of the certificate authorities bundle
+		CertBundle string
+		// ClientCert and ClientCertKey are the paths of the client
+		// certificate and key for mutual TLS
+		ClientCert    string
+		ClientCertKey string
 	}
 )
 
@@ -35,32 +44,24 @@ func ParseZuliprc(file string) (Zuliprc, error) {
 func parseZuliprcContent(b io.Reader) (Zuliprc, error) {
 	s := bufio.NewScanner(b)
 
-	rxSection := regexp.MustCompile(`\[(.*)\]`)
-	rxKeyVal := regexp.MustCompile(`(.*)=(.*)`)
-
 	currentSection := "unknown"
 
 	z := Zuliprc{}
 
 	for s.Scan() {
 		line := strings.TrimSpace(s.Text())
-		if line == "" {
+		if line == "" || isZuliprcComment(line) {
 			continue
 		}
 
-		if rxSection.MatchString(line) {
-			section := rxSection.FindStringSubmatch(line)[1]
+		if section, ok := zuliprcSectionName(line); ok {
 			z[section] = SectionData{}
-			currentSection = strings.TrimSpace(section)
+			currentSection = section
 
 			continue
 		}
 
-		if rxKeyVal.MatchString(line) {
-			kv := rxKeyVal.FindStringSubmatch(line)
-			key := kv[1]
-			val := kv[2]
-
+		if key, val, ok := strings.Cut(line, "="); ok {
 			sectionData := z[currentSection]
 
 			switch strings.TrimSpace(key) {
@@ -70,6 +71,19 @@ func parseZuliprcContent(b io.Reader) (Zuliprc, error) {
 				sectionData.APIKey = strings.TrimSpace(val)
 			case "site":
 				sectionData.Site = strings.TrimSpace(val)
+			case "insecure":
+				insecure, err := parseZuliprcBool(strings.TrimSpace(val))
+				if err != nil {
+					return nil, fmt.Errorf("section '%s': invalid insecure value: %w", currentSection, err)
+				}
+
+				sectionData.Insecure = insecure
+			case "cert_bundle":
+				sectionData.CertBundle = strings.TrimSpace(val)
+			case "client_cert":
+				sectionData.ClientCert = strings.TrimSpace(val)
+			case "client_cert_key":
+				sectionData.ClientCertKey = strings.TrimSpace(val)
 			}
 
 			z[currentSection] = sectionData
@@ -78,3 +92,25 @@ func parseZuliprcContent(b io.Reader) (Zuliprc, error) {
 
 	return z, nil
 }
+
+// TLSSettings returns the TLS settings of the section
+func (s SectionData) TLSSettings() TLSSettings {
+	return TLSSettings{
+		Insecure:      s.Insecure,
+		CertBundle:    s.CertBundle,
+		ClientCert:    s.ClientCert,
+		ClientCertKey: s.ClientCertKey,
+	}
+}
+
+// parseZuliprcBool parses a boolean the way Python's configparser does
+func parseZuliprcBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "1", "yes", "true", "on":
+		return true, nil
+	case "0", "no", "false", "off":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%q is not a boolean", v)
+}
@@ -0,0 +1,306 @@
+package zulip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/wakumaku/go-zulip/internal/atomicfile"
+)
+
+// ZuliprcFile is a zuliprc file kept line by line, so its sections can be
+// updated without losing the comments, the unknown keys and the layout of
+// the file.
+type ZuliprcFile struct {
+	lines []string
+}
+
+// LoadZuliprcFile reads a zuliprc file to update it. A missing file gives an
+// empty ZuliprcFile.
+func LoadZuliprcFile(path string) (*ZuliprcFile, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ZuliprcFile{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadZuliprcFile(f)
+}
+
+// ReadZuliprcFile reads the content of a zuliprc file to update it.
+func ReadZuliprcFile(r io.Reader) (*ZuliprcFile, error) {
+	zf := &ZuliprcFile{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		zf.lines = append(zf.lines, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return zf, nil
+}
+
+// Zuliprc parses the content of the file.
+func (zf *ZuliprcFile) Zuliprc() (Zuliprc, error) {
+	return parseZuliprcContent(strings.NewReader(zf.String()))
+}
+
+// Sections returns the names of the sections, in the order of the file.
+func (zf *ZuliprcFile) Sections() []string {
+	var sections []string
+
+	for _, line := range zf.lines {
+		if name, ok := zuliprcSectionName(line); ok && !slices.Contains(sections, name) {
+			sections = append(sections, name)
+		}
+	}
+
+	return sections
+}
+
+// SetSection adds the section, or updates its keys if it exists. The empty
+// fields of data remove their keys, the keys unknown to SectionData and the
+// comments of the section are kept.
+func (zf *ZuliprcFile) SetSection(name string, data SectionData) {
+	start, end, found := zf.lastSection(name)
+	if !found {
+		if len(zf.lines) > 0 && strings.TrimSpace(zf.lines[len(zf.lines)-1]) != "" {
+			zf.lines = append(zf.lines, "")
+		}
+
+		zf.lines = append(zf.lines, "["+name+"]")
+		start, end = len(zf.lines)-1, len(zf.lines)
+	}
+
+	for _, kv := range data.keyValues() {
+		start, end = zf.setKey(start, end, kv[0], kv[1])
+	}
+}
+
+// RemoveSection removes the section with its keys and comments. It reports
+// whether the section existed.
+func (zf *ZuliprcFile) RemoveSection(name string) bool {
+	removed := false
+
+	for {
+		start, end, found := zf.lastSection(name)
+		if !found {
+			return removed
+		}
+
+		// the blank line separating it from the previous section goes too
+		if start > 0 && strings.TrimSpace(zf.lines[start-1]) == "" {
+			start--
+		}
+
+		zf.lines = slices.Delete(zf.lines, start, end)
+		removed = true
+	}
+}
+
+// String returns the content of the file.
+func (zf *ZuliprcFile) String() string {
+	if len(zf.lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(zf.lines, "\n") + "\n"
+}
+
+// WriteTo writes the content of the file to w.
+func (zf *ZuliprcFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, zf.String())
+	return int64(n), err
+}
+
+// Save writes the file atomically: the content is written to a temporary
+// file renamed to path, so readers never see a partial file. The file is
+// only readable by its owner, as it holds API keys.
+func (zf *ZuliprcFile) Save(path string) error {
+	return atomicfile.Write(path, func(w io.Writer) error {
+		_, err := zf.WriteTo(w)
+		return err
+	})
+}
+
+// lastSection returns the range of lines of the last section with the name,
+// the one the parser keeps, from its header to the next one.
+func (zf *ZuliprcFile) lastSection(name string) (start, end int, found bool) {
+	for i, line := range zf.lines {
+		if sectionName, ok := zuliprcSectionName(line); ok {
+			if found && end == -1 {
+				end = i
+			}
+
+			if sectionName == name {
+				start, end, found = i, -1, true
+			}
+		}
+	}
+
+	if found && end == -1 {
+		end = len(zf.lines)
+	}
+
+	return start, end, found
+}
+
+// setKey sets, or removes if value is empty, a key of the section in the
+// range of lines and returns the range updated.
+func (zf *ZuliprcFile) setKey(start, end int, key, value string) (int, int) {
+	set := false
+
+	for i := start + 1; i < end; i++ {
+		prefix, ok := zuliprcKeyPrefix(zf.lines[i], key)
+		if !ok {
+			continue
+		}
+
+		if value == "" || set {
+			zf.lines = slices.Delete(zf.lines, i, i+1)
+			i--
+			end--
+
+			continue
+		}
+
+		zf.lines[i] = prefix + value
+		set = true
+	}
+
+	if set || value == "" {
+		return start, end
+	}
+
+	// after the last key of the section, before its trailing blank lines
+	// and comments
+	at := start + 1
+
+	for i := start + 1; i < end; i++ {
+		if _, ok := zuliprcKeyPrefix(zf.lines[i], ""); ok {
+			at = i + 1
+		}
+	}
+
+	zf.lines = slices.Insert(zf.lines, at, key+"="+value)
+
+	return start, end + 1
+}
+
+// keyValues returns the zuliprc keys of the section with their value, empty
+// for the unset ones.
+func (s SectionData) keyValues() [][2]string {
+	insecure := ""
+	if s.Insecure {
+		insecure = "true"
+	}
+
+	return [][2]string{
+		{"email", s.Email},
+		{"key", s.APIKey},
+		{"site", s.Site},
+		{"insecure", insecure},
+		{"cert_bundle", s.CertBundle},
+		{"client_cert", s.ClientCert},
+		{"client_cert_key", s.ClientCertKey},
+	}
+}
+
+// zuliprcSectionName returns the name of the section of a header line.
+func zuliprcSectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+// zuliprcKeyPrefix returns the part of a key=value line before the value,
+// keeping its spacing, if the line sets key, or any key if key is empty.
+func zuliprcKeyPrefix(line, key string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if isZuliprcComment(trimmed) {
+		return "", false
+	}
+
+	name, value, ok := strings.Cut(line, "=")
+	if !ok || (key != "" && strings.TrimSpace(name) != key) {
+		return "", false
+	}
+
+	return line[:len(line)-len(strings.TrimLeft(value, " \t"))], true
+}
+
+func isZuliprcComment(line string) bool {
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+// WriteZuliprc writes the sections of z to the zuliprc file at path. The
+// sections of the file missing from z are removed, the others are updated
+// keeping their comments and unknown keys, see ZuliprcFile.
+func WriteZuliprc(path string, z Zuliprc) error {
+	zf, err := LoadZuliprcFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range zf.Sections() {
+		if _, ok := z[name]; !ok {
+			zf.RemoveSection(name)
+		}
+	}
+
+	names := make([]string, 0, len(z))
+	for name := range z {
+		names = append(names, name)
+	}
+
+	// new sections are added in a stable order
+	slices.Sort(names)
+
+	for _, name := range names {
+		zf.SetSection(name, z[name])
+	}
+
+	return zf.Save(path)
+}
+
+// SetZuliprcSection adds or updates a section of the zuliprc file at path,
+// creating the file if needed.
+func SetZuliprcSection(path, section string, data SectionData) error {
+	zf, err := LoadZuliprcFile(path)
+	if err != nil {
+		return err
+	}
+
+	zf.SetSection(section, data)
+
+	return zf.Save(path)
+}
+
+// RemoveZuliprcSection removes a section of the zuliprc file at path. It
+// reports whether the section existed.
+func RemoveZuliprcSection(path, section string) (bool, error) {
+	zf, err := LoadZuliprcFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	if !zf.RemoveSection(section) {
+		return false, nil
+	}
+
+	return true, zf.Save(path)
+}
@@ -0,0 +1,148 @@
+package zulip_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+)
+
+const commentedZuliprc = `# bots of the onboarding tool
+[api]
+email = admin@localhost
+key = oldkey
+site = https://localhost
+; kept by the Python client
+format = json
+
+[old]
+email=old@localhost
+key=oldbotkey
+site=https://localhost
+`
+
+func TestZuliprcFileUpdateSection(t *testing.T) {
+	zf, err := zulip.ReadZuliprcFile(strings.NewReader(commentedZuliprc))
+	require.NoError(t, err)
+
+	zf.SetSection("api", zulip.SectionData{
+		Email:      "admin@localhost",
+		APIKey:     "newkey",
+		Site:       "https://localhost",
+		CertBundle: "/etc/ssl/ca.pem",
+	})
+	assert.True(t, zf.RemoveSection("old"))
+	assert.False(t, zf.RemoveSection("old"))
+	zf.SetSection("bot", zulip.SectionData{Email: "bot@localhost", APIKey: "botkey", Site: "https://localhost"})
+
+	assert.Equal(t, `# bots of the onboarding tool
+[api]
+email = admin@localhost
+key = newkey
+site = https://localhost
+; kept by the Python client
+format = json
+cert_bundle=/etc/ssl/ca.pem
+
+[bot]
+email=bot@localhost
+key=botkey
+site=https://localhost
+`, zf.String())
+	assert.Equal(t, []string{"api", "bot"}, zf.Sections())
+
+	z, err := zf.Zuliprc()
+	require.NoError(t, err)
+	assert.Equal(t, "newkey", z["api"].APIKey)
+	assert.Equal(t, "/etc/ssl/ca.pem", z["api"].CertBundle)
+	assert.Equal(t, "botkey", z["bot"].APIKey)
+}
+
+func TestZuliprcFileRemoveKey(t *testing.T) {
+	zf, err := zulip.ReadZuliprcFile(strings.NewReader("[api]\nemail=a@localhost\nkey=k\nsite=https://localhost\ninsecure=true\n"))
+	require.NoError(t, err)
+
+	zf.SetSection("api", zulip.SectionData{Email: "a@localhost", APIKey: "k", Site: "https://localhost"})
+	assert.Equal(t, "[api]\nemail=a@localhost\nkey=k\nsite=https://localhost\n", zf.String())
+}
+
+func TestSetZuliprcSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zuliprc")
+	require.NoError(t, os.WriteFile(path, []byte(commentedZuliprc), 0o644))
+
+	bot := zulip.SectionData{Email: "bot@localhost", APIKey: "botkey", Site: "https://localhost"}
+	require.NoError(t, zulip.SetZuliprcSection(path, "bot", bot))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), commentedZuliprc))
+
+	z, err := zulip.ParseZuliprc(path)
+	require.NoError(t, err)
+	assert.Equal(t, bot, z["bot"])
+
+	removed, err := zulip.RemoveZuliprcSection(path, "old")
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	removed, err = zulip.RemoveZuliprcSection(path, "missing")
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	z, err = zulip.ParseZuliprc(path)
+	require.NoError(t, err)
+	assert.NotContains(t, z, "old")
+
+	// no temporary file left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriteZuliprc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zuliprc")
+
+	z := zulip.Zuliprc{
+		"bot2": {Email: "bot2@localhost", APIKey: "key2", Site: "https://localhost"},
+		"bot1": {Email: "bot1@localhost", APIKey: "key1", Site: "https://localhost", Insecure: true},
+	}
+	require.NoError(t, zulip.WriteZuliprc(path, z))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `[bot1]
+email=bot1@localhost
+key=key1
+site=https://localhost
+insecure=true
+
+[bot2]
+email=bot2@localhost
+key=key2
+site=https://localhost
+`, string(content))
+
+	read, err := zulip.ParseZuliprc(path)
+	require.NoError(t, err)
+	assert.Equal(t, z, read)
+
+	// the credentials are usable right away
+	client, err := zulip.NewClient(zulip.CredentialsFromZuliprc(path, "bot2"))
+	require.NoError(t, err)
+	assert.Equal(t, "zuliprc:"+path, client.CredentialsSource())
+
+	delete(z, "bot1")
+	require.NoError(t, zulip.WriteZuliprc(path, z))
+
+	read, err = zulip.ParseZuliprc(path)
+	require.NoError(t, err)
+	assert.Equal(t, z, read)
+}
@@ -2,6 +2,7 @@ package zulip
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,3 +49,32 @@ func TestZuliprcParseFileNotFound(t *testing.T) {
 	_, err := ParseZuliprc("non-existing-file")
 	assert.Error(t, err)
 }
+
+func TestZuliprcParserTLS(t *testing.T) {
+	fileContent := `[api]
+email=user@localhost
+key=apikey
+site=https://localhost
+insecure=yes
+cert_bundle=/etc/ssl/internal-ca.pem
+client_cert=~/certs/bot.pem
+client_cert_key=~/certs/bot.key
+
+[other]
+insecure=false
+`
+
+	z, err := parseZuliprcContent(strings.NewReader(fileContent))
+	require.NoError(t, err)
+
+	assert.Equal(t, TLSSettings{
+		Insecure:      true,
+		CertBundle:    "/etc/ssl/internal-ca.pem",
+		ClientCert:    "~/certs/bot.pem",
+		ClientCertKey: "~/certs/bot.key",
+	}, z["api"].TLSSettings())
+	assert.True(t, z["other"].TLSSettings().IsZero())
+
+	_, err = parseZuliprcContent(strings.NewReader("[api]\ninsecure=maybe\n"))
+	assert.ErrorContains(t, err, "invalid insecure value")
+}
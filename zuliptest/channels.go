@@ -0,0 +1,396 @@
+package zuliptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+// Channel is a channel (stream) of the fake server.
+type Channel struct {
+	ID          int
+	Name        string
+	Description string
+	InviteOnly  bool
+	// Subscribers holds the IDs of the subscribed users.
+	Subscribers []int
+	DateCreated time.Time
+}
+
+// toJSON returns the channel as returned by the channel endpoints.
+func (c *Channel) toJSON() map[string]any {
+	return map[string]any{
+		"stream_id":                     c.ID,
+		"name":                          c.Name,
+		"description":                   c.Description,
+		"rendered_description":          "<p>" + c.Description + "</p>",
+		"invite_only":                   c.InviteOnly,
+		"is_web_public":                 false,
+		"is_archived":                   false,
+		"history_public_to_subscribers": !c.InviteOnly,
+		"date_created":                  c.DateCreated.Unix(),
+	}
+}
+
+// AddChannel adds a channel to the server and returns it with its assigned
+// ID.
+func (s *Server) AddChannel(c Channel) Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.addChannel(c)
+}
+
+// addChannel adds a channel. The lock must be held.
+func (s *Server) addChannel(c Channel) *Channel {
+	c.ID = s.id()
+	c.Subscribers = slices.Clone(c.Subscribers)
+
+	if c.DateCreated.IsZero() {
+		c.DateCreated = time.Now()
+	}
+
+	s.channels = append(s.channels, &c)
+
+	return &c
+}
+
+// Channel returns the channel with the given name.
+func (s *Server) Channel(name string) (Channel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChannel(name)
+	if c == nil {
+		return Channel{}, false
+	}
+
+	clone := *c
+	clone.Subscribers = slices.Clone(c.Subscribers)
+
+	return clone, true
+}
+
+// Channels returns every channel of the server.
+func (s *Server) Channels() []Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]Channel, 0, len(s.channels))
+	for _, c := range s.channels {
+		clone := *c
+		clone.Subscribers = slices.Clone(c.Subscribers)
+		channels = append(channels, clone)
+	}
+
+	return channels
+}
+
+// findChannel returns the channel with the given name, nil if there is none.
+// The lock must be held.
+func (s *Server) findChannel(name string) *Channel {
+	for _, c := range s.channels {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// findChannelByID returns the channel with the given ID, nil if there is
+// none. The lock must be held.
+func (s *Server) findChannelByID(id int) *Channel {
+	for _, c := range s.channels {
+		if c.ID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// findChannelByRef returns the channel referenced by an ID or a name. The
+// lock must be held.
+func (s *Server) findChannelByRef(ref string) *Channel {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return s.findChannelByID(id)
+	}
+
+	return s.findChannel(ref)
+}
+
+func (s *Server) routeChannels(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/streams", s.getChannels)
+	mux.HandleFunc("GET /api/v1/streams/{id}", s.getChannel)
+	mux.HandleFunc("GET /api/v1/streams/{id}/members", s.getChannelSubscribers)
+	mux.HandleFunc("GET /api/v1/get_stream_id", s.getChannelID)
+	mux.HandleFunc("GET /api/v1/users/me/subscriptions", s.getSubscriptions)
+	mux.HandleFunc("POST /api/v1/users/me/subscriptions", s.subscribe)
+	mux.HandleFunc("DELETE /api/v1/users/me/subscriptions", s.unsubscribe)
+	mux.HandleFunc("GET /api/v1/users/{user}/subscriptions/{id}", s.getSubscriptionStatus)
+}
+
+func (s *Server) getChannels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streams := make([]map[string]any, 0, len(s.channels))
+	for _, c := range s.channels {
+		streams = append(streams, c.toJSON())
+	}
+
+	writeSuccess(w, map[string]any{"streams": streams})
+}
+
+// pathChannel returns the channel of the id path value, writing an error
+// response if it does not exist. The lock must be held.
+func (s *Server) pathChannel(w http.ResponseWriter, r *http.Request) *Channel {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		invalidParam(w, "stream_id")
+		return nil
+	}
+
+	c := s.findChannelByID(id)
+	if c == nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "Invalid channel ID")
+		return nil
+	}
+
+	return c
+}
+
+func (s *Server) getChannel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c := s.pathChannel(w, r); c != nil {
+		writeSuccess(w, map[string]any{"stream": c.toJSON()})
+	}
+}
+
+func (s *Server) getChannelSubscribers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c := s.pathChannel(w, r); c != nil {
+		writeSuccess(w, map[string]any{"subscribers": slices.Clone(c.Subscribers)})
+	}
+}
+
+func (s *Server) getChannelID(w http.ResponseWriter, r *http.Request) {
+	if !r.Form.Has("stream") {
+		missingParam(w, "stream")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChannel(r.Form.Get("stream"))
+	if c == nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, fmt.Sprintf("Invalid channel name '%s'", r.Form.Get("stream")))
+		return
+	}
+
+	writeSuccess(w, map[string]any{"stream_id": c.ID})
+}
+
+func (s *Server) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.currentUser(r)
+	includeSubscribers := formBool(r.Form, "include_subscribers", false)
+
+	subscriptions := []map[string]any{}
+
+	for _, c := range s.channels {
+		if !slices.Contains(c.Subscribers, user.ID) {
+			continue
+		}
+
+		sub := c.toJSON()
+		sub["color"] = "#76ce90"
+		sub["is_muted"] = false
+		sub["pin_to_top"] = false
+
+		if includeSubscribers {
+			sub["subscribers"] = slices.Clone(c.Subscribers)
+		}
+
+		subscriptions = append(subscriptions, sub)
+	}
+
+	writeSuccess(w, map[string]any{"subscriptions": subscriptions})
+}
+
+// principals returns the users of the principals parameter, the current
+// user if there is none. The lock must be held.
+func (s *Server) principals(w http.ResponseWriter, r *http.Request) ([]*User, bool) {
+	if !r.Form.Has("principals") {
+		return []*User{s.currentUser(r)}, true
+	}
+
+	var refs []any
+	if err := json.Unmarshal([]byte(r.Form.Get("principals")), &refs); err != nil {
+		invalidParam(w, "principals")
+		return nil, false
+	}
+
+	users := make([]*User, 0, len(refs))
+
+	for _, ref := range refs {
+		u := s.findUserByRef(fmt.Sprint(ref))
+		if u == nil {
+			writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, fmt.Sprintf("No such user: %v", ref))
+			return nil, false
+		}
+
+		users = append(users, u)
+	}
+
+	return users, true
+}
+
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	if !r.Form.Has("subscriptions") {
+		missingParam(w, "subscriptions")
+		return
+	}
+
+	var list []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal([]byte(r.Form.Get("subscriptions")), &list); err != nil {
+		invalidParam(w, "subscriptions")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, ok := s.principals(w, r)
+	if !ok {
+		return
+	}
+
+	subscribed := map[string][]string{}
+	alreadySubscribed := map[string][]string{}
+
+	for _, item := range list {
+		c := s.findChannel(item.Name)
+		if c == nil {
+			c = s.addChannel(Channel{Name: item.Name, Description: item.Description})
+
+			s.publish(map[string]any{
+				"type":    "stream",
+				"op":      "create",
+				"streams": []map[string]any{c.toJSON()},
+			}, nil)
+		}
+
+		for _, u := range users {
+			key := strconv.Itoa(u.ID)
+
+			if slices.Contains(c.Subscribers, u.ID) {
+				alreadySubscribed[key] = append(alreadySubscribed[key], c.Name)
+				continue
+			}
+
+			c.Subscribers = append(c.Subscribers, u.ID)
+			subscribed[key] = append(subscribed[key], c.Name)
+
+			sub := c.toJSON()
+			sub["subscribers"] = slices.Clone(c.Subscribers)
+
+			s.publish(map[string]any{
+				"type":          "subscription",
+				"op":            "add",
+				"subscriptions": []map[string]any{sub},
+			}, []int{u.ID})
+		}
+	}
+
+	writeSuccess(w, map[string]any{
+		"subscribed":         subscribed,
+		"already_subscribed": alreadySubscribed,
+	})
+}
+
+func (s *Server) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if !r.Form.Has("subscriptions") {
+		missingParam(w, "subscriptions")
+		return
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(r.Form.Get("subscriptions")), &names); err != nil {
+		invalidParam(w, "subscriptions")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, ok := s.principals(w, r)
+	if !ok {
+		return
+	}
+
+	removed := []string{}
+	notRemoved := []string{}
+
+	for _, name := range names {
+		c := s.findChannel(name)
+		if c == nil {
+			writeError(w, http.StatusBadRequest, zulip.CodeStreamDoesNotExist, fmt.Sprintf("Channel '%s' does not exist", name))
+			return
+		}
+
+		for _, u := range users {
+			i := slices.Index(c.Subscribers, u.ID)
+			if i < 0 {
+				notRemoved = append(notRemoved, c.Name)
+				continue
+			}
+
+			c.Subscribers = slices.Delete(c.Subscribers, i, i+1)
+			removed = append(removed, c.Name)
+
+			s.publish(map[string]any{
+				"type":          "subscription",
+				"op":            "remove",
+				"subscriptions": []map[string]any{{"name": c.Name, "stream_id": c.ID}},
+			}, []int{u.ID})
+		}
+	}
+
+	writeSuccess(w, map[string]any{
+		"removed":     removed,
+		"not_removed": notRemoved,
+	})
+}
+
+func (s *Server) getSubscriptionStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUserByRef(r.PathValue("user"))
+	if u == nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "No such user")
+		return
+	}
+
+	if c := s.pathChannel(w, r); c != nil {
+		writeSuccess(w, map[string]any{"is_subscribed": slices.Contains(c.Subscribers, u.ID)})
+	}
+}
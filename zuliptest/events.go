@@ -0,0 +1,226 @@
+package zuliptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+// eventQueue is an event queue registered by a client.
+type eventQueue struct {
+	id     string
+	userID int
+	// eventTypes holds the types of the events sent to the queue, every
+	// type when empty.
+	eventTypes []string
+	events     []map[string]any
+	lastID     int
+	// wake is closed when events are added to the queue.
+	wake chan struct{}
+}
+
+// push adds an event to the queue, assigning its ID.
+func (q *eventQueue) push(event map[string]any) {
+	q.lastID++
+
+	event = maps.Clone(event)
+	event["id"] = q.lastID
+
+	q.events = append(q.events, event)
+
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// accepts reports whether the queue receives the events of the given type.
+func (q *eventQueue) accepts(eventType string) bool {
+	return len(q.eventTypes) == 0 || slices.Contains(q.eventTypes, eventType)
+}
+
+// PushEvent sends an event to the event queues of the given users, or of
+// every user when none is given, for the events the server does not
+// generate itself, like typing notifications. The event ID is assigned by
+// each queue.
+func (s *Server) PushEvent(event map[string]any, userIDs ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(userIDs) == 0 {
+		userIDs = nil
+	}
+
+	s.publish(event, userIDs)
+}
+
+// publish sends an event to the event queues of the given users, every queue
+// when userIDs is nil. The lock must be held.
+func (s *Server) publish(event map[string]any, userIDs []int) {
+	eventType, _ := event["type"].(string)
+
+	for _, q := range s.queues {
+		if userIDs != nil && !slices.Contains(userIDs, q.userID) {
+			continue
+		}
+
+		if q.accepts(eventType) {
+			q.push(event)
+		}
+	}
+}
+
+// EventQueues returns the IDs of the registered event queues.
+func (s *Server) EventQueues() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(s.queues))
+}
+
+// ExpireEventQueues removes every event queue, as Zulip does with the queues
+// that are not polled for a while. The next requests on them fail with a
+// BAD_EVENT_QUEUE_ID error.
+func (s *Server) ExpireEventQueues() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues = map[string]*eventQueue{}
+}
+
+func (s *Server) routeEvents(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/register", s.registerQueue)
+	mux.HandleFunc("GET /api/v1/events", s.getEvents)
+	mux.HandleFunc("DELETE /api/v1/events", s.deleteQueue)
+}
+
+func (s *Server) registerQueue(w http.ResponseWriter, r *http.Request) {
+	var eventTypes []string
+
+	if r.Form.Has("event_types") {
+		if err := json.Unmarshal([]byte(r.Form.Get("event_types")), &eventTypes); err != nil {
+			invalidParam(w, "event_types")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := &eventQueue{
+		id:         fmt.Sprintf("%d:%d", time.Now().Unix(), s.id()),
+		userID:     s.currentUser(r).ID,
+		eventTypes: eventTypes,
+		lastID:     -1,
+		wake:       make(chan struct{}),
+	}
+	s.queues[q.id] = q
+
+	writeSuccess(w, map[string]any{
+		"queue_id":            q.id,
+		"last_event_id":       q.lastID,
+		"max_message_id":      s.maxMessageID(),
+		"zulip_feature_level": s.featureLevel,
+		"zulip_version":       s.version,
+		"zulip_merge_base":    s.version,
+	})
+}
+
+// userQueue returns the queue of the queue_id parameter, writing an error
+// response if it does not exist or belongs to another user. The lock must be
+// held.
+func (s *Server) userQueue(w http.ResponseWriter, r *http.Request) *eventQueue {
+	if !r.Form.Has("queue_id") {
+		missingParam(w, "queue_id")
+		return nil
+	}
+
+	queueID := r.Form.Get("queue_id")
+
+	q, found := s.queues[queueID]
+	if !found || q.userID != s.currentUser(r).ID {
+		writeErrorFields(w, http.StatusBadRequest, zulip.CodeBadEventQueueID,
+			"Bad event queue ID: "+queueID,
+			map[string]any{"queue_id": queueID})
+
+		return nil
+	}
+
+	return q
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	lastEventID, err := formInt(r.Form, "last_event_id", -1)
+	if err != nil {
+		invalidParam(w, "last_event_id")
+		return
+	}
+
+	dontBlock := formBool(r.Form, "dont_block", false)
+	heartbeat := time.NewTimer(s.heartbeat)
+
+	defer heartbeat.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		q := s.userQueue(w, r)
+		if q == nil {
+			return
+		}
+
+		// the events up to last_event_id are acknowledged
+		q.events = slices.DeleteFunc(q.events, func(e map[string]any) bool {
+			id, _ := e["id"].(int)
+			return id <= lastEventID
+		})
+
+		if len(q.events) > 0 || dontBlock {
+			writeSuccess(w, map[string]any{
+				"events":   slices.Clone(q.events),
+				"queue_id": q.id,
+			})
+
+			return
+		}
+
+		wake := q.wake
+
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+			s.mu.Lock()
+		case <-heartbeat.C:
+			s.mu.Lock()
+
+			if q, found := s.queues[q.id]; found {
+				q.push(map[string]any{"type": "heartbeat"})
+			}
+		case <-r.Context().Done():
+			s.mu.Lock()
+			return
+		case <-s.done:
+			s.mu.Lock()
+			return
+		}
+	}
+}
+
+func (s *Server) deleteQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.userQueue(w, r)
+	if q == nil {
+		return
+	}
+
+	delete(s.queues, q.id)
+
+	writeSuccess(w, map[string]any{})
+}
@@ -0,0 +1,162 @@
+package zuliptest
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	// Form holds the parameters of the query string and of the body.
+	Form url.Values
+	// FileName is the name of the uploaded file of multipart requests.
+	FileName string
+	Header   http.Header
+	// UserEmail is the email of the basic auth credentials.
+	UserEmail string
+}
+
+// Requests returns the requests received so far, in order, including the
+// ones rejected by an injected fault or by the authentication.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received with the given method and path.
+func (s *Server) RequestsTo(method, path string) []Request {
+	var matched []Request
+
+	for _, r := range s.Requests() {
+		if r.Method == method && r.Path == path {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
+
+// ResetRequests clears the request log.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+// Fault is an abnormal behaviour of the server for the requests it matches.
+//
+// A fault with a StatusCode replaces the response: a Zulip error with Code
+// and Msg, or Body as is when it is set, like the HTML page of a proxy. A
+// fault with a Delay only slows down the normal response.
+type Fault struct {
+	// Method and Path select the requests affected by the fault, empty
+	// values match every request.
+	Method string
+	Path   string
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code and Msg are the error code and message of the Zulip error
+	// response.
+	Code string
+	Msg  string
+	// Body replaces the Zulip error response.
+	Body string
+	// ContentType is the content type of Body.
+	ContentType string
+	// Header holds extra HTTP headers sent with the response, for example
+	// Retry-After.
+	Header http.Header
+
+	// Delay is the time waited before responding.
+	Delay time.Duration
+
+	// Times is the number of requests affected, 0 for every request.
+	Times int
+
+	hits int
+}
+
+// InjectFault adds a fault to the server. Faults are matched in the order
+// they are added and stop applying once they are used Times times.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// matchFault returns the first fault matching the request, counting it as
+// used. The lock must be held.
+func (s *Server) matchFault(method, path string) *Fault {
+	for _, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+
+		if f.Path != "" && f.Path != path {
+			continue
+		}
+
+		if f.Times > 0 && f.hits >= f.Times {
+			continue
+		}
+
+		f.hits++
+		applied := *f
+
+		return &applied
+	}
+
+	return nil
+}
+
+// apply waits for the fault delay and writes its response, if any. It
+// returns whether the response has been written.
+func (f *Fault) apply(w http.ResponseWriter, done <-chan struct{}) bool {
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+		}
+	}
+
+	if f.StatusCode == 0 {
+		return false
+	}
+
+	for k, v := range f.Header {
+		w.Header()[k] = v
+	}
+
+	if f.Body != "" || f.Code == "" {
+		if f.ContentType != "" {
+			w.Header().Set("Content-Type", f.ContentType)
+		}
+
+		w.WriteHeader(f.StatusCode)
+		_, _ = w.Write([]byte(f.Body))
+
+		return true
+	}
+
+	writeError(w, f.StatusCode, f.Code, f.Msg)
+
+	return true
+}
@@ -0,0 +1,775 @@
+package zuliptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+// Message is a message of the fake server.
+type Message struct {
+	ID       int
+	SenderID int
+	// ChannelID and Topic are set for channel messages.
+	ChannelID int
+	Topic     string
+	// Recipients holds the IDs of the participants of direct messages, the
+	// sender included.
+	Recipients []int
+	Content    string
+	Timestamp  time.Time
+	Reactions  []Reaction
+}
+
+// IsDirect reports whether the message is a direct message.
+func (m *Message) IsDirect() bool {
+	return m.ChannelID == 0
+}
+
+// Reaction is an emoji reaction to a message.
+type Reaction struct {
+	UserID       int
+	EmojiName    string
+	EmojiCode    string
+	ReactionType zulip.ReactionType
+}
+
+func (m *Message) clone() Message {
+	clone := *m
+	clone.Recipients = slices.Clone(m.Recipients)
+	clone.Reactions = slices.Clone(m.Reactions)
+
+	return clone
+}
+
+// AddMessage adds a message to the server, as if it had been sent by its
+// sender, and returns it with its assigned ID. A message event is sent to
+// the event queues of its recipients.
+func (s *Server) AddMessage(m Message) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addMessage(m).clone()
+}
+
+// addMessage adds a message and publishes its event. The lock must be held.
+func (s *Server) addMessage(m Message) *Message {
+	m.ID = s.id()
+	m.Recipients = slices.Clone(m.Recipients)
+	m.Reactions = slices.Clone(m.Reactions)
+
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+
+	if m.IsDirect() && !slices.Contains(m.Recipients, m.SenderID) {
+		m.Recipients = append(m.Recipients, m.SenderID)
+	}
+
+	s.messages = append(s.messages, &m)
+
+	s.publish(map[string]any{
+		"type":    "message",
+		"message": s.messageJSON(&m),
+		"flags":   []string{},
+	}, s.audience(&m))
+
+	return &m
+}
+
+// Messages returns every message of the server, in the order they were sent.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages))
+	for _, m := range s.messages {
+		messages = append(messages, m.clone())
+	}
+
+	return messages
+}
+
+// maxMessageID returns the ID of the last message, -1 if there is none. The
+// lock must be held.
+func (s *Server) maxMessageID() int {
+	if len(s.messages) == 0 {
+		return -1
+	}
+
+	return s.messages[len(s.messages)-1].ID
+}
+
+// findMessage returns the message with the given ID, nil if there is none.
+// The lock must be held.
+func (s *Server) findMessage(id int) *Message {
+	for _, m := range s.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// audience returns the IDs of the users receiving the events of a message.
+// The lock must be held.
+func (s *Server) audience(m *Message) []int {
+	if m.IsDirect() {
+		return slices.Clone(m.Recipients)
+	}
+
+	users := []int{m.SenderID}
+
+	if c := s.findChannelByID(m.ChannelID); c != nil {
+		for _, id := range c.Subscribers {
+			if id != m.SenderID {
+				users = append(users, id)
+			}
+		}
+	}
+
+	return users
+}
+
+// messageJSON returns the message as returned by the messages endpoints. The
+// lock must be held.
+func (s *Server) messageJSON(m *Message) map[string]any {
+	data := map[string]any{
+		"id":               m.ID,
+		"sender_id":        m.SenderID,
+		"content":          m.Content,
+		"content_type":     "text/x-markdown",
+		"client":           "zuliptest",
+		"timestamp":        m.Timestamp.Unix(),
+		"is_me_message":    strings.HasPrefix(m.Content, "/me "),
+		"sender_realm_str": "zulip",
+		"submessages":      []any{},
+		"topic_links":      []any{},
+		"flags":            []string{},
+	}
+
+	if sender := s.findUserByID(m.SenderID); sender != nil {
+		data["sender_email"] = sender.Email
+		data["sender_full_name"] = sender.FullName
+	}
+
+	reactions := make([]map[string]any, 0, len(m.Reactions))
+	for _, r := range m.Reactions {
+		reactions = append(reactions, map[string]any{
+			"emoji_name":    r.EmojiName,
+			"emoji_code":    r.EmojiCode,
+			"reaction_type": r.ReactionType,
+			"user_id":       r.UserID,
+		})
+	}
+
+	data["reactions"] = reactions
+
+	if m.IsDirect() {
+		recipients := make([]map[string]any, 0, len(m.Recipients))
+
+		for _, id := range m.Recipients {
+			if u := s.findUserByID(id); u != nil {
+				recipients = append(recipients, map[string]any{
+					"id":              u.ID,
+					"email":           u.Email,
+					"full_name":       u.FullName,
+					"is_mirror_dummy": false,
+				})
+			}
+		}
+
+		data["type"] = "private"
+		data["display_recipient"] = recipients
+		data["subject"] = ""
+
+		return data
+	}
+
+	data["type"] = "stream"
+	data["stream_id"] = m.ChannelID
+	data["subject"] = m.Topic
+
+	if c := s.findChannelByID(m.ChannelID); c != nil {
+		data["display_recipient"] = c.Name
+	}
+
+	return data
+}
+
+func (s *Server) routeMessages(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/messages", s.sendMessage)
+	mux.HandleFunc("GET /api/v1/messages", s.getMessages)
+	mux.HandleFunc("GET /api/v1/messages/{id}", s.getMessage)
+	mux.HandleFunc("PATCH /api/v1/messages/{id}", s.editMessage)
+	mux.HandleFunc("DELETE /api/v1/messages/{id}", s.deleteMessage)
+	mux.HandleFunc("POST /api/v1/messages/{id}/reactions", s.addReaction)
+	mux.HandleFunc("DELETE /api/v1/messages/{id}/reactions", s.removeReaction)
+	mux.HandleFunc("POST /api/v1/messages/flags", s.updateMessageFlags)
+}
+
+// refs parses a parameter holding either a JSON list or a single value.
+func refs(value string) []string {
+	var list []any
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return []string{value}
+	}
+
+	refs := make([]string, 0, len(list))
+	for _, v := range list {
+		if f, ok := v.(float64); ok {
+			refs = append(refs, strconv.Itoa(int(f)))
+			continue
+		}
+
+		refs = append(refs, fmt.Sprint(v))
+	}
+
+	return refs
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{"type", "to", "content"} {
+		if !r.Form.Has(name) {
+			missingParam(w, name)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := Message{
+		SenderID: s.currentUser(r).ID,
+		Content:  r.Form.Get("content"),
+	}
+
+	messageType := r.Form.Get("type")
+	if (messageType == "channel" && s.featureLevel < zulip.FeatureLevelChannelMessageType) ||
+		(messageType == "direct" && s.featureLevel < zulip.FeatureLevelDirectMessageType) {
+		invalidParam(w, "type")
+		return
+	}
+
+	switch messageType {
+	case "stream", "channel":
+		to := refs(r.Form.Get("to"))[0]
+
+		c := s.findChannelByRef(to)
+		if c == nil {
+			writeErrorFields(w, http.StatusBadRequest, zulip.CodeStreamDoesNotExist,
+				fmt.Sprintf("Channel '%s' does not exist", to),
+				map[string]any{"stream": to})
+
+			return
+		}
+
+		m.ChannelID = c.ID
+		m.Topic = r.Form.Get("topic")
+
+		if !r.Form.Has("topic") {
+			m.Topic = r.Form.Get("subject")
+		}
+	case "direct", "private":
+		for _, ref := range refs(r.Form.Get("to")) {
+			u := s.findUserByRef(ref)
+			if u == nil {
+				writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, fmt.Sprintf("Invalid email '%s'", ref))
+				return
+			}
+
+			m.Recipients = append(m.Recipients, u.ID)
+		}
+	default:
+		invalidParam(w, "type")
+		return
+	}
+
+	writeSuccess(w, map[string]any{"id": s.addMessage(m).ID})
+}
+
+// pathMessage returns the message of the id path value, writing an error
+// response if it does not exist. The lock must be held.
+func (s *Server) pathMessage(w http.ResponseWriter, r *http.Request) *Message {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		invalidParam(w, "message_id")
+		return nil
+	}
+
+	m := s.findMessage(id)
+	if m == nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "Invalid message(s)")
+		return nil
+	}
+
+	return m
+}
+
+func (s *Server) getMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m := s.pathMessage(w, r); m != nil {
+		writeSuccess(w, map[string]any{
+			"message":     s.messageJSON(m),
+			"raw_content": m.Content,
+		})
+	}
+}
+
+// narrowTerm is an operator and operand pair of a narrow.
+type narrowTerm struct {
+	Operator string `json:"operator"`
+	Operand  any    `json:"operand"`
+	Negated  bool   `json:"negated"`
+}
+
+// parseNarrow decodes a narrow given either as a list of objects or in the
+// legacy list of pairs format.
+func parseNarrow(value string) ([]narrowTerm, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, err
+	}
+
+	terms := make([]narrowTerm, 0, len(items))
+
+	for _, item := range items {
+		var term narrowTerm
+		if err := json.Unmarshal(item, &term); err == nil {
+			terms = append(terms, term)
+			continue
+		}
+
+		var pair []any
+		if err := json.Unmarshal(item, &pair); err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("invalid narrow element %s", item)
+		}
+
+		terms = append(terms, narrowTerm{Operator: fmt.Sprint(pair[0]), Operand: pair[1]})
+	}
+
+	return terms, nil
+}
+
+// matches reports whether a message matches a narrow term. The lock must be
+// held.
+func (s *Server) matches(m *Message, t narrowTerm) (bool, error) {
+	operand := fmt.Sprint(t.Operand)
+	if f, ok := t.Operand.(float64); ok {
+		operand = strconv.Itoa(int(f))
+	}
+
+	if (t.Operator == "channel" || t.Operator == "channels") && s.featureLevel < zulip.FeatureLevelChannelNarrow ||
+		(t.Operator == "dm" || t.Operator == "dm-including") && s.featureLevel < zulip.FeatureLevelDmNarrow {
+		return false, fmt.Errorf("unsupported operator %q", t.Operator)
+	}
+
+	var match bool
+
+	switch t.Operator {
+	case "channel", "stream":
+		c := s.findChannelByRef(operand)
+		match = c != nil && m.ChannelID == c.ID
+	case "topic":
+		match = !m.IsDirect() && strings.EqualFold(m.Topic, operand)
+	case "sender":
+		u := s.findUserByRef(operand)
+		match = u != nil && m.SenderID == u.ID
+	case "id":
+		match = strconv.Itoa(m.ID) == operand
+	case "search":
+		match = strings.Contains(strings.ToLower(m.Content), strings.ToLower(operand))
+	case "dm", "pm-with":
+		match = m.IsDirect()
+
+		for _, ref := range refs(operand) {
+			u := s.findUserByRef(ref)
+			match = match && u != nil && slices.Contains(m.Recipients, u.ID)
+		}
+	case "is":
+		switch operand {
+		case "dm", "private":
+			match = m.IsDirect()
+		default:
+			return false, fmt.Errorf("unsupported operand %q", operand)
+		}
+	default:
+		return false, fmt.Errorf("unsupported operator %q", t.Operator)
+	}
+
+	return match != t.Negated, nil
+}
+
+func (s *Server) getMessages(w http.ResponseWriter, r *http.Request) {
+	numBefore, err := formInt(r.Form, "num_before", 0)
+	if err != nil {
+		invalidParam(w, "num_before")
+		return
+	}
+
+	numAfter, err := formInt(r.Form, "num_after", 0)
+	if err != nil {
+		invalidParam(w, "num_after")
+		return
+	}
+
+	var terms []narrowTerm
+
+	if r.Form.Has("narrow") {
+		if terms, err = parseNarrow(r.Form.Get("narrow")); err != nil {
+			writeError(w, http.StatusBadRequest, zulip.CodeBadNarrow, "Invalid narrow")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.currentUser(r)
+
+	// the messages visible to the user matching the narrow
+	var matched []*Message
+
+	for _, m := range s.messages {
+		if m.IsDirect() && !slices.Contains(m.Recipients, user.ID) {
+			continue
+		}
+
+		ok := true
+
+		for _, t := range terms {
+			match, err := s.matches(m, t)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, zulip.CodeBadNarrow, "Invalid narrow operator: "+err.Error())
+				return
+			}
+
+			ok = ok && match
+		}
+
+		if ok {
+			matched = append(matched, m)
+		}
+	}
+
+	anchor, foundAnchor, err := s.anchor(r.Form.Get("anchor"), matched)
+	if err != nil {
+		invalidParam(w, "anchor")
+		return
+	}
+
+	includeAnchor := formBool(r.Form, "include_anchor", true)
+
+	// index of the anchor, or of the first message after it
+	pivot := slices.IndexFunc(matched, func(m *Message) bool { return m.ID >= anchor })
+	if pivot < 0 {
+		pivot = len(matched)
+	}
+
+	start := max(pivot-numBefore, 0)
+
+	afterStart := pivot
+	if foundAnchor {
+		afterStart++
+	}
+
+	end := min(afterStart+numAfter, len(matched))
+
+	result := make([]map[string]any, 0, end-start)
+
+	for i := start; i < end; i++ {
+		if foundAnchor && i == pivot && !includeAnchor {
+			continue
+		}
+
+		result = append(result, s.messageJSON(matched[i]))
+	}
+
+	writeSuccess(w, map[string]any{
+		"anchor":          anchor,
+		"found_anchor":    foundAnchor,
+		"found_oldest":    start == 0,
+		"found_newest":    end == len(matched),
+		"history_limited": false,
+		"messages":        result,
+	})
+}
+
+// anchor resolves the anchor parameter to a message ID and reports whether
+// a matching message has this ID.
+func (s *Server) anchor(value string, matched []*Message) (int, bool, error) {
+	var anchor int
+
+	switch value {
+	case "newest", "":
+		if len(matched) == 0 {
+			return 0, false, nil
+		}
+
+		anchor = matched[len(matched)-1].ID
+	case "oldest":
+		if len(matched) == 0 {
+			return 0, false, nil
+		}
+
+		anchor = matched[0].ID
+	case "first_unread":
+		anchor = s.maxMessageID() + 1
+	default:
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false, err
+		}
+
+		anchor = id
+	}
+
+	found := slices.ContainsFunc(matched, func(m *Message) bool { return m.ID == anchor })
+
+	return anchor, found, nil
+}
+
+func (s *Server) editMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.pathMessage(w, r)
+	if m == nil {
+		return
+	}
+
+	user := s.currentUser(r)
+
+	event := map[string]any{
+		"type":           "update_message",
+		"user_id":        user.ID,
+		"message_id":     m.ID,
+		"message_ids":    []int{m.ID},
+		"flags":          []string{},
+		"edit_timestamp": time.Now().Unix(),
+		"rendering_only": false,
+	}
+
+	if r.Form.Has("content") {
+		if m.SenderID != user.ID {
+			writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "You don't have permission to edit this message")
+			return
+		}
+
+		event["orig_content"] = m.Content
+		event["content"] = r.Form.Get("content")
+		m.Content = r.Form.Get("content")
+	}
+
+	if r.Form.Has("topic") && !m.IsDirect() {
+		event["orig_subject"] = m.Topic
+		event["subject"] = r.Form.Get("topic")
+		event["propagate_mode"] = "change_one"
+
+		if r.Form.Has("propagate_mode") {
+			event["propagate_mode"] = r.Form.Get("propagate_mode")
+		}
+
+		m.Topic = r.Form.Get("topic")
+	}
+
+	if !m.IsDirect() {
+		event["stream_id"] = m.ChannelID
+
+		if r.Form.Has("stream_id") {
+			id, err := strconv.Atoi(r.Form.Get("stream_id"))
+			if err != nil || s.findChannelByID(id) == nil {
+				invalidParam(w, "stream_id")
+				return
+			}
+
+			event["new_stream_id"] = id
+			m.ChannelID = id
+		}
+	}
+
+	s.publish(event, s.audience(m))
+
+	writeSuccess(w, map[string]any{"detached_uploads": []any{}})
+}
+
+func (s *Server) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.pathMessage(w, r)
+	if m == nil {
+		return
+	}
+
+	event := map[string]any{
+		"type":        "delete_message",
+		"message_id":  m.ID,
+		"message_ids": []int{m.ID},
+	}
+
+	if m.IsDirect() {
+		event["message_type"] = "private"
+	} else {
+		event["message_type"] = "stream"
+		event["stream_id"] = m.ChannelID
+		event["topic"] = m.Topic
+	}
+
+	audience := s.audience(m)
+
+	s.messages = slices.DeleteFunc(s.messages, func(other *Message) bool { return other == m })
+
+	s.publish(event, audience)
+
+	writeSuccess(w, map[string]any{})
+}
+
+// pathReaction returns the message of the id path value and the reaction of
+// the request parameters, writing an error response if they are not valid.
+// The lock must be held.
+func (s *Server) pathReaction(w http.ResponseWriter, r *http.Request) (*Message, Reaction, bool) {
+	m := s.pathMessage(w, r)
+	if m == nil {
+		return nil, Reaction{}, false
+	}
+
+	if !r.Form.Has("emoji_name") && !r.Form.Has("emoji_code") {
+		missingParam(w, "emoji_name")
+		return nil, Reaction{}, false
+	}
+
+	reaction := Reaction{
+		UserID:       s.currentUser(r).ID,
+		EmojiName:    r.Form.Get("emoji_name"),
+		EmojiCode:    r.Form.Get("emoji_code"),
+		ReactionType: zulip.ReactionType(r.Form.Get("reaction_type")),
+	}
+
+	if reaction.EmojiCode == "" {
+		reaction.EmojiCode = reaction.EmojiName
+	}
+
+	if reaction.ReactionType == "" {
+		reaction.ReactionType = zulip.UnicodeEmojiType
+	}
+
+	return m, reaction, true
+}
+
+// reactionIndex returns the index of the reaction of the same user with the
+// same emoji, -1 if there is none.
+func reactionIndex(m *Message, reaction Reaction) int {
+	return slices.IndexFunc(m.Reactions, func(other Reaction) bool {
+		return other.UserID == reaction.UserID &&
+			other.ReactionType == reaction.ReactionType &&
+			(other.EmojiCode == reaction.EmojiCode || other.EmojiName == reaction.EmojiName)
+	})
+}
+
+// publishReaction sends a reaction event. The lock must be held.
+func (s *Server) publishReaction(op string, m *Message, reaction Reaction) {
+	s.publish(map[string]any{
+		"type":          "reaction",
+		"op":            op,
+		"message_id":    m.ID,
+		"user_id":       reaction.UserID,
+		"emoji_name":    reaction.EmojiName,
+		"emoji_code":    reaction.EmojiCode,
+		"reaction_type": reaction.ReactionType,
+	}, s.audience(m))
+}
+
+func (s *Server) addReaction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, reaction, ok := s.pathReaction(w, r)
+	if !ok {
+		return
+	}
+
+	if reactionIndex(m, reaction) >= 0 {
+		writeError(w, http.StatusBadRequest, zulip.CodeReactionAlreadyExists, "Reaction already exists.")
+		return
+	}
+
+	m.Reactions = append(m.Reactions, reaction)
+	s.publishReaction("add", m, reaction)
+
+	writeSuccess(w, map[string]any{})
+}
+
+func (s *Server) removeReaction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, reaction, ok := s.pathReaction(w, r)
+	if !ok {
+		return
+	}
+
+	i := reactionIndex(m, reaction)
+	if i < 0 {
+		writeError(w, http.StatusBadRequest, zulip.CodeReactionDoesNotExist, "Reaction doesn't exist.")
+		return
+	}
+
+	reaction = m.Reactions[i]
+	m.Reactions = slices.Delete(m.Reactions, i, i+1)
+	s.publishReaction("remove", m, reaction)
+
+	writeSuccess(w, map[string]any{})
+}
+
+// updateMessageFlags sends an update_message_flags event to the current user.
+// The flags are not stored.
+func (s *Server) updateMessageFlags(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{"messages", "op", "flag"} {
+		if !r.Form.Has(name) {
+			missingParam(w, name)
+			return
+		}
+	}
+
+	op := r.Form.Get("op")
+	if op != "add" && op != "remove" {
+		invalidParam(w, "op")
+		return
+	}
+
+	var ids []int
+	if err := json.Unmarshal([]byte(r.Form.Get("messages")), &ids); err != nil {
+		invalidParam(w, "messages")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if s.findMessage(id) == nil {
+			writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "Invalid message(s)")
+			return
+		}
+	}
+
+	s.publish(map[string]any{
+		"type":     "update_message_flags",
+		"op":       op,
+		"flag":     r.Form.Get("flag"),
+		"messages": ids,
+		"all":      false,
+	}, []int{s.currentUser(r).ID})
+
+	writeSuccess(w, map[string]any{"messages": ids})
+}
@@ -0,0 +1,26 @@
+package zuliptest
+
+import "net/http"
+
+// serverSettingsPath is the only endpoint not requiring authentication.
+const serverSettingsPath = "/api/v1/server_settings"
+
+func (s *Server) routeServerSettings(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+serverSettingsPath, s.getServerSettings)
+}
+
+func (s *Server) getServerSettings(w http.ResponseWriter, r *http.Request) {
+	writeSuccess(w, map[string]any{
+		"zulip_feature_level":            s.featureLevel,
+		"zulip_version":                  s.version,
+		"zulip_merge_base":               s.version,
+		"push_notifications_enabled":     false,
+		"is_incompatible":                false,
+		"email_auth_enabled":             true,
+		"require_email_format_usernames": true,
+		"realm_uri":                      s.URL,
+		"realm_url":                      s.URL,
+		"realm_name":                     "Zulip Test",
+		"authentication_methods":         map[string]bool{"password": true},
+	})
+}
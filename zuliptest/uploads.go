@@ -0,0 +1,106 @@
+package zuliptest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+// Upload is a file uploaded to the fake server.
+type Upload struct {
+	ID       int
+	UserID   int
+	FileName string
+	Content  []byte
+	// URL is the relative URL of the file, as returned to the uploader.
+	URL string
+}
+
+// Uploads returns every file uploaded to the server.
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploads := make([]Upload, 0, len(s.uploads))
+	for _, u := range s.uploads {
+		clone := *u
+		clone.Content = bytes.Clone(u.Content)
+		uploads = append(uploads, clone)
+	}
+
+	return uploads
+}
+
+func (s *Server) routeUploads(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/user_uploads", s.uploadFile)
+	mux.HandleFunc("GET /user_uploads/{realm}/{id}/{name}", s.getUpload)
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "You must specify a file to upload")
+		return
+	}
+
+	part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+	if err != nil || part.FileName() == "" {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "You must specify a file to upload")
+		return
+	}
+
+	content, err := io.ReadAll(part)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload := &Upload{
+		ID:       s.id(),
+		UserID:   s.currentUser(r).ID,
+		FileName: path.Base(part.FileName()),
+		Content:  content,
+	}
+	upload.URL = fmt.Sprintf("/user_uploads/1/%d/%s", upload.ID, url.PathEscape(upload.FileName))
+
+	s.uploads = append(s.uploads, upload)
+
+	writeSuccess(w, map[string]any{
+		"uri":      upload.URL,
+		"url":      upload.URL,
+		"filename": upload.FileName,
+	})
+}
+
+func (s *Server) getUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.uploads {
+		if u.ID == id {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": u.FileName}))
+			_, _ = w.Write(u.Content)
+
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
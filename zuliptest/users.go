@@ -0,0 +1,245 @@
+package zuliptest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+// User is a user of the fake server.
+type User struct {
+	ID       int
+	Email    string
+	FullName string
+	// APIKey is generated from the email when empty.
+	APIKey string
+	// Role defaults to zulip.MemberRole.
+	Role        zulip.OrganizationRoleLevel
+	IsBot       bool
+	Deactivated bool
+	Timezone    string
+	DateJoined  time.Time
+}
+
+func (u *User) active() bool {
+	return !u.Deactivated
+}
+
+// toJSON returns the user as returned by the users endpoints.
+func (u *User) toJSON() map[string]any {
+	return map[string]any{
+		"user_id":          u.ID,
+		"email":            u.Email,
+		"delivery_email":   u.Email,
+		"full_name":        u.FullName,
+		"role":             u.Role,
+		"is_owner":         u.Role == zulip.OwnerRole,
+		"is_admin":         u.Role == zulip.OwnerRole || u.Role == zulip.AdministratorRole,
+		"is_guest":         u.Role == zulip.GuestRole,
+		"is_billing_admin": false,
+		"is_bot":           u.IsBot,
+		"is_active":        u.active(),
+		"timezone":         u.Timezone,
+		"date_joined":      u.DateJoined.Format(time.RFC3339),
+		"avatar_url":       "",
+		"avatar_version":   1,
+		"profile_data":     map[string]any{},
+	}
+}
+
+// AddUser adds a user to the server and returns it with its assigned ID.
+func (s *Server) AddUser(u User) User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.addUser(u)
+}
+
+// addUser adds a user. The lock must be held.
+func (s *Server) addUser(u User) *User {
+	u.ID = s.id()
+
+	if u.APIKey == "" {
+		u.APIKey = "key-" + strconv.Itoa(u.ID)
+	}
+
+	if u.Role == 0 {
+		u.Role = zulip.MemberRole
+	}
+
+	if u.FullName == "" {
+		u.FullName, _, _ = strings.Cut(u.Email, "@")
+	}
+
+	if u.DateJoined.IsZero() {
+		u.DateJoined = time.Now()
+	}
+
+	s.users = append(s.users, &u)
+
+	return &u
+}
+
+// User returns the user with the given email.
+func (s *Server) User(email string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(email)
+	if u == nil {
+		return User{}, false
+	}
+
+	return *u, true
+}
+
+// Users returns every user of the server.
+func (s *Server) Users() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, *u)
+	}
+
+	return users
+}
+
+// RegenerateAPIKey replaces the API key of the user with the given email, as
+// rotating it does, and returns the new key.
+func (s *Server) RegenerateAPIKey(email string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(email)
+	if u == nil {
+		return "", false
+	}
+
+	return s.regenerateAPIKey(u), true
+}
+
+// regenerateAPIKey gives a new API key to the user. The lock must be held.
+func (s *Server) regenerateAPIKey(u *User) string {
+	u.APIKey = "key-" + strconv.Itoa(u.ID) + "-" + strconv.Itoa(s.id())
+	return u.APIKey
+}
+
+// findUser returns the user with the given email, nil if there is none. The
+// lock must be held.
+func (s *Server) findUser(email string) *User {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// findUserByID returns the user with the given ID, nil if there is none. The
+// lock must be held.
+func (s *Server) findUserByID(id int) *User {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// findUserByRef returns the user referenced by an ID or an email. The lock
+// must be held.
+func (s *Server) findUserByRef(ref string) *User {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return s.findUserByID(id)
+	}
+
+	return s.findUser(ref)
+}
+
+func (s *Server) routeUsers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/users", s.getUsers)
+	mux.HandleFunc("POST /api/v1/users", s.createUser)
+	mux.HandleFunc("GET /api/v1/users/me", s.getUserMe)
+	mux.HandleFunc("POST /api/v1/users/me/api_key/regenerate", s.regenerateAPIKeyMe)
+	mux.HandleFunc("GET /api/v1/users/{user}", s.getUser)
+}
+
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make([]map[string]any, 0, len(s.users))
+	for _, u := range s.users {
+		members = append(members, u.toJSON())
+	}
+
+	writeSuccess(w, map[string]any{"members": members})
+}
+
+func (s *Server) getUserMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.currentUser(r).toJSON()
+	data["max_message_id"] = s.maxMessageID()
+
+	writeSuccess(w, data)
+}
+
+func (s *Server) regenerateAPIKeyMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeSuccess(w, map[string]any{"api_key": s.regenerateAPIKey(s.currentUser(r))})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUserByRef(r.PathValue("user"))
+	if u == nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "No such user")
+		return
+	}
+
+	writeSuccess(w, map[string]any{"user": u.toJSON()})
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{"email", "password", "full_name"} {
+		if !r.Form.Has(name) {
+			missingParam(w, name)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := r.Form.Get("email")
+	if s.findUser(email) != nil {
+		writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, "Email '"+email+"' already in use")
+		return
+	}
+
+	u := s.addUser(User{
+		Email:    email,
+		FullName: r.Form.Get("full_name"),
+	})
+
+	s.publish(map[string]any{
+		"type":   "realm_user",
+		"op":     "add",
+		"person": u.toJSON(),
+	}, nil)
+
+	writeSuccess(w, map[string]any{"user_id": u.ID})
+}
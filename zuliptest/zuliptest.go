@@ -0,0 +1,374 @@
+// Package zuliptest provides an in-process fake Zulip server to test code
+// using the zulip client and its services end to end, with a real
+// zulip.Client sending real HTTP requests.
+//
+// Implemented features:
+//   - In-memory users, channels, subscriptions, messages, reactions and
+//     uploads
+//   - Personal message flag updates, sent as events but not stored
+//   - A working event queue: /register, /events (long polling) and
+//     DELETE /events
+//   - HTTP basic authentication with the users' API keys
+//   - A log of the received requests, with their decoded parameters
+//   - Fault injection: error responses, proxy pages and latency
+//
+// Usage:
+//
+//	srv := zuliptest.NewServer()
+//	defer srv.Close()
+//
+//	client, err := zulip.NewClient(srv.Credentials())
+//	...
+//	resp, err := messages.NewService(client).SendMessageToChannelTopic(ctx,
+//		recipient.ToChannel("general"), "greetings", "Hello!")
+//
+//	for _, m := range srv.Messages() {
+//		...
+//	}
+package zuliptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wakumaku/go-zulip"
+)
+
+const (
+	// DefaultUserEmail is the email of the user created with every server,
+	// used by Credentials.
+	DefaultUserEmail = "test-bot@zulip.test"
+	// DefaultUserAPIKey is the API key of the default user.
+	DefaultUserAPIKey = "test-api-key"
+
+	// DefaultFeatureLevel is the feature level reported by the server
+	// unless WithFeatureLevel is given.
+	DefaultFeatureLevel = 334
+	// DefaultVersion is the Zulip version reported by the server.
+	DefaultVersion = "10.0"
+
+	// DefaultHeartbeatInterval is the time an event long poll waits before
+	// returning a heartbeat event, unless WithHeartbeatInterval is given.
+	DefaultHeartbeatInterval = 30 * time.Second
+)
+
+// Server is a fake Zulip server listening on a local address. It is safe for
+// concurrent use.
+type Server struct {
+	// URL is the base URL of the server, to be used as the Zulip site.
+	URL string
+
+	httpServer *httptest.Server
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	heartbeat    time.Duration
+	featureLevel int
+	version      string
+
+	mu       sync.Mutex
+	nextID   int
+	users    []*User
+	channels []*Channel
+	messages []*Message
+	uploads  []*Upload
+	queues   map[string]*eventQueue
+	requests []Request
+	faults   []*Fault
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithHeartbeatInterval sets how long an event long poll waits for events
+// before returning a heartbeat.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeat = d
+	}
+}
+
+// WithFeatureLevel sets the zulip_feature_level reported by the server.
+func WithFeatureLevel(level int) Option {
+	return func(s *Server) {
+		s.featureLevel = level
+	}
+}
+
+// WithVersion sets the zulip_version reported by the server.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// NewServer starts a fake Zulip server with a default user, see
+// DefaultUserEmail. The caller must call Close when done.
+func NewServer(options ...Option) *Server {
+	s := &Server{
+		done:         make(chan struct{}),
+		heartbeat:    DefaultHeartbeatInterval,
+		featureLevel: DefaultFeatureLevel,
+		version:      DefaultVersion,
+		queues:       map[string]*eventQueue{},
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	s.AddUser(User{
+		Email:    DefaultUserEmail,
+		FullName: "Test Bot",
+		APIKey:   DefaultUserAPIKey,
+		Role:     zulip.AdministratorRole,
+		IsBot:    true,
+	})
+
+	s.httpServer = httptest.NewServer(s.handler())
+	s.URL = s.httpServer.URL
+
+	return s
+}
+
+// Close stops the server, ending any pending event long poll.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.httpServer.Close()
+	})
+}
+
+// Credentials returns the credentials of the default user.
+func (s *Server) Credentials() zulip.CredentialsProvider {
+	return zulip.Credentials(s.URL, DefaultUserEmail, DefaultUserAPIKey)
+}
+
+// CredentialsFor returns the credentials of the user with the given email.
+func (s *Server) CredentialsFor(email string) zulip.CredentialsProvider {
+	apiKey := ""
+	if u, found := s.User(email); found {
+		apiKey = u.APIKey
+	}
+
+	return zulip.Credentials(s.URL, email, apiKey)
+}
+
+// id returns a new identifier, unique across every kind of object. The
+// lock must be held.
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	s.routeServerSettings(mux)
+	s.routeUsers(mux)
+	s.routeChannels(mux)
+	s.routeMessages(mux)
+	s.routeUploads(mux)
+	s.routeEvents(mux)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, zulip.CodeBadRequest, "Endpoint not found")
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form, fileName, err := parseRequest(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, zulip.CodeBadRequest, err.Error())
+			return
+		}
+
+		// handlers read the parameters from r.Form
+		r.Form = form
+
+		email, _, _ := r.BasicAuth()
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Form:      form,
+			FileName:  fileName,
+			Header:    r.Header.Clone(),
+			UserEmail: email,
+		})
+		fault := s.matchFault(r.Method, r.URL.Path)
+		s.mu.Unlock()
+
+		if fault != nil && fault.apply(w, s.done) {
+			return
+		}
+
+		if _, ok := s.authenticate(r); !ok && r.URL.Path != serverSettingsPath {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the user of the request credentials.
+func (s *Server) authenticate(r *http.Request) (*User, bool) {
+	email, apiKey, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(email)
+	if u == nil || u.APIKey != apiKey || !u.active() {
+		return nil, false
+	}
+
+	return u, true
+}
+
+// currentUser returns the authenticated user of a request that went through
+// the handler. The lock must be held.
+func (s *Server) currentUser(r *http.Request) *User {
+	email, _, _ := r.BasicAuth()
+	return s.findUser(email)
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeError(w, http.StatusUnauthorized, zulip.CodeUnauthorized, "Not logged in: API authentication or user session required")
+		return
+	}
+
+	writeError(w, http.StatusUnauthorized, zulip.CodeInvalidAPIKey, "Invalid API key")
+}
+
+// parseRequest decodes the form parameters of the query string and of the
+// body, for every method, and the name of the uploaded file of multipart
+// requests.
+func parseRequest(r *http.Request) (url.Values, string, error) {
+	form := url.Values{}
+	for k, v := range r.URL.Query() {
+		form[k] = v
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, "", err
+		}
+
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, "", err
+		}
+
+		for k, v := range values {
+			form[k] = append(form[k], v...)
+		}
+	case "multipart/form-data":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// keep the body for the upload handlers
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if params["boundary"] == "" {
+			return form, "", nil
+		}
+
+		part, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).NextPart()
+		if err != nil {
+			return form, "", nil //nolint:nilerr // not a file upload
+		}
+
+		return form, part.FileName(), nil
+	}
+
+	return form, "", nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, data map[string]any) {
+	if _, found := data["result"]; !found {
+		data["result"] = zulip.ResultSuccess
+	}
+
+	if _, found := data["msg"]; !found {
+		data["msg"] = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func writeSuccess(w http.ResponseWriter, data map[string]any) {
+	writeJSON(w, http.StatusOK, data)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeErrorFields(w, status, code, msg, nil)
+}
+
+func writeErrorFields(w http.ResponseWriter, status int, code, msg string, fields map[string]any) {
+	data := map[string]any{
+		"result": zulip.ResultError,
+		"code":   code,
+		"msg":    msg,
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+
+	writeJSON(w, status, data)
+}
+
+// missingParam writes the error returned by Zulip for a missing parameter.
+func missingParam(w http.ResponseWriter, name string) {
+	writeErrorFields(w, http.StatusBadRequest, zulip.CodeRequestVariableMissing,
+		fmt.Sprintf("Missing '%s' argument", name),
+		map[string]any{"var_name": name})
+}
+
+// invalidParam writes the error returned by Zulip for an invalid parameter.
+func invalidParam(w http.ResponseWriter, name string) {
+	writeErrorFields(w, http.StatusBadRequest, zulip.CodeBadRequest,
+		fmt.Sprintf("Invalid %s", name),
+		map[string]any{"param_name": name})
+}
+
+// formBool parses a boolean parameter, def if it is absent.
+func formBool(form url.Values, name string, def bool) bool {
+	v, err := strconv.ParseBool(form.Get(name))
+	if err != nil {
+		return def
+	}
+
+	return v
+}
+
+// formInt parses an integer parameter, def if it is absent.
+func formInt(form url.Values, name string, def int) (int, error) {
+	if !form.Has(name) {
+		return def, nil
+	}
+
+	return strconv.Atoi(form.Get(name))
+}
@@ -0,0 +1,362 @@
+package zuliptest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/channels"
+	"github.com/wakumaku/go-zulip/messages"
+	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/narrow"
+	"github.com/wakumaku/go-zulip/realtime"
+	"github.com/wakumaku/go-zulip/realtime/events"
+	"github.com/wakumaku/go-zulip/users"
+	"github.com/wakumaku/go-zulip/zuliptest"
+)
+
+func newClient(t *testing.T, creds zulip.CredentialsProvider) *zulip.Client {
+	t.Helper()
+
+	client, err := zulip.NewClient(creds, zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestServerMessages(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := newClient(t, srv.Credentials())
+	alice := srv.AddUser(zuliptest.User{Email: "alice@zulip.test"})
+
+	_, err := channels.NewService(client).SubscribeToChannel(ctx, []channels.SubscribeTo{{Name: "general"}})
+	require.NoError(t, err)
+
+	msgSvc := messages.NewService(client)
+
+	sent, err := msgSvc.SendMessageToChannelTopic(ctx, recipient.ToChannel("general"), "greetings", "Hello!")
+	require.NoError(t, err)
+
+	_, err = msgSvc.SendMessageToUsers(ctx, recipient.ToUser(alice.ID), "Hi Alice")
+	require.NoError(t, err)
+
+	all := srv.Messages()
+	require.Len(t, all, 2)
+	assert.Equal(t, sent.ID, all[0].ID)
+	assert.Equal(t, "greetings", all[0].Topic)
+	assert.True(t, all[1].IsDirect())
+	assert.ElementsMatch(t, []int{alice.ID, all[0].SenderID}, all[1].Recipients)
+
+	found, err := msgSvc.GetMessages(ctx,
+		messages.Anchor("newest"),
+		messages.NumBefore(10),
+		messages.NarrowMessage(narrow.NewFilter().Add(narrow.New(narrow.Channel, "general"))),
+	)
+	require.NoError(t, err)
+	require.Len(t, found.Messages, 1)
+	assert.Equal(t, "Hello!", found.Messages[0].Content)
+	assert.Equal(t, "general", found.Messages[0].DisplayRecipient.Channel)
+	assert.True(t, found.FoundAnchor)
+
+	_, err = msgSvc.EditMessage(ctx, sent.ID, messages.NewContent("Hello, world!"))
+	require.NoError(t, err)
+
+	_, err = msgSvc.AddEmojiReaction(ctx, sent.ID, "wave")
+	require.NoError(t, err)
+
+	_, err = msgSvc.AddEmojiReaction(ctx, sent.ID, "wave")
+	require.ErrorIs(t, err, zulip.ErrReactionAlreadyExists)
+
+	single, err := msgSvc.FetchSingleMessage(ctx, sent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world!", single.Message.Content)
+	require.Len(t, single.Message.Reactions, 1)
+	assert.Equal(t, "wave", single.Message.Reactions[0].EmojiName)
+
+	_, err = msgSvc.DeleteMessage(ctx, sent.ID)
+	require.NoError(t, err)
+	assert.Len(t, srv.Messages(), 1)
+
+	_, err = msgSvc.SendMessageToChannelTopic(ctx, recipient.ToChannel("unknown"), "topic", "Hello?")
+	require.ErrorIs(t, err, zulip.ErrStreamDoesNotExist)
+}
+
+func TestServerUsersAndChannels(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := newClient(t, srv.Credentials())
+
+	created, err := users.NewService(client).CreateUser(ctx, "bob@zulip.test", "secret", "Bob")
+	require.NoError(t, err)
+
+	bob, found := srv.User("bob@zulip.test")
+	require.True(t, found)
+	assert.Equal(t, "Bob", bob.FullName)
+	assert.Equal(t, bob.ID, created.UserID)
+
+	me, err := users.NewService(newClient(t, srv.CredentialsFor("bob@zulip.test"))).GetUserMe(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@zulip.test", me.Email)
+
+	general := srv.AddChannel(zuliptest.Channel{Name: "general", Subscribers: []int{bob.ID}})
+
+	chanSvc := channels.NewService(client)
+
+	id, err := chanSvc.GetChannelID(ctx, "general")
+	require.NoError(t, err)
+	assert.Equal(t, general.ID, id.StreamID)
+
+	subscribers, err := chanSvc.GetChannelSubscribers(ctx, general.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{bob.ID}, subscribers.Subscribers)
+
+	status, err := chanSvc.GetSubscriptionStatus(ctx, bob.ID, general.ID)
+	require.NoError(t, err)
+	assert.True(t, status.IsSubscribed)
+}
+
+func TestServerEventQueue(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := newClient(t, srv.Credentials())
+	rtSvc := realtime.NewService(client)
+
+	queue, err := rtSvc.RegisterEvetQueue(ctx, realtime.EventTypes(events.MessageType))
+	require.NoError(t, err)
+	assert.Equal(t, zuliptest.DefaultFeatureLevel, queue.ZulipFeatureLevel)
+	assert.Equal(t, []string{queue.QueueID}, srv.EventQueues())
+
+	alice := srv.AddUser(zuliptest.User{Email: "alice@zulip.test"})
+	me, _ := srv.User(zuliptest.DefaultUserEmail)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		srv.AddMessage(zuliptest.Message{SenderID: alice.ID, Recipients: []int{me.ID}, Content: "ping"})
+	}()
+
+	// long polls until the message arrives
+	resp, err := rtSvc.GetEventsEventQueue(ctx, queue.QueueID, realtime.LastEventID(queue.LastEventID))
+	require.NoError(t, err)
+	require.Len(t, resp.Events, 1)
+
+	msg, ok := resp.Events[0].(*events.Message)
+	require.True(t, ok)
+	assert.Equal(t, "ping", msg.Message.Content)
+	assert.Equal(t, "alice@zulip.test", msg.Message.SenderEmail)
+
+	// events of other types are filtered out
+	srv.PushEvent(map[string]any{"type": "typing", "op": "start"})
+
+	resp, err = rtSvc.GetEventsEventQueue(ctx, queue.QueueID, realtime.LastEventID(msg.ID), realtime.DontBlock())
+	require.NoError(t, err)
+	assert.Empty(t, resp.Events)
+
+	_, err = rtSvc.DeleteEventQueue(ctx, queue.QueueID)
+	require.NoError(t, err)
+	assert.Empty(t, srv.EventQueues())
+
+	_, err = rtSvc.GetEventsEventQueue(ctx, queue.QueueID)
+	require.ErrorIs(t, err, zulip.ErrBadEventQueueID)
+
+	var apiErr *zulip.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, queue.QueueID, apiErr.Fields["queue_id"])
+}
+
+func TestServerEventQueueHeartbeat(t *testing.T) {
+	srv := zuliptest.NewServer(zuliptest.WithHeartbeatInterval(10 * time.Millisecond))
+	defer srv.Close()
+
+	ctx := context.Background()
+	rtSvc := realtime.NewService(newClient(t, srv.Credentials()))
+
+	queue, err := rtSvc.RegisterEvetQueue(ctx)
+	require.NoError(t, err)
+
+	resp, err := rtSvc.GetEventsEventQueue(ctx, queue.QueueID)
+	require.NoError(t, err)
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, events.HeartbeatType, resp.Events[0].EventType())
+}
+
+func TestServerCloseEndsLongPoll(t *testing.T) {
+	srv := zuliptest.NewServer()
+
+	ctx := context.Background()
+	rtSvc := realtime.NewService(newClient(t, srv.Credentials()))
+
+	queue, err := rtSvc.RegisterEvetQueue(ctx)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _ = rtSvc.GetEventsEventQueue(ctx, queue.QueueID)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	srv.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll not ended by Close")
+	}
+}
+
+func TestServerRequestLog(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	alice := srv.AddUser(zuliptest.User{Email: "alice@zulip.test"})
+
+	_, err := messages.NewService(newClient(t, srv.Credentials())).
+		SendMessageToUsers(ctx, recipient.ToUsers([]int{alice.ID}), "Hi")
+	require.NoError(t, err)
+
+	requests := srv.RequestsTo(http.MethodPost, "/api/v1/messages")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "direct", requests[0].Form.Get("type"))
+	assert.JSONEq(t, `[2]`, requests[0].Form.Get("to"))
+	assert.Equal(t, "Hi", requests[0].Form.Get("content"))
+	assert.Equal(t, zuliptest.DefaultUserEmail, requests[0].UserEmail)
+
+	srv.ResetRequests()
+	assert.Empty(t, srv.Requests())
+}
+
+func TestServerFaults(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	usersSvc := users.NewService(newClient(t, srv.Credentials()))
+
+	srv.InjectFault(zuliptest.Fault{
+		Path:        "/api/v1/users/me",
+		StatusCode:  http.StatusBadGateway,
+		Body:        "<html>502 Bad Gateway</html>",
+		ContentType: "text/html",
+		Times:       1,
+	})
+	srv.InjectFault(zuliptest.Fault{
+		Path:       "/api/v1/users/me",
+		StatusCode: http.StatusTooManyRequests,
+		Code:       zulip.CodeRateLimitHit,
+		Msg:        "API usage exceeded rate limit",
+		Header:     http.Header{"Retry-After": []string{"1"}},
+		Times:      1,
+	})
+
+	_, err := usersSvc.GetUserMe(ctx)
+	require.ErrorIs(t, err, zulip.ErrServerUnavailable)
+
+	_, err = usersSvc.GetUserMe(ctx)
+	require.ErrorIs(t, err, zulip.ErrRateLimited)
+
+	_, err = usersSvc.GetUserMe(ctx)
+	require.NoError(t, err)
+
+	srv.InjectFault(zuliptest.Fault{Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err = usersSvc.GetUserMe(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	srv.ClearFaults()
+	assert.Len(t, srv.Requests(), 4)
+}
+
+func TestServerAuthentication(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	client := newClient(t, zulip.Credentials(srv.URL, zuliptest.DefaultUserEmail, "wrong-key"))
+
+	_, err := users.NewService(client).GetUserMe(context.Background())
+	require.ErrorIs(t, err, zulip.ErrUnauthorized)
+
+	var apiErr *zulip.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, zulip.CodeInvalidAPIKey, apiErr.Code)
+}
+
+func TestServerUploads(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	resp, err := messages.NewService(newClient(t, srv.Credentials())).
+		UploadFileFromBytes(context.Background(), "notes.txt", []byte("some notes"))
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", resp.FileName)
+
+	uploads := srv.Uploads()
+	require.Len(t, uploads, 1)
+	assert.Equal(t, []byte("some notes"), uploads[0].Content)
+	assert.Equal(t, resp.URL, uploads[0].URL)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+resp.URL, nil)
+	require.NoError(t, err)
+	req.SetBasicAuth(zuliptest.DefaultUserEmail, zuliptest.DefaultUserAPIKey)
+
+	httpResp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer httpResp.Body.Close()
+
+	content, err := io.ReadAll(httpResp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "some notes", string(content))
+}
+
+func TestServerFeatureLevel(t *testing.T) {
+	// Zulip 8.0
+	srv := zuliptest.NewServer(zuliptest.WithFeatureLevel(237))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := newClient(t, srv.Credentials())
+	general := srv.AddChannel(zuliptest.Channel{Name: "general"})
+	me, _ := srv.User(zuliptest.DefaultUserEmail)
+
+	srv.AddMessage(zuliptest.Message{SenderID: me.ID, ChannelID: general.ID, Topic: "greetings", Content: "Hello!"})
+
+	queue, err := realtime.NewService(client).RegisterEvetQueue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 237, queue.ZulipFeatureLevel)
+
+	// learned when registering the queue
+	level, err := client.FeatureLevel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 237, level)
+	assert.Empty(t, srv.RequestsTo(http.MethodGet, "/api/v1/server_settings"))
+
+	// the channel operator is sent as stream
+	found, err := messages.NewService(client).GetMessages(ctx,
+		messages.Anchor("newest"),
+		messages.NumBefore(10),
+		messages.NarrowMessage(narrow.NewFilter().Add(narrow.New(narrow.Channel, "general"))),
+	)
+	require.NoError(t, err)
+	require.Len(t, found.Messages, 1)
+
+	requests := srv.RequestsTo(http.MethodGet, "/api/v1/messages")
+	require.Len(t, requests, 1)
+	assert.JSONEq(t, `[{"operator": "stream", "operand": "general", "negated": false}]`, requests[0].Form.Get("narrow"))
+}
@@ -0,0 +1,127 @@
+// Package zulipx bundles the services of the library behind a single client,
+// for programs using several of them.
+//
+// Usage:
+//
+//	z, err := zulipx.New(zulip.DefaultCredentials(), zulip.WithRetry())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	resp, err := z.Messages().SendMessageToChannelTopic(ctx,
+//		recipient.ToChannel("general"), "greetings", "Hello!")
+//	...
+//	queue, err := z.Realtime().RegisterEvetQueue(ctx, realtime.EventTypes(events.MessageType))
+//
+// The services are created on first use and share the same zulip.Client, so
+// its retries, rate limiting and middlewares apply to all of them.
+//
+// Code depending on the API interface instead of *Client can be tested with a
+// bundle built with NewWithClient over a test double of zulip.RESTClient, or
+// over a zulip.Client of a zuliptest server.
+package zulipx
+
+import (
+	"sync"
+
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/channels"
+	"github.com/wakumaku/go-zulip/invitations"
+	"github.com/wakumaku/go-zulip/messages"
+	"github.com/wakumaku/go-zulip/org"
+	"github.com/wakumaku/go-zulip/realtime"
+	"github.com/wakumaku/go-zulip/specialty"
+	"github.com/wakumaku/go-zulip/users"
+)
+
+// API is the bundle of services, implemented by Client.
+type API interface {
+	// REST returns the client shared by the services, to send the requests
+	// without a service method, see zulip.Do.
+	REST() zulip.RESTClient
+
+	Messages() *messages.Service
+	Channels() *channels.Service
+	Users() *users.Service
+	Realtime() *realtime.Service
+	Org() *org.Service
+	Invitations() *invitations.Service
+	Specialty() *specialty.Service
+}
+
+var _ API = (*Client)(nil)
+
+// Client gives access to every service of the library through one
+// zulip.RESTClient.
+type Client struct {
+	client zulip.RESTClient
+
+	messages    lazy[messages.Service]
+	channels    lazy[channels.Service]
+	users       lazy[users.Service]
+	realtime    lazy[realtime.Service]
+	org         lazy[org.Service]
+	invitations lazy[invitations.Service]
+	specialty   lazy[specialty.Service]
+}
+
+// New creates the zulip.Client of the bundle, see zulip.NewClient.
+func New(credentials zulip.CredentialsProvider, options ...zulip.ClientOption) (*Client, error) {
+	client, err := zulip.NewClient(credentials, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithClient(client), nil
+}
+
+// NewWithClient creates a bundle using an existing client.
+func NewWithClient(client zulip.RESTClient) *Client {
+	return &Client{client: client}
+}
+
+func (c *Client) REST() zulip.RESTClient {
+	return c.client
+}
+
+func (c *Client) Messages() *messages.Service {
+	return c.messages.get(c.client, messages.NewService)
+}
+
+func (c *Client) Channels() *channels.Service {
+	return c.channels.get(c.client, channels.NewService)
+}
+
+func (c *Client) Users() *users.Service {
+	return c.users.get(c.client, users.NewService)
+}
+
+func (c *Client) Realtime() *realtime.Service {
+	return c.realtime.get(c.client, realtime.NewService)
+}
+
+func (c *Client) Org() *org.Service {
+	return c.org.get(c.client, org.NewService)
+}
+
+func (c *Client) Invitations() *invitations.Service {
+	return c.invitations.get(c.client, invitations.NewService)
+}
+
+func (c *Client) Specialty() *specialty.Service {
+	return c.specialty.get(c.client, specialty.NewService)
+}
+
+// lazy is a service created on first use.
+type lazy[S any] struct {
+	once    sync.Once
+	service *S
+}
+
+func (l *lazy[S]) get(client zulip.RESTClient, newService func(zulip.RESTClient) *S) *S {
+	l.once.Do(func() {
+		l.service = newService(client)
+	})
+
+	return l.service
+}
@@ -0,0 +1,102 @@
+package zulipx_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wakumaku/go-zulip"
+	"github.com/wakumaku/go-zulip/messages/recipient"
+	"github.com/wakumaku/go-zulip/zuliptest"
+	"github.com/wakumaku/go-zulip/zulipx"
+)
+
+func TestNew(t *testing.T) {
+	srv := zuliptest.NewServer()
+	defer srv.Close()
+
+	srv.AddChannel(zuliptest.Channel{Name: "general"})
+
+	z, err := zulipx.New(srv.Credentials(), zulip.WithAPIErrors())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	me, err := z.Users().GetUserMe(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, zuliptest.DefaultUserEmail, me.Email)
+
+	_, err = z.Messages().SendMessageToChannelTopic(ctx, recipient.ToChannel("general"), "greetings", "Hello!")
+	require.NoError(t, err)
+	require.Len(t, srv.Messages(), 1)
+
+	// the options of the client apply to every service
+	_, err = z.Channels().GetChannelID(ctx, "unknown")
+	require.Error(t, err)
+
+	_, err = zulipx.New(srv.Credentials(), zulip.WithHTTPClient(nil))
+	require.Error(t, err)
+}
+
+func TestServicesAreShared(t *testing.T) {
+	z := zulipx.NewWithClient(&fakeClient{})
+
+	var wg sync.WaitGroup
+
+	services := make([]any, 8)
+	for i := range services {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			services[i] = z.Realtime()
+		}()
+	}
+
+	wg.Wait()
+
+	for _, s := range services {
+		assert.Same(t, z.Realtime(), s)
+	}
+
+	assert.Same(t, z.Org(), z.Org())
+	assert.Same(t, z.Invitations(), z.Invitations())
+	assert.Same(t, z.Specialty(), z.Specialty())
+}
+
+// fakeClient records the requests, answering them successfully.
+type fakeClient struct {
+	paths []string
+}
+
+func (f *fakeClient) DoRequest(_ context.Context, _, path string, _ map[string]any, response zulip.APIResponse, _ ...zulip.DoRequestOption) error {
+	f.paths = append(f.paths, path)
+	return response.UnmarshalJSON([]byte(`{"result":"success","msg":""}`))
+}
+
+func (f *fakeClient) DoFileRequest(_ context.Context, _, path string, _ string, _ io.Reader, response zulip.APIResponse, _ ...zulip.DoRequestOption) error {
+	f.paths = append(f.paths, path)
+	return response.UnmarshalJSON([]byte(`{"result":"success","msg":""}`))
+}
+
+// greeter is code under test depending on the bundle.
+func greeter(ctx context.Context, z zulipx.API) error {
+	_, err := z.Messages().SendMessageToUsers(ctx, recipient.ToUser("new.user@localhost"), "Welcome!")
+	return err
+}
+
+func TestFakeBundle(t *testing.T) {
+	fake := &fakeClient{}
+
+	require.NoError(t, greeter(context.Background(), zulipx.NewWithClient(fake)))
+	assert.Equal(t, []string{"/api/v1/messages"}, fake.paths)
+
+	var resp zulip.APIResponseBase
+	require.NoError(t, zulipx.NewWithClient(fake).REST().DoRequest(context.Background(), http.MethodGet, "/api/v1/users/me", nil, &resp))
+	assert.True(t, resp.IsSuccess())
+}